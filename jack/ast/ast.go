@@ -0,0 +1,229 @@
+// Package ast holds the typed syntax tree of a Jack class. The tree keeps every choice the source
+// makes, so passes over it can reproduce the source's tokens as well as generate code.
+package ast
+
+import "jack/token"
+
+// Node records where a node starts in the source
+type Node struct {
+	Pos token.Pos
+}
+
+func (n Node) Position() token.Pos {
+	return n.Pos
+}
+
+// 'class' className '{' classVarDec* subroutineDec* '}'
+type Class struct {
+	Node
+	// The file the class was parsed from and its contents
+	FileName    string
+	Src         string
+	Name        string
+	NamePos     token.Pos
+	VarDecs     []*ClassVarDec
+	Subroutines []*Subroutine
+}
+
+// ('static' | 'field') type varName (',' varName)* ';'
+type ClassVarDec struct {
+	Node
+	Kind    string
+	Type    string
+	TypePos token.Pos
+	Names   []string
+	// The position of each name
+	NamePos []token.Pos
+}
+
+// ('constructor' | 'function' | 'method') ('void' | type) subroutineName '(' parameterList ')'
+// '{' varDec* statements '}'
+type Subroutine struct {
+	Node
+	Kind       string
+	ReturnType string
+	TypePos    token.Pos
+	Name       string
+	NamePos    token.Pos
+	Params     []*Param
+	VarDecs    []*VarDec
+	Statements []Statement
+}
+
+// type varName
+type Param struct {
+	Node
+	Type    string
+	Name    string
+	NamePos token.Pos
+}
+
+// 'var' type varName (',' varName)* ';'
+type VarDec struct {
+	Node
+	Type    string
+	TypePos token.Pos
+	Names   []string
+	// The position of each name
+	NamePos []token.Pos
+}
+
+// Statement is one of the statement types below
+type Statement interface {
+	Position() token.Pos
+	statement()
+}
+
+// 'let' varName ('[' expression ']')? '=' expression ';'
+type LetStatement struct {
+	Node
+	Name    string
+	NamePos token.Pos
+	// nil unless an array element is assigned
+	Index *Expression
+	Value *Expression
+}
+
+// 'if' '(' expression ')' '{' statements '}' ('else' '{' statements '}')?
+// The extended dialect also allows 'else' ifStatement.
+type IfStatement struct {
+	Node
+	Cond    *Expression
+	Then    []Statement
+	HasElse bool
+	Else    []Statement
+	// Set when the else branch is an if statement written without braces, which is its only
+	// statement
+	ElseIf bool
+}
+
+// 'while' '(' expression ')' '{' statements '}'
+type WhileStatement struct {
+	Node
+	Cond *Expression
+	Body []Statement
+}
+
+// 'for' '(' letStatement expression ';' 'let' varName ('[' expression ']')? '=' expression ')'
+// '{' statements '}', in the extended dialect. The update is a let statement without its ';'.
+type ForStatement struct {
+	Node
+	Init   *LetStatement
+	Cond   *Expression
+	Update *LetStatement
+	Body   []Statement
+}
+
+// 'break' ';', in the extended dialect
+type BreakStatement struct {
+	Node
+}
+
+// 'continue' ';', in the extended dialect
+type ContinueStatement struct {
+	Node
+}
+
+// 'do' subroutineCall ';'
+type DoStatement struct {
+	Node
+	Call *SubroutineCall
+}
+
+// 'return' expression? ';'
+type ReturnStatement struct {
+	Node
+	// nil when nothing is returned
+	Value *Expression
+}
+
+func (*LetStatement) statement()      {}
+func (*IfStatement) statement()       {}
+func (*WhileStatement) statement()    {}
+func (*ForStatement) statement()      {}
+func (*BreakStatement) statement()    {}
+func (*ContinueStatement) statement() {}
+func (*DoStatement) statement()       {}
+func (*ReturnStatement) statement()   {}
+
+// term (op term)*
+type Expression struct {
+	Node
+	Term Term
+	Ops  []*BinaryOp
+}
+
+// An operator along with the term on its right
+type BinaryOp struct {
+	Node
+	Op   string
+	Term Term
+}
+
+// Term is one of the term types below
+type Term interface {
+	Position() token.Pos
+	term()
+}
+
+type IntConst struct {
+	Node
+	Value int
+}
+
+// The value of a string constant, without its quotes
+type StringConst struct {
+	Node
+	Value string
+}
+
+// One of true, false, null and this
+type KeywordConst struct {
+	Node
+	Value string
+}
+
+type VarRef struct {
+	Node
+	Name string
+}
+
+// varName '[' expression ']'
+type ArrayAccess struct {
+	Node
+	Name  string
+	Index *Expression
+}
+
+// '(' expression ')'
+type ParenExpr struct {
+	Node
+	Expr *Expression
+}
+
+// unaryOp term
+type UnaryOp struct {
+	Node
+	Op   string
+	Term Term
+}
+
+// subroutineName '(' expressionList ')' | (className | varName) '.' subroutineName '(' expressionList ')'
+type SubroutineCall struct {
+	Node
+	// The class or variable before the dot, "" for a call to a subroutine of the same class. The
+	// call starts at the receiver when there is one.
+	Receiver string
+	Name     string
+	NamePos  token.Pos
+	Args     []*Expression
+}
+
+func (*IntConst) term()       {}
+func (*StringConst) term()    {}
+func (*KeywordConst) term()   {}
+func (*VarRef) term()         {}
+func (*ArrayAccess) term()    {}
+func (*ParenExpr) term()      {}
+func (*UnaryOp) term()        {}
+func (*SubroutineCall) term() {}
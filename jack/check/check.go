@@ -0,0 +1,371 @@
+// Package check performs the semantic analysis of a Jack program: name resolution, declarations,
+// subroutine signatures and the few type rules Jack has.
+package check
+
+import (
+	"fmt"
+	"jack/ast"
+	"jack/index"
+	"jack/token"
+)
+
+type variable struct {
+	kind     string
+	dataType string
+}
+
+// Types an expression may have besides the declared ones. Unknown values, like array elements,
+// are compatible with every type.
+const (
+	unknownType = ""
+	nullType    = "null"
+)
+
+type checker struct {
+	ix   *index.Index
+	errs []error
+
+	class   *ast.Class
+	sub     *ast.Subroutine
+	classSt map[string]variable
+	subSt   map[string]variable
+	// Number of loops around the statement being checked
+	loops int
+}
+
+// Check analyzes the classes of a program, returning every error found as a *token.Error. The classes are added to
+// ix, which should already hold the OS classes; a program class replaces an OS class of the same
+// name. Classes that are in neither are reported where they are used.
+func Check(ix *index.Index, classes []*ast.Class) []error {
+	c := &checker{ix: ix}
+
+	declared := make(map[string]bool)
+	for _, class := range classes {
+		c.class = class
+		if declared[class.Name] {
+			c.errorf(class, "class %s is already declared", class.Name)
+			continue
+		}
+		declared[class.Name] = true
+		for _, sub := range ix.AddClass(class) {
+			c.errorf(sub, "subroutine %s.%s is already declared", class.Name, sub.Name)
+		}
+	}
+
+	for _, class := range classes {
+		c.checkClass(class)
+	}
+	return c.errs
+}
+
+func (c *checker) errorf(node interface{ Position() token.Pos }, format string, args ...any) {
+	c.errs = append(c.errs, token.NewError(c.class.FileName, c.class.Src, node.Position(), fmt.Sprintf(format, args...)))
+}
+
+// Adds variables to a symbol table, reporting duplicates and unknown types. Variables of an unknown
+// type are given the unknown type so their uses are not reported again.
+func (c *checker) declare(node interface{ Position() token.Pos }, st map[string]variable, kind string, dataType string, names ...string) {
+	if !c.checkType(node, dataType) {
+		dataType = unknownType
+	}
+	for _, name := range names {
+		if _, ok := st[name]; ok {
+			c.errorf(node, "%s is already declared", name)
+			continue
+		}
+		st[name] = variable{kind: kind, dataType: dataType}
+	}
+}
+
+// Reports t unless it is a primitive type or a known class
+func (c *checker) checkType(node interface{ Position() token.Pos }, t string) bool {
+	if isPrimitive(t) || t == "void" {
+		return true
+	}
+	if !c.ix.HasClass(t) {
+		c.errorf(node, "unknown class %s", t)
+		return false
+	}
+	return true
+}
+
+func (c *checker) checkClass(class *ast.Class) {
+	c.class = class
+	c.classSt = make(map[string]variable)
+	for _, dec := range class.VarDecs {
+		c.declare(dec, c.classSt, dec.Kind, dec.Type, dec.Names...)
+	}
+	for _, sub := range class.Subroutines {
+		c.checkSubroutine(sub)
+	}
+}
+
+func (c *checker) checkSubroutine(sub *ast.Subroutine) {
+	c.sub = sub
+	c.subSt = make(map[string]variable)
+	c.checkType(sub, sub.ReturnType)
+	for _, param := range sub.Params {
+		c.declare(param, c.subSt, "argument", param.Type, param.Name)
+	}
+	for _, dec := range sub.VarDecs {
+		c.declare(dec, c.subSt, "local", dec.Type, dec.Names...)
+	}
+
+	c.checkStatements(sub.Statements)
+	if sub.ReturnType != "void" && !returns(sub.Statements) {
+		c.errorf(sub, "missing return at the end of %s", c.subName())
+	}
+}
+
+// Returns whether every path through statements ends in a return
+func returns(statements []ast.Statement) bool {
+	if len(statements) == 0 {
+		return false
+	}
+	switch s := statements[len(statements)-1].(type) {
+	case *ast.ReturnStatement:
+		return true
+	case *ast.IfStatement:
+		return s.HasElse && returns(s.Then) && returns(s.Else)
+	}
+	return false
+}
+
+func (c *checker) subName() string {
+	return c.class.Name + "." + c.sub.Name
+}
+
+func (c *checker) checkStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			v, ok := c.lookupVar(s, s.Name)
+			if s.Index != nil {
+				c.checkExpression(s.Index)
+				c.checkExpression(s.Value)
+				continue
+			}
+			t := c.checkExpression(s.Value)
+			if ok && !compatible(v.dataType, t) {
+				c.errorf(s, "cannot assign %s to %s %s", t, v.dataType, s.Name)
+			}
+		case *ast.IfStatement:
+			c.checkExpression(s.Cond)
+			c.checkStatements(s.Then)
+			c.checkStatements(s.Else)
+		case *ast.WhileStatement:
+			c.checkExpression(s.Cond)
+			c.checkLoopBody(s.Body)
+		case *ast.ForStatement:
+			c.checkStatements([]ast.Statement{s.Init})
+			c.checkExpression(s.Cond)
+			c.checkStatements([]ast.Statement{s.Update})
+			c.checkLoopBody(s.Body)
+		case *ast.BreakStatement:
+			if c.loops == 0 {
+				c.errorf(s, "break is not in a loop")
+			}
+		case *ast.ContinueStatement:
+			if c.loops == 0 {
+				c.errorf(s, "continue is not in a loop")
+			}
+		case *ast.DoStatement:
+			c.checkCall(s.Call)
+		case *ast.ReturnStatement:
+			c.checkReturn(s)
+		}
+	}
+}
+
+func (c *checker) checkLoopBody(statements []ast.Statement) {
+	c.loops += 1
+	c.checkStatements(statements)
+	c.loops -= 1
+}
+
+func (c *checker) checkReturn(s *ast.ReturnStatement) {
+	if s.Value == nil {
+		if c.sub.ReturnType != "void" {
+			c.errorf(s, "%s must return a %s", c.subName(), c.sub.ReturnType)
+		}
+		return
+	}
+
+	t := c.checkExpression(s.Value)
+	switch {
+	case c.sub.ReturnType == "void":
+		c.errorf(s, "void %s cannot return a value", c.subName())
+	case !compatible(c.sub.ReturnType, t):
+		c.errorf(s, "cannot return %s from %s %s", t, c.sub.ReturnType, c.subName())
+	}
+}
+
+// Looks a variable up in the subroutine and then the class scope
+func (c *checker) findVar(name string) (variable, bool) {
+	v, ok := c.subSt[name]
+	if !ok {
+		v, ok = c.classSt[name]
+	}
+	return v, ok
+}
+
+// Looks a variable up like findVar, reporting undeclared names and fields used outside of methods
+// and constructors
+func (c *checker) lookupVar(node interface{ Position() token.Pos }, name string) (variable, bool) {
+	v, ok := c.findVar(name)
+	if !ok {
+		c.errorf(node, "undeclared identifier %s", name)
+		return variable{}, false
+	}
+	if v.kind == "field" && c.sub.Kind == "function" {
+		c.errorf(node, "field %s used in function %s", name, c.subName())
+	}
+	return v, true
+}
+
+// Returns the type of an expression, reporting errors in its terms
+func (c *checker) checkExpression(expr *ast.Expression) string {
+	t := c.checkTerm(expr.Term)
+	for _, op := range expr.Ops {
+		c.checkTerm(op.Term)
+		switch op.Op {
+		case "<", ">", "=":
+			t = "boolean"
+		case "&", "|":
+			if t != "boolean" {
+				t = "int"
+			}
+		default:
+			t = "int"
+		}
+	}
+	return t
+}
+
+func (c *checker) checkTerm(term ast.Term) string {
+	switch t := term.(type) {
+	case *ast.IntConst:
+		return "int"
+	case *ast.StringConst:
+		return "String"
+	case *ast.KeywordConst:
+		switch t.Value {
+		case "true", "false":
+			return "boolean"
+		case "null":
+			return nullType
+		}
+		if c.sub.Kind == "function" {
+			c.errorf(t, "this used in function %s", c.subName())
+		}
+		return c.class.Name
+	case *ast.VarRef:
+		v, _ := c.lookupVar(t, t.Name)
+		return v.dataType
+	case *ast.ArrayAccess:
+		c.lookupVar(t, t.Name)
+		c.checkExpression(t.Index)
+		return unknownType
+	case *ast.ParenExpr:
+		return c.checkExpression(t.Expr)
+	case *ast.UnaryOp:
+		operand := c.checkTerm(t.Term)
+		if t.Op == "~" && operand == "boolean" {
+			return "boolean"
+		}
+		return "int"
+	case *ast.SubroutineCall:
+		returnType := c.checkCall(t)
+		if returnType == "void" {
+			c.errorf(t, "void %s used as a value", callName(t))
+		}
+		return returnType
+	}
+	return unknownType
+}
+
+func callName(call *ast.SubroutineCall) string {
+	if call.Receiver == "" {
+		return call.Name
+	}
+	return call.Receiver + "." + call.Name
+}
+
+// Resolves the subroutine a call refers to and checks it is called the way it is declared, returning
+// its return type. A call without a class or variable name calls a method on this, or a function or
+// constructor of the current class.
+func (c *checker) checkCall(call *ast.SubroutineCall) string {
+	argTypes := []string{}
+	for _, arg := range call.Args {
+		argTypes = append(argTypes, c.checkExpression(arg))
+	}
+
+	className := call.Receiver
+	// Whether the call passes an object to the subroutine
+	onObject := true
+	if call.Receiver == "" {
+		className = c.class.Name
+		sig, ok := c.ix.Lookup(className, call.Name)
+		onObject = !ok || sig.Kind == "method"
+		if ok && onObject && c.sub.Kind == "function" {
+			c.errorf(call, "method %s.%s called from function %s", className, call.Name, c.subName())
+		}
+	} else if _, ok := c.findVar(call.Receiver); ok {
+		v, _ := c.lookupVar(call, call.Receiver)
+		if isPrimitive(v.dataType) {
+			c.errorf(call, "%s %s has no subroutines", v.dataType, call.Receiver)
+			return unknownType
+		}
+		if v.dataType == unknownType {
+			// The unknown type was reported where the variable was declared
+			return unknownType
+		}
+		className = v.dataType
+	} else {
+		onObject = false
+	}
+
+	if !c.ix.HasClass(className) {
+		c.errorf(call, "unknown class %s", className)
+		return unknownType
+	}
+	sig, ok := c.ix.Lookup(className, call.Name)
+	if !ok {
+		c.errorf(call, "undefined subroutine %s.%s", className, call.Name)
+		return unknownType
+	}
+
+	switch {
+	case onObject && sig.Kind != "method":
+		c.errorf(call, "%s %s.%s called as a method", sig.Kind, className, call.Name)
+	case !onObject && sig.Kind == "method":
+		c.errorf(call, "method %s.%s called as a function", className, call.Name)
+	case len(call.Args) != len(sig.Params):
+		c.errorf(call, "%s.%s takes %d arguments, got %d", className, call.Name, len(sig.Params), len(call.Args))
+	default:
+		for i, param := range sig.Params {
+			if !compatible(param, argTypes[i]) {
+				c.errorf(call.Args[i], "argument %d of %s.%s must be %s, got %s", i+1, className, call.Name, param, argTypes[i])
+			}
+		}
+	}
+	return sig.ReturnType
+}
+
+func isPrimitive(t string) bool {
+	return t == "int" || t == "char" || t == "boolean"
+}
+
+// Returns whether a value of type got can be stored in a variable of type want. The primitive types
+// mix freely, null is compatible with every type and Array doubles as a raw pointer.
+func compatible(want string, got string) bool {
+	switch {
+	case want == unknownType || got == unknownType || got == nullType || want == got:
+		return true
+	case isPrimitive(want) && isPrimitive(got):
+		return true
+	case want == "Array" || got == "Array":
+		return true
+	}
+	return false
+}
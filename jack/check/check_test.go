@@ -0,0 +1,138 @@
+package check
+
+import (
+	"jack/ast"
+	"jack/index"
+	"jack/parser"
+	"jack/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			name: "valid",
+			src: `class Main {
+  field Array a;
+  static int n;
+  constructor Main new() { let a = Array.new(3); let n = n + 1; return this; }
+  method int get() { if (n > 0) { return a[0]; } else { return size(); } }
+  method int size() { return n; }
+  function void main() { var Main m; var char c; let m = Main.new(); let c = m.get(); let m = null; do Output.printInt(c); return; }
+}`,
+		},
+		{
+			name:     "undeclared identifiers",
+			src:      "class Main {\n  function void main() {\n    let x = y[1];\n    do z.run();\n    do Foo.run();\n    return;\n  }\n}",
+			expected: []string{"3:5: undeclared identifier x", "3:13: undeclared identifier y", "4:8: unknown class z", "5:8: unknown class Foo"},
+		},
+		{
+			name:     "duplicate declarations",
+			src:      "class Main {\n  field int x, x;\n  function void f(int a) { var int a; return; }\n  function void f() { return; }\n}",
+			expected: []string{"4:3: subroutine Main.f is already declared", "2:3: x is already declared", "3:28: a is already declared"},
+		},
+		{
+			name:     "wrong types",
+			src:      "class Main {\n  function String f(int n) {\n    var String s;\n    let s = 1;\n    let n = s;\n    return n;\n  }\n}",
+			expected: []string{"4:5: cannot assign int to String s", "5:5: cannot assign String to int n", "6:5: cannot return int from String Main.f"},
+		},
+		{
+			name:     "argument counts",
+			src:      "class Main {\n  function int f(int a, int b) { return a; }\n  function void main() { do Main.f(1); do Math.abs(1, 2); do Output.println(); return; }\n}",
+			expected: []string{"3:29: Main.f takes 2 arguments, got 1", "3:43: Math.abs takes 1 arguments, got 2"},
+		},
+		{
+			name:     "argument types",
+			src:      "class Main {\n  function void main() { do Output.printString(1); do Output.printInt(\"1\"); do Main.f(null, 1); return; }\n  function void f(String s, Array a) { return; }\n}",
+			expected: []string{"2:48: argument 1 of Output.printString must be String, got int", "2:71: argument 1 of Output.printInt must be int, got String"},
+		},
+		{
+			name:     "classes replacing OS classes",
+			src:      "class Math {\n  function int abs(int x, int y) { return Math.sqrt(x); }\n}",
+			expected: []string{"2:43: undefined subroutine Math.sqrt"},
+		},
+		{
+			name:     "this in functions",
+			src:      "class Main {\n  field int x;\n  method void m() { return; }\n  function Main f() { let x = 1; do m(); return this; }\n}",
+			expected: []string{"4:23: field x used in function Main.f", "4:37: method Main.m called from function Main.f", "4:49: this used in function Main.f"},
+		},
+		{
+			name:     "methods called as functions",
+			src:      "class Main {\n  method void m() { return; }\n  function void f() { var Main x; do Main.m(); do x.f(); do f(); return; }\n}",
+			expected: []string{"3:38: method Main.m called as a function", "3:51: function Main.f called as a method"},
+		},
+		{
+			name:     "missing returns",
+			src:      "class Main {\n  function int f(int a) { if (a) { return 1; } }\n  function int g() { while (true) { return 1; } }\n  function int h() { return; }\n  function void v() { return 1; }\n}",
+			expected: []string{"2:3: missing return at the end of Main.f", "3:3: missing return at the end of Main.g", "4:22: Main.h must return a int", "5:23: void Main.v cannot return a value"},
+		},
+		{
+			name:     "loops",
+			src:      "class Main {\n  function void f() {\n    var int i;\n    break;\n    for (let i = 0; i < 3; let j = i) { if (i) { continue; } else if (x) { break; } }\n    while (true) { break; }\n    continue;\n    return;\n  }\n}",
+			expected: []string{"4:5: break is not in a loop", "5:28: undeclared identifier j", "5:71: undeclared identifier x", "7:5: continue is not in a loop"},
+		},
+		{
+			name:     "void results used in expressions",
+			src:      "class Main {\n  function void main() { var int x; let x = 1 + Output.println(); return; }\n}",
+			expected: []string{"2:49: void Output.println used as a value"},
+		},
+	}
+
+	for _, tc := range tests {
+		class, syntaxErrs := parser.ParseMode("Main.jack", tc.src, parser.Extended)
+		if len(syntaxErrs) > 0 {
+			t.Fatalf("Failed to parse %s: %v", tc.name, syntaxErrs)
+		}
+		errs := []string{}
+		for _, err := range Check(index.OS(), []*ast.Class{class}) {
+			errs = append(errs, err.(*token.Error).Pos.String()+": "+err.(*token.Error).Msg)
+		}
+		if !slices.Equal(errs, tc.expected) {
+			t.Errorf("Checking %s reported %q, expected %q", tc.name, errs, tc.expected)
+		}
+	}
+}
+
+// The course programs the compiler is tested with, the game and the OS test programs are free of
+// semantic errors
+func TestCheckCoursePrograms(t *testing.T) {
+	dirs, err := filepath.Glob("../../project11/jack/*")
+	if err != nil {
+		t.Fatalf("Failed to list course programs: %v", err)
+	}
+	osTests, err := filepath.Glob("../../project12/test/*")
+	if err != nil {
+		t.Fatalf("Failed to list OS test programs: %v", err)
+	}
+	dirs = append(dirs, "../../project10/jack/ArrayTest", "../../project10/jack/Square", "../../project09")
+	dirs = append(dirs, osTests...)
+
+	for _, dir := range dirs {
+		jackPaths, err := filepath.Glob(filepath.Join(dir, "*.jack"))
+		if err != nil || len(jackPaths) == 0 {
+			t.Fatalf("Failed to list jack files in %s: %v", dir, err)
+		}
+		classes := []*ast.Class{}
+		for _, jackPath := range jackPaths {
+			src, err := os.ReadFile(jackPath)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", jackPath, err)
+			}
+			class, errs := parser.Parse(jackPath, string(src))
+			if len(errs) > 0 {
+				t.Fatalf("Failed to parse %s: %v", jackPath, errs)
+			}
+			classes = append(classes, class)
+		}
+		for _, err := range Check(index.OS(), classes) {
+			t.Errorf("Checking %s: %v", dir, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"jack/format"
+	"jack/parser"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	write := flag.Bool("w", false, "write the formatted source back to the jack files instead of stdout")
+	check := flag.Bool("check", false, "list the jack files that are not formatted and exit with status 1 if there are any")
+	diff := flag.Bool("diff", false, "print the changes formatting would make as a unified diff")
+	extended := flag.Bool("extended", false, "accept the extended dialect with for loops, break, continue, else if, character and hex constants and string escapes")
+	flag.Parse()
+	mode := parser.Mode(0)
+	if *extended {
+		mode = parser.Extended
+	}
+
+	if flag.NArg() < 1 {
+		log.Fatal("Path to jack file or directory for formatting was not provided")
+	}
+
+	failed, unformatted := false, false
+	for _, programPath := range flag.Args() {
+		jackFilePaths := []string{programPath}
+		if filepath.Ext(programPath) != ".jack" {
+			var err error
+			jackFilePaths, err = filepath.Glob(filepath.Join(programPath, "*.jack"))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		for _, jackFilePath := range jackFilePaths {
+			src, err := os.ReadFile(jackFilePath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			formatted, errs := format.Source(jackFilePath, src, mode)
+			if len(errs) > 0 {
+				for _, err := range errs {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				failed = true
+				continue
+			}
+
+			changed := !bytes.Equal(src, formatted)
+			switch {
+			case *check || *diff:
+				if changed && *check {
+					fmt.Println(jackFilePath)
+					unformatted = true
+				}
+				if changed && *diff {
+					os.Stdout.Write(format.Diff(jackFilePath+".orig", jackFilePath, src, formatted))
+				}
+			case *write:
+				if changed {
+					if err := os.WriteFile(jackFilePath, formatted, 0644); err != nil {
+						log.Fatal(err)
+					}
+				}
+			default:
+				if _, err := os.Stdout.Write(formatted); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+
+	if failed {
+		os.Exit(2)
+	}
+	if unformatted {
+		os.Exit(1)
+	}
+}
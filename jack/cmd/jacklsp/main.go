@@ -0,0 +1,15 @@
+package main
+
+import (
+	"jack/lsp"
+	"log"
+	"os"
+)
+
+// Serves the Language Server Protocol over stdin and stdout. Logs go to stderr, which editors
+// show as the server's output.
+func main() {
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,172 @@
+// Package driver runs the passes shared by the Jack tools over every file of a program: the files
+// are parsed in parallel, checked together and then each written to output/ next to its source.
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"jack/ast"
+	"jack/parser"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type Options struct {
+	// Extension of the output files, like ".vm"
+	OutputExt string
+	// Writes the output of a class. Called concurrently for different classes.
+	Generate func(w io.Writer, class *ast.Class) error
+	// Checks the classes of the whole program once they parse, optional
+	Check func(classes []*ast.Class) []error
+	// Number of files parsed or generated at once, runtime.GOMAXPROCS(0) when 0
+	Workers int
+	// Dialect of the jack files
+	Mode parser.Mode
+}
+
+// Run compiles the program at programPath, a directory of jack files or a single jack file, and
+// returns every error found grouped by file in path order. A single file is checked along with the
+// other classes of its directory, but only its output is written. Outputs are written only when
+// the whole program is free of errors, each one replacing the previous output in a single rename.
+func Run(programPath string, opts Options) []error {
+	jackPaths, programPaths, err := listJackPaths(programPath, opts.Check != nil)
+	if err != nil {
+		return []error{err}
+	}
+	workers := opts.Workers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	classes := make([]*ast.Class, len(programPaths))
+	fileErrs := make([][]error, len(programPaths))
+	forEach(len(programPaths), workers, func(i int) {
+		src, err := os.ReadFile(programPaths[i])
+		if err != nil {
+			fileErrs[i] = []error{err}
+			return
+		}
+		classes[i], fileErrs[i] = parser.ParseMode(programPaths[i], string(src), opts.Mode)
+	})
+	if errs := slices.Concat(fileErrs...); len(errs) > 0 {
+		// The trees of classes with syntax errors are incomplete, so they are not checked
+		return errs
+	}
+	if opts.Check != nil {
+		if errs := opts.Check(classes); len(errs) > 0 {
+			return errs
+		}
+	}
+
+	fileErrs = make([][]error, len(jackPaths))
+	forEach(len(jackPaths), workers, func(i int) {
+		// The files to write come first in programPaths
+		if err := writeOutput(jackPaths[i], opts, classes[i]); err != nil {
+			fileErrs[i] = []error{err}
+		}
+	})
+	return slices.Concat(fileErrs...)
+}
+
+// Calls f with 0 to n-1 from at most workers goroutines at once, returning once every call has
+// returned
+func forEach(n int, workers int, f func(i int)) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, n) {
+		wg.Go(func() {
+			for i := range next {
+				f(i)
+			}
+		})
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// Generates the output of a class into memory, then moves it into place so readers never see a
+// partial file
+func writeOutput(jackPath string, opts Options, class *ast.Class) error {
+	var b bytes.Buffer
+	if err := opts.Generate(&b, class); err != nil {
+		return fmt.Errorf("%s: %w", jackPath, err)
+	}
+
+	dir, fileName := filepath.Split(jackPath)
+	outDir := filepath.Join(dir, "output")
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(outDir, "."+fileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b.Bytes())
+	err = errors.Join(err, tmp.Chmod(0644), tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(outDir, strings.TrimSuffix(fileName, ".jack")+opts.OutputExt))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Returns the jack files to compile and the jack files of the program they belong to, with the files
+// to compile first
+func listJackPaths(programPath string, withProgram bool) ([]string, []string, error) {
+	info, err := os.Stat(programPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		jackPaths, err := jackPathsInDir(programPath)
+		return jackPaths, jackPaths, err
+	}
+	if !strings.HasSuffix(programPath, ".jack") {
+		return nil, nil, fmt.Errorf("%s is not a .jack file", programPath)
+	}
+
+	jackPaths := []string{programPath}
+	if !withProgram {
+		return jackPaths, jackPaths, nil
+	}
+	dirPaths, err := jackPathsInDir(filepath.Dir(programPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	programPaths := []string{programPath}
+	for _, path := range dirPaths {
+		if filepath.Clean(path) != filepath.Clean(programPath) {
+			programPaths = append(programPaths, path)
+		}
+	}
+	return jackPaths, programPaths, nil
+}
+
+func jackPathsInDir(dirPath string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	jackPaths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jack") {
+			jackPaths = append(jackPaths, filepath.Join(dirPath, entry.Name()))
+		}
+	}
+	if len(jackPaths) == 0 {
+		return nil, fmt.Errorf("no .jack files in %s", dirPath)
+	}
+	return jackPaths, nil
+}
@@ -0,0 +1,124 @@
+package driver
+
+import (
+	"fmt"
+	"io"
+	"jack/ast"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Writes classes Class0 to Classn-1 to dir, each calling the next
+func writeProgram(t *testing.T, dir string, n int) {
+	for i := range n {
+		src := fmt.Sprintf("class Class%d {\n  function void f() { do Class%d.f(); return; }\n}\n", i, (i+1)%n)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("Class%d.jack", i)), []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write jack file: %v", err)
+		}
+	}
+}
+
+// Writes the class name and the number of subroutines of each class
+func generateSummary(w io.Writer, class *ast.Class) error {
+	_, err := fmt.Fprintf(w, "%s %d\n", class.Name, len(class.Subroutines))
+	return err
+}
+
+// Meant to run with -race: every file is parsed and generated by a pool of workers
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeProgram(t, dir, 32)
+
+	var running, maxRunning atomic.Int32
+	opts := Options{
+		OutputExt: ".txt",
+		Workers:   4,
+		Generate: func(w io.Writer, class *ast.Class) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for m := maxRunning.Load(); n > m && !maxRunning.CompareAndSwap(m, n); m = maxRunning.Load() {
+			}
+			return generateSummary(w, class)
+		},
+		Check: func(classes []*ast.Class) []error {
+			if len(classes) != 32 {
+				return []error{fmt.Errorf("checked %d classes, expected 32", len(classes))}
+			}
+			return nil
+		},
+	}
+	if errs := Run(dir, opts); len(errs) > 0 {
+		t.Fatalf("Failed to compile: %v", errs)
+	}
+	if maxRunning.Load() > 4 {
+		t.Errorf("Generated %d files at once, expected at most 4", maxRunning.Load())
+	}
+
+	for i := range 32 {
+		out, err := os.ReadFile(filepath.Join(dir, "output", fmt.Sprintf("Class%d.txt", i)))
+		if err != nil {
+			t.Fatalf("Failed to read output: %v", err)
+		}
+		if expected := fmt.Sprintf("Class%d 1\n", i); string(out) != expected {
+			t.Errorf("Output of Class%d is %q, expected %q", i, out, expected)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "output"))
+	if err != nil || len(entries) != 32 {
+		t.Errorf("Output directory has %d entries, expected the 32 outputs and no temporary files", len(entries))
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeProgram(t, dir, 8)
+	for _, i := range []int{5, 2} {
+		src := fmt.Sprintf("class Class%d {\n  function void f() { let = 1; do x(; return; }\n}\n", i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("Class%d.jack", i)), []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write jack file: %v", err)
+		}
+	}
+
+	errs := Run(dir, Options{OutputExt: ".txt", Workers: 3, Generate: generateSummary})
+	files := []string{}
+	for _, err := range errs {
+		fileName, _, _ := strings.Cut(err.Error(), ":")
+		files = append(files, filepath.Base(fileName))
+	}
+	expected := []string{"Class2.jack", "Class2.jack", "Class5.jack", "Class5.jack"}
+	if !slices.Equal(files, expected) {
+		t.Errorf("Errors are in files %v, expected %v", files, expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "output")); !os.IsNotExist(err) {
+		t.Errorf("Output was written for a program with errors")
+	}
+}
+
+func TestRunSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	writeProgram(t, dir, 3)
+
+	checked := 0
+	opts := Options{
+		OutputExt: ".txt",
+		Generate:  generateSummary,
+		Check: func(classes []*ast.Class) []error {
+			checked = len(classes)
+			return nil
+		},
+	}
+	if errs := Run(filepath.Join(dir, "Class1.jack"), opts); len(errs) > 0 {
+		t.Fatalf("Failed to compile: %v", errs)
+	}
+	if checked != 3 {
+		t.Errorf("Checked %d classes, expected the 3 classes of the program", checked)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "output"))
+	if err != nil || len(entries) != 1 || entries[0].Name() != "Class1.txt" {
+		t.Errorf("Output directory has %v, expected only Class1.txt", entries)
+	}
+}
@@ -0,0 +1,414 @@
+// Package format pretty-prints Jack source: classes are laid out one declaration or statement per
+// line, indented by depth, with single spaces around binary operators and comments kept where
+// they were written.
+package format
+
+import (
+	"fmt"
+	"jack/ast"
+	"jack/parser"
+	"jack/token"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+const indent = "    "
+
+// A line of output. A comment ending a line is kept apart so the comments of consecutive lines can
+// be aligned.
+type line struct {
+	depth   int
+	code    string
+	comment string
+}
+
+// Prints a syntax tree while walking the tokens of its source in step, which places each comment
+// before the token that follows it in the source and keeps the tokens of the output identical to
+// the source's
+type printer struct {
+	src         string
+	tokens      []token.Token
+	next        int
+	comments    []token.Comment
+	nextComment int
+
+	depth int
+	// Extra indentation of a statement broken across lines by a comment
+	continued bool
+	lines     []line
+	// The line being printed, nil between lines
+	curr *line
+	// The source line the last printed token or comment ends on
+	lastLine int
+	lastText string
+}
+
+// Source returns the formatted src, or the errors that keep it from parsing in the dialect of mode.
+// Runs of blank lines are collapsed into one and blank lines right inside braces are removed.
+func Source(fileName string, src []byte, mode parser.Mode) ([]byte, []error) {
+	class, errs := parser.ParseMode(fileName, string(src), mode)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	lexer := token.NewLexer(fileName, string(src))
+	if mode&parser.Extended != 0 {
+		lexer = token.NewExtendedLexer(fileName, string(src))
+	}
+	p := &printer{src: string(src)}
+	for t, ok := lexer.Next(); ok; t, ok = lexer.Next() {
+		p.tokens = append(p.tokens, t)
+	}
+	p.comments = lexer.Comments()
+
+	p.class(class)
+	p.flushComments(token.Pos{Line: math.MaxInt})
+	p.endLine()
+	return p.render(), nil
+}
+
+// Ends the line being printed
+func (p *printer) endLine() {
+	if p.curr != nil {
+		p.lines = append(p.lines, *p.curr)
+		p.curr = nil
+	}
+}
+
+// Ends a line of the layout, after which the next statement or declaration starts
+func (p *printer) newline() {
+	p.endLine()
+	p.continued = false
+}
+
+// Starts a line for source that begins on srcLine, keeping one blank line if the source had any
+// before it
+func (p *printer) startLine(srcLine int, text string) {
+	if srcLine > p.lastLine+1 && len(p.lines) > 0 && p.lastText != "{" && text != "}" {
+		p.lines = append(p.lines, line{})
+	}
+	depth := p.depth
+	if p.continued {
+		depth += 1
+	}
+	p.curr = &line{depth: depth}
+}
+
+// Prints the next token of the source, which must be text unless text is empty, preceded by a
+// space if space is set and the token does not start a line
+func (p *printer) token(text string, space bool) {
+	t := p.tokens[p.next]
+	if text != "" && t.Text != text {
+		panic(fmt.Sprintf("format: printing %s at the position of %s at %s", text, t.Text, t.Pos))
+	}
+	p.flushComments(t.Pos)
+
+	if p.curr == nil {
+		p.startLine(t.Pos.Line, t.Text)
+	} else {
+		if p.curr.comment != "" {
+			// A block comment in the middle of the line
+			p.curr.code += " " + p.curr.comment
+			p.curr.comment = ""
+			space = true
+		}
+		if space {
+			p.curr.code += " "
+		}
+	}
+	p.curr.code += t.Text
+	p.next += 1
+	p.lastLine = t.Pos.Line
+	p.lastText = t.Text
+}
+
+// Prints the comments that come before pos in the source. A comment on the same line as the
+// source printed last stays at the end of its line; any other gets a line of its own.
+func (p *printer) flushComments(pos token.Pos) {
+	for ; p.nextComment < len(p.comments); p.nextComment++ {
+		c := p.comments[p.nextComment]
+		c.Text = strings.ReplaceAll(c.Text, "\r\n", "\n")
+		if c.Pos.Line > pos.Line || (c.Pos.Line == pos.Line && c.Pos.Column >= pos.Column) {
+			return
+		}
+
+		if c.Pos.Line == p.lastLine && (p.curr != nil || len(p.lines) > 0) {
+			target := p.curr
+			if target == nil {
+				target = &p.lines[len(p.lines)-1]
+			}
+			if target.comment != "" {
+				target.code += " " + target.comment
+			}
+			target.comment = c.Text
+			if p.curr != nil && strings.HasPrefix(c.Text, "//") {
+				// The rest of the statement moves to the next line
+				p.endLine()
+				p.continued = true
+			}
+		} else {
+			if p.curr != nil {
+				p.endLine()
+				p.continued = true
+			}
+			p.startLine(c.Pos.Line, c.Text)
+			p.curr.code = p.reindent(c)
+			p.endLine()
+		}
+		p.lastLine = c.Pos.Line + strings.Count(c.Text, "\n")
+		p.lastText = c.Text
+	}
+}
+
+// Moves the lines of a block comment that starts its line along with its first line, so a comment
+// spanning lines keeps its shape when its indentation changes. Trailing whitespace is removed.
+func (p *printer) reindent(c token.Comment) string {
+	lines := strings.Split(c.Text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	srcLine := []rune(strings.SplitN(p.src, "\n", c.Pos.Line+1)[c.Pos.Line-1])
+	oldPrefix := string(srcLine[:c.Pos.Column-1])
+	newPrefix := strings.Repeat(indent, p.curr.depth)
+	for i := 1; i < len(lines); i++ {
+		if rest, ok := strings.CutPrefix(lines[i], oldPrefix); ok {
+			lines[i] = newPrefix + rest
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Writes out the lines, aligning the comments at the end of consecutive lines of the same depth
+func (p *printer) render() []byte {
+	var b strings.Builder
+	for i := 0; i < len(p.lines); {
+		// A run of lines ending in comments, or a single line
+		j := i + 1
+		width := utf8.RuneCountInString(p.lines[i].code)
+		if p.lines[i].comment != "" {
+			for j < len(p.lines) && p.lines[j].comment != "" && p.lines[j].depth == p.lines[i].depth {
+				width = max(width, utf8.RuneCountInString(p.lines[j].code))
+				j += 1
+			}
+		}
+		for _, l := range p.lines[i:j] {
+			if l.code != "" || l.comment != "" {
+				b.WriteString(strings.Repeat(indent, l.depth))
+			}
+			b.WriteString(l.code)
+			if l.comment != "" {
+				b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(l.code)+1))
+				b.WriteString(l.comment)
+			}
+			b.WriteString("\n")
+		}
+		i = j
+	}
+	return []byte(b.String())
+}
+
+// Ends a level of indentation before a closing brace. The comments before the brace stay at the
+// indentation of the block they are in.
+func (p *printer) dedent() {
+	p.flushComments(p.tokens[p.next].Pos)
+	p.depth -= 1
+}
+
+// 'class' className '{' classVarDec* subroutineDec* '}'
+func (p *printer) class(class *ast.Class) {
+	p.token("class", false)
+	p.token(class.Name, true)
+	p.token("{", true)
+	p.newline()
+	p.depth += 1
+	for _, dec := range class.VarDecs {
+		p.token(dec.Kind, false)
+		p.token(dec.Type, true)
+		p.names(dec.Names)
+		p.token(";", false)
+		p.newline()
+	}
+	for _, sub := range class.Subroutines {
+		p.subroutine(sub)
+	}
+	p.dedent()
+	p.token("}", false)
+	p.newline()
+}
+
+// varName (',' varName)*
+func (p *printer) names(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			p.token(",", false)
+		}
+		p.token(name, true)
+	}
+}
+
+// ('constructor' | 'function' | 'method') ('void' | type) subroutineName '(' parameterList ')'
+// '{' varDec* statements '}'
+func (p *printer) subroutine(sub *ast.Subroutine) {
+	p.token(sub.Kind, false)
+	p.token(sub.ReturnType, true)
+	p.token(sub.Name, true)
+	p.token("(", false)
+	for i, param := range sub.Params {
+		if i > 0 {
+			p.token(",", false)
+		}
+		p.token(param.Type, i > 0)
+		p.token(param.Name, true)
+	}
+	p.token(")", false)
+	p.token("{", true)
+	p.newline()
+
+	p.depth += 1
+	for _, dec := range sub.VarDecs {
+		p.token("var", false)
+		p.token(dec.Type, true)
+		p.names(dec.Names)
+		p.token(";", false)
+		p.newline()
+	}
+	p.statements(sub.Statements)
+	p.dedent()
+	p.token("}", false)
+	p.newline()
+}
+
+// Prints a block of statements followed by its closing brace
+func (p *printer) block(statements []ast.Statement) {
+	p.token("{", true)
+	p.newline()
+	p.depth += 1
+	p.statements(statements)
+	p.dedent()
+	p.token("}", false)
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			p.assignment(s, false)
+			p.token(";", false)
+		case *ast.IfStatement:
+			p.ifStatement(s)
+		case *ast.WhileStatement:
+			p.token("while", false)
+			p.token("(", true)
+			p.expression(s.Cond, false)
+			p.token(")", false)
+			p.block(s.Body)
+		case *ast.ForStatement:
+			p.token("for", false)
+			p.token("(", true)
+			p.assignment(s.Init, false)
+			p.token(";", false)
+			p.expression(s.Cond, true)
+			p.token(";", false)
+			p.assignment(s.Update, true)
+			p.token(")", false)
+			p.block(s.Body)
+		case *ast.BreakStatement:
+			p.token("break", false)
+			p.token(";", false)
+		case *ast.ContinueStatement:
+			p.token("continue", false)
+			p.token(";", false)
+		case *ast.DoStatement:
+			p.token("do", false)
+			p.term(s.Call, true)
+			p.token(";", false)
+		case *ast.ReturnStatement:
+			p.token("return", false)
+			if s.Value != nil {
+				p.expression(s.Value, true)
+			}
+			p.token(";", false)
+		}
+		p.newline()
+	}
+}
+
+// 'let' varName ('[' expression ']')? '=' expression, without the ';' so it can also print the
+// update of a for loop
+func (p *printer) assignment(let *ast.LetStatement, space bool) {
+	p.token("let", space)
+	p.token(let.Name, true)
+	if let.Index != nil {
+		p.token("[", false)
+		p.expression(let.Index, false)
+		p.token("]", false)
+	}
+	p.token("=", true)
+	p.expression(let.Value, true)
+}
+
+// Prints an if statement, continuing an else if chain on the line of the else
+func (p *printer) ifStatement(s *ast.IfStatement) {
+	p.token("if", true)
+	p.token("(", true)
+	p.expression(s.Cond, false)
+	p.token(")", false)
+	p.block(s.Then)
+	if s.ElseIf {
+		p.token("else", true)
+		p.ifStatement(s.Else[0].(*ast.IfStatement))
+	} else if s.HasElse {
+		p.token("else", true)
+		p.block(s.Else)
+	}
+}
+
+// term (op term)*
+func (p *printer) expression(expr *ast.Expression, space bool) {
+	p.term(expr.Term, space)
+	for _, op := range expr.Ops {
+		p.token(op.Op, true)
+		p.term(op.Term, true)
+	}
+}
+
+func (p *printer) term(term ast.Term, space bool) {
+	switch t := term.(type) {
+	case *ast.IntConst, *ast.StringConst:
+		// Printed as written, so leading zeros and escapes are left alone
+		p.token("", space)
+	case *ast.KeywordConst:
+		p.token(t.Value, space)
+	case *ast.VarRef:
+		p.token(t.Name, space)
+	case *ast.ArrayAccess:
+		p.token(t.Name, space)
+		p.token("[", false)
+		p.expression(t.Index, false)
+		p.token("]", false)
+	case *ast.ParenExpr:
+		p.token("(", space)
+		p.expression(t.Expr, false)
+		p.token(")", false)
+	case *ast.UnaryOp:
+		p.token(t.Op, space)
+		p.term(t.Term, false)
+	case *ast.SubroutineCall:
+		if t.Receiver != "" {
+			p.token(t.Receiver, space)
+			p.token(".", false)
+			p.token(t.Name, false)
+		} else {
+			p.token(t.Name, space)
+		}
+		p.token("(", false)
+		for i, arg := range t.Args {
+			if i > 0 {
+				p.token(",", false)
+			}
+			p.expression(arg, i > 0)
+		}
+		p.token(")", false)
+	}
+}
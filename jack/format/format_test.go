@@ -0,0 +1,204 @@
+package format
+
+import (
+	"io/fs"
+	"jack/parser"
+	"jack/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "layout",
+			src:      "class Main{field int x,y;function void main(){var int i;let i=-x*(y+1);if(i<0){do Main.f(i,2);}else{let a[i]=~i;}while(i){return;}return;}}",
+			expected: "class Main {\n    field int x, y;\n    function void main() {\n        var int i;\n        let i = -x * (y + 1);\n        if (i < 0) {\n            do Main.f(i, 2);\n        } else {\n            let a[i] = ~i;\n        }\n        while (i) {\n            return;\n        }\n        return;\n    }\n}\n",
+		},
+		{
+			name:     "blank lines",
+			src:      "class Main {\n\n  field int x;\n\n\n  method void f() {\n\n    return;\n\n  }\n}\n",
+			expected: "class Main {\n    field int x;\n\n    method void f() {\n        return;\n    }\n}\n",
+		},
+		{
+			name:     "comments",
+			src:      "// Main\nclass Main { // the class\n  static int a; // first\n  static int bb; // second\n\n  /** Does\n      nothing. */\n  function void f() {\n    while (true) {\n      // nothing\n    }\n    return; /* done */\n  }\n}\n",
+			expected: "// Main\nclass Main { // the class\n    static int a;  // first\n    static int bb; // second\n\n    /** Does\n        nothing. */\n    function void f() {\n        while (true) {\n            // nothing\n        }\n        return; /* done */\n    }\n}\n",
+		},
+		{
+			name:     "comment inside a statement",
+			src:      "class Main {\n  function int f() {\n    return 1 + // one\n    2;\n  }\n}\n",
+			expected: "class Main {\n    function int f() {\n        return 1 + // one\n            2;\n    }\n}\n",
+		},
+		{
+			name:     "extended statements",
+			src:      "class Main {\n  function void f() {\n    for(let i=0;i<3;let a[i]=i){if(i=1){continue;}else if(i=2){break;}else{}}\n    return;\n  }\n}\n",
+			expected: "class Main {\n    function void f() {\n        for (let i = 0; i < 3; let a[i] = i) {\n            if (i = 1) {\n                continue;\n            } else if (i = 2) {\n                break;\n            } else {\n            }\n        }\n        return;\n    }\n}\n",
+		},
+		{
+			name:     "constants as written",
+			src:      "class Main {\r\n  function void f() {\r\n    do Output.printString(\"a  b\");\r\n    do Output.printInt(007);\r\n    return;\r\n  }\r\n}",
+			expected: "class Main {\n    function void f() {\n        do Output.printString(\"a  b\");\n        do Output.printInt(007);\n        return;\n    }\n}\n",
+		},
+		{
+			name:     "extended constants as written",
+			src:      "class Main {\n  function void f() {\n    do Output.printString(\"a \\\"b\\\"\\n\");\n    do Output.printChar('\\'');\n    do Output.printInt(0x1F+0b1);\n    return;\n  }\n}\n",
+			expected: "class Main {\n    function void f() {\n        do Output.printString(\"a \\\"b\\\"\\n\");\n        do Output.printChar('\\'');\n        do Output.printInt(0x1F + 0b1);\n        return;\n    }\n}\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, errs := Source("Main.jack", []byte(tc.src), parser.Extended)
+			if len(errs) > 0 {
+				t.Fatalf("Failed to format: %v", errs)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("Formatted to %q, expected %q", got, tc.expected)
+			}
+			if again, _ := Source("Main.jack", got, parser.Extended); string(again) != string(got) {
+				t.Errorf("Formatting is not idempotent: %q formatted to %q", got, again)
+			}
+		})
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	if _, errs := Source("Main.jack", []byte("class Main { function void f() { let x = ; } }"), 0); len(errs) == 0 {
+		t.Errorf("Formatted source with a syntax error")
+	}
+}
+
+// Returns the tokens and the text of the comments of src
+func lex(src []byte) ([]token.Token, int) {
+	lexer := token.NewLexer("", string(src))
+	tokens := []token.Token{}
+	for t, ok := lexer.Next(); ok; t, ok = lexer.Next() {
+		t.Pos = token.Pos{}
+		tokens = append(tokens, t)
+	}
+	return tokens, len(lexer.Comments())
+}
+
+// Every jack file in the repo formats idempotently to the same tokens and comments, so it compiles
+// to the same vm code
+func TestFormatRepoFiles(t *testing.T) {
+	err := filepath.WalkDir("../..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".jack") {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		formatted, errs := Source(path, src, 0)
+		if len(errs) > 0 {
+			t.Errorf("Failed to format %s: %v", path, errs)
+			return nil
+		}
+
+		srcTokens, srcComments := lex(src)
+		tokens, comments := lex(formatted)
+		if !slices.Equal(tokens, srcTokens) || comments != srcComments {
+			t.Errorf("Formatting %s changed its tokens or comments", path)
+		}
+		if again, _ := Source(path, formatted, 0); string(again) != string(formatted) {
+			t.Errorf("Formatting %s is not idempotent", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk jack files: %v", err)
+	}
+}
+
+// The game compiles to the same vm code before and after formatting, which is also the vm code
+// checked in next to it, compiled before its sources were formatted
+func TestFormatKeepsVmCode(t *testing.T) {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("No go command available to build the compiler")
+	}
+	jackcPath := filepath.Join(t.TempDir(), "jackc")
+	build := exec.Command(goPath, "build", "-o", jackcPath, ".")
+	build.Dir = "../../project11"
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build the compiler: %v\n%s", err, out)
+	}
+
+	jackPaths, err := filepath.Glob("../../project09/*.jack")
+	if err != nil || len(jackPaths) == 0 {
+		t.Fatalf("Failed to list the game's jack files: %v", err)
+	}
+	// The game's sources are formatted already, so they are laid out one token per line first
+	before, after := t.TempDir(), t.TempDir()
+	for _, jackPath := range jackPaths {
+		src, err := os.ReadFile(jackPath)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", jackPath, err)
+		}
+		tokens, _ := lex(src)
+		texts := []string{}
+		for _, tok := range tokens {
+			texts = append(texts, tok.Text)
+		}
+		unformatted := []byte(strings.Join(texts, "\n") + "\n")
+		formatted, errs := Source(jackPath, unformatted, 0)
+		if len(errs) > 0 {
+			t.Fatalf("Failed to format %s: %v", jackPath, errs)
+		}
+		if err := os.WriteFile(filepath.Join(before, filepath.Base(jackPath)), unformatted, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", jackPath, err)
+		}
+		if err := os.WriteFile(filepath.Join(after, filepath.Base(jackPath)), formatted, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", jackPath, err)
+		}
+	}
+	for _, dir := range []string{before, after} {
+		if out, err := exec.Command(jackcPath, dir).CombinedOutput(); err != nil {
+			t.Fatalf("Failed to compile %s: %v\n%s", dir, err, out)
+		}
+	}
+
+	for _, jackPath := range jackPaths {
+		vmName := strings.TrimSuffix(filepath.Base(jackPath), ".jack") + ".vm"
+		expected, err := os.ReadFile(filepath.Join(filepath.Dir(jackPath), vmName))
+		if err != nil {
+			t.Fatalf("Failed to read the checked in %s: %v", vmName, err)
+		}
+		for _, dir := range []string{before, after} {
+			vm, err := os.ReadFile(filepath.Join(dir, "output", vmName))
+			if err != nil {
+				t.Fatalf("Failed to read the compiled %s: %v", vmName, err)
+			}
+			if string(vm) != string(expected) {
+				t.Errorf("%s compiled from %s differs from the checked in vm code", vmName, dir)
+			}
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nm\nn\n"
+	expected := "--- old\n+++ new\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -9,5 +9,5 @@\n i\n j\n k\n-l\n m\n+n\n"
+	if got := string(Diff("old", "new", []byte(old), []byte(new))); got != expected {
+		t.Errorf("Diff is %q, expected %q", got, expected)
+	}
+	if got := Diff("old", "new", []byte(old), []byte(old)); got != nil {
+		t.Errorf("Diff of equal texts is %q, expected nil", got)
+	}
+}
@@ -0,0 +1,3 @@
+module jack
+
+go 1.25.1
@@ -0,0 +1,76 @@
+// Package index records the subroutines of every class a Jack program can call: the classes of the
+// program itself and the OS classes, which are loaded from a signature file.
+package index
+
+import (
+	_ "embed"
+	"jack/ast"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Subroutine is the signature of a subroutine, with the types of its parameters in order
+type Subroutine struct {
+	Kind       string
+	ReturnType string
+	Params     []string
+}
+
+// Index maps class names to their subroutines by name
+type Index struct {
+	classes map[string]map[string]Subroutine
+}
+
+//go:embed os.jacksig
+var osSignatures string
+
+func New() *Index {
+	return &Index{classes: make(map[string]map[string]Subroutine)}
+}
+
+// OS returns an index of the Jack OS classes
+func OS() *Index {
+	ix, err := Load("os.jacksig", strings.NewReader(osSignatures))
+	if err != nil {
+		panic(err)
+	}
+	return ix
+}
+
+// AddClass indexes the subroutines of a class, replacing any class of the same name. Subroutines
+// declared more than once keep their first declaration and are returned.
+func (ix *Index) AddClass(class *ast.Class) []*ast.Subroutine {
+	subs := make(map[string]Subroutine)
+	duplicates := []*ast.Subroutine{}
+	for _, sub := range class.Subroutines {
+		if _, ok := subs[sub.Name]; ok {
+			duplicates = append(duplicates, sub)
+			continue
+		}
+		sig := Subroutine{Kind: sub.Kind, ReturnType: sub.ReturnType}
+		for _, param := range sub.Params {
+			sig.Params = append(sig.Params, param.Type)
+		}
+		subs[sub.Name] = sig
+	}
+	ix.classes[class.Name] = subs
+	return duplicates
+}
+
+// HasClass returns whether the class is indexed
+func (ix *Index) HasClass(className string) bool {
+	_, ok := ix.classes[className]
+	return ok
+}
+
+// Lookup returns the signature of className.name
+func (ix *Index) Lookup(className string, name string) (Subroutine, bool) {
+	sub, ok := ix.classes[className][name]
+	return sub, ok
+}
+
+// Subroutines returns the names of the subroutines of className in alphabetical order
+func (ix *Index) Subroutines(className string) []string {
+	return slices.Sorted(maps.Keys(ix.classes[className]))
+}
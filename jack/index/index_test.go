@@ -0,0 +1,85 @@
+package index
+
+import (
+	"jack/parser"
+	"jack/token"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	src := "// Signatures\nclass Point {\n  constructor Point new(int x, int y);\n  method int getX();\n  function void reset();\n}\n"
+	ix, err := Load("point.jacksig", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Failed to load signatures: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected Subroutine
+	}{
+		{name: "new", expected: Subroutine{Kind: "constructor", ReturnType: "Point", Params: []string{"int", "int"}}},
+		{name: "getX", expected: Subroutine{Kind: "method", ReturnType: "int"}},
+		{name: "reset", expected: Subroutine{Kind: "function", ReturnType: "void"}},
+	}
+	for _, tc := range tests {
+		sub, ok := ix.Lookup("Point", tc.name)
+		if !ok || !reflect.DeepEqual(sub, tc.expected) {
+			t.Errorf("Point.%s is %+v, expected %+v", tc.name, sub, tc.expected)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{src: "class Point { method int getX() { return 0; } }", expected: "f.jacksig:1:33: Syntax error at token {. Expected: ;"},
+		{src: "class Point { method int getX(); method int getX(); }", expected: "f.jacksig:1:34: subroutine Point.getX is already declared"},
+		{src: "class Point { field int x; }", expected: "f.jacksig:1:15: Syntax error at token field. Expected: }"},
+		{src: "class Point {", expected: "f.jacksig:1:13: Syntax error at token end of file. Expected: }"},
+	}
+
+	for _, tc := range tests {
+		_, err := Load("f.jacksig", strings.NewReader(tc.src))
+		if err == nil || err.(*token.Error).FileName+":"+err.(*token.Error).Pos.String()+": "+err.(*token.Error).Msg != tc.expected {
+			t.Errorf("Loading %q failed with %v, expected %q", tc.src, err, tc.expected)
+		}
+	}
+}
+
+func TestOS(t *testing.T) {
+	ix := OS()
+	for _, className := range []string{"Math", "String", "Array", "Output", "Screen", "Keyboard", "Memory", "Sys"} {
+		if !ix.HasClass(className) {
+			t.Errorf("OS index is missing class %s", className)
+		}
+	}
+	if sub, ok := ix.Lookup("String", "appendChar"); !ok || sub.Kind != "method" || sub.ReturnType != "String" {
+		t.Errorf("String.appendChar is %+v, expected a method returning String", sub)
+	}
+}
+
+func TestAddClass(t *testing.T) {
+	ix := OS()
+	class, errs := parser.Parse("Math.jack", "class Math {\n  function int abs(int x) { return x; }\n  function int abs() { return 0; }\n}")
+	if len(errs) > 0 {
+		t.Fatalf("Failed to parse Math: %v", errs)
+	}
+	duplicates := ix.AddClass(class)
+	if len(duplicates) != 1 || duplicates[0] != class.Subroutines[1] {
+		t.Errorf("Adding Math returned duplicates %v, expected the second abs", duplicates)
+	}
+	if _, ok := ix.Lookup("Math", "multiply"); ok {
+		t.Errorf("Math.multiply of the OS was not replaced")
+	}
+	if sub, ok := ix.Lookup("Math", "abs"); !ok || len(sub.Params) != 1 {
+		t.Errorf("Math.abs is %+v, expected the first declaration", sub)
+	}
+	if names := ix.Subroutines("Math"); !slices.Equal(names, []string{"abs"}) {
+		t.Errorf("Math has subroutines %v, expected [abs]", names)
+	}
+}
@@ -0,0 +1,146 @@
+package index
+
+import (
+	"fmt"
+	"io"
+	"jack/ast"
+	"jack/token"
+)
+
+// Load reads a signature file: Jack classes whose subroutine declarations end in ';' instead of a
+// body. Classes are added to the index in file order, so a later class replaces an earlier one.
+func Load(fileName string, r io.Reader) (*Index, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := New()
+	sr := &sigReader{fileName: fileName, src: string(src), lexer: token.NewLexer(fileName, string(src))}
+	sr.advance()
+	for !sr.atEnd {
+		class, err := sr.readClass()
+		if errs := sr.lexer.Errors(); err != nil && len(errs) > 0 {
+			// A malformed token is the likelier cause of the syntax error
+			return nil, errs[0]
+		}
+		if err != nil {
+			return nil, err
+		}
+		if duplicates := ix.AddClass(class); len(duplicates) > 0 {
+			sub := duplicates[0]
+			return nil, token.NewError(fileName, sr.src, sub.Pos, fmt.Sprintf("subroutine %s.%s is already declared", class.Name, sub.Name))
+		}
+	}
+	if errs := sr.lexer.Errors(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return ix, nil
+}
+
+type sigReader struct {
+	fileName string
+	src      string
+	lexer    *token.Lexer
+	curr     token.Token
+	atEnd    bool
+}
+
+// Moves to the next token. Past the end of the file the current token keeps the last position.
+func (sr *sigReader) advance() {
+	next, ok := sr.lexer.Next()
+	if !ok {
+		sr.atEnd = true
+		sr.curr = token.Token{Pos: sr.curr.Pos}
+		return
+	}
+	sr.curr = next
+}
+
+func (sr *sigReader) errorf(expected string) error {
+	found := sr.curr.Text
+	if sr.atEnd {
+		found = "end of file"
+	}
+	return token.NewError(sr.fileName, sr.src, sr.curr.Pos, fmt.Sprintf("Syntax error at token %s. Expected: %s", found, expected))
+}
+
+// Returns the text of the current token, which must be of the given kind, and advances past it
+func (sr *sigReader) expect(kind string, text ...string) (string, error) {
+	if sr.atEnd || sr.curr.Kind != kind || (len(text) > 0 && sr.curr.Text != text[0]) {
+		if len(text) > 0 {
+			return "", sr.errorf(text[0])
+		}
+		return "", sr.errorf(kind)
+	}
+	t := sr.curr.Text
+	sr.advance()
+	return t, nil
+}
+
+// Returns a built-in type or a class name
+func (sr *sigReader) readType() (string, error) {
+	if !sr.atEnd && sr.curr.Kind == token.Keyword {
+		switch sr.curr.Text {
+		case "int", "char", "boolean", "void":
+			return sr.expect(token.Keyword)
+		}
+	}
+	return sr.expect(token.Identifier)
+}
+
+// 'class' className '{' (('constructor' | 'function' | 'method') type subroutineName '(' parameterList ')' ';')* '}'
+func (sr *sigReader) readClass() (*ast.Class, error) {
+	class := &ast.Class{Node: ast.Node{Pos: sr.curr.Pos}, FileName: sr.fileName}
+	var err error
+	if _, err = sr.expect(token.Keyword, "class"); err != nil {
+		return nil, err
+	}
+	if class.Name, err = sr.expect(token.Identifier); err != nil {
+		return nil, err
+	}
+	if _, err = sr.expect(token.Symbol, "{"); err != nil {
+		return nil, err
+	}
+
+	for !sr.atEnd && (sr.curr.Text == "constructor" || sr.curr.Text == "function" || sr.curr.Text == "method") {
+		sub := &ast.Subroutine{Node: ast.Node{Pos: sr.curr.Pos}, Kind: sr.curr.Text}
+		sr.advance()
+		if sub.ReturnType, err = sr.readType(); err != nil {
+			return nil, err
+		}
+		if sub.Name, err = sr.expect(token.Identifier); err != nil {
+			return nil, err
+		}
+		if _, err = sr.expect(token.Symbol, "("); err != nil {
+			return nil, err
+		}
+		for !sr.atEnd && sr.curr.Text != ")" {
+			param := &ast.Param{Node: ast.Node{Pos: sr.curr.Pos}}
+			if param.Type, err = sr.readType(); err != nil {
+				return nil, err
+			}
+			if param.Name, err = sr.expect(token.Identifier); err != nil {
+				return nil, err
+			}
+			sub.Params = append(sub.Params, param)
+			if sr.curr.Text != ")" {
+				if _, err = sr.expect(token.Symbol, ","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if _, err = sr.expect(token.Symbol, ")"); err != nil {
+			return nil, err
+		}
+		if _, err = sr.expect(token.Symbol, ";"); err != nil {
+			return nil, err
+		}
+		class.Subroutines = append(class.Subroutines, sub)
+	}
+
+	if _, err = sr.expect(token.Symbol, "}"); err != nil {
+		return nil, err
+	}
+	return class, nil
+}
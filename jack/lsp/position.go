@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"jack/token"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Token positions count runes from 1 while LSP positions count UTF-16 code units from 0, so
+// converting between them takes the text of the line.
+
+func lineText(src string, line int) string {
+	for range line {
+		_, rest, ok := strings.Cut(src, "\n")
+		if !ok {
+			return ""
+		}
+		src = rest
+	}
+	text, _, _ := strings.Cut(src, "\n")
+	return text
+}
+
+func toPosition(src string, pos token.Pos) position {
+	character := 0
+	for i, r := range []rune(lineText(src, pos.Line-1)) {
+		if i >= pos.Column-1 {
+			break
+		}
+		character += utf16.RuneLen(r)
+	}
+	return position{Line: pos.Line - 1, Character: character}
+}
+
+func fromPosition(src string, p position) token.Pos {
+	column, units := 1, 0
+	for _, r := range lineText(src, p.Line) {
+		if units >= p.Character {
+			break
+		}
+		units += utf16.RuneLen(r)
+		column++
+	}
+	return token.Pos{Line: p.Line + 1, Column: column}
+}
+
+// Returns the range of a name starting at pos
+func nameRange(src string, pos token.Pos, name string) lspRange {
+	start := toPosition(src, pos)
+	end := start
+	for _, r := range name {
+		end.Character += utf16.RuneLen(r)
+	}
+	return lspRange{Start: start, End: end}
+}
+
+// Returns whether pos falls on a name starting at start
+func onName(pos token.Pos, start token.Pos, name string) bool {
+	return pos.Line == start.Line && pos.Column >= start.Column && pos.Column < start.Column+utf8.RuneCountInString(name)
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,318 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"jack/ast"
+	"jack/check"
+	"jack/index"
+	"jack/parser"
+	"jack/symbols"
+	"jack/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A declared class, subroutine or variable. The OS classes and their subroutines are declared in
+// no file.
+type symbol struct {
+	name     string
+	fileName string
+	pos      token.Pos
+	// The type of a variable
+	dataType string
+	// Describes the symbol on hover
+	detail string
+}
+
+// A name in the source along with the symbol it refers to
+type occurrence struct {
+	name string
+	pos  token.Pos
+	sym  *symbol
+}
+
+type file struct {
+	path        string
+	src         string
+	class       *ast.Class
+	errs        []error
+	occurrences []occurrence
+}
+
+// program is the analysis of the jack files of a directory
+type program struct {
+	files []*file
+	ix    *index.Index
+	// Symbols by class name and by className.subroutineName
+	classes     map[string]*symbol
+	subroutines map[string]*symbol
+}
+
+// Parses and checks the jack files of dir, reading the files open in the editor from docs rather
+// than from disk. Classes are checked even when some files have syntax errors, but only the files
+// that parse report semantic errors, since the trees of the others are incomplete.
+func analyze(dir string, docs map[string]string) *program {
+	paths := []string{}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jack") {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	for path := range docs {
+		if filepath.Dir(path) == dir && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	prog := &program{ix: index.OS(), classes: make(map[string]*symbol), subroutines: make(map[string]*symbol)}
+	classes := []*ast.Class{}
+	byPath := make(map[string]*file)
+	for _, path := range paths {
+		f := &file{path: path}
+		src, ok := docs[path]
+		if !ok {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				f.errs = []error{err}
+				prog.files = append(prog.files, f)
+				continue
+			}
+			src = string(b)
+		}
+		f.src = src
+		f.class, f.errs = parser.Parse(path, src)
+		classes = append(classes, f.class)
+		prog.files = append(prog.files, f)
+		byPath[path] = f
+	}
+
+	// Files with syntax errors, whose trees are incomplete
+	broken := make(map[string]bool)
+	for _, f := range prog.files {
+		broken[f.path] = len(f.errs) > 0
+	}
+	for _, err := range check.Check(prog.ix, classes) {
+		var tokenErr *token.Error
+		if errors.As(err, &tokenErr) {
+			if f := byPath[tokenErr.FileName]; f != nil && !broken[f.path] {
+				f.errs = append(f.errs, err)
+			}
+		}
+	}
+	prog.resolve()
+	return prog
+}
+
+// Returns the file at path
+func (prog *program) file(path string) *file {
+	for _, f := range prog.files {
+		if f.path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// Returns the symbol of a class of the program or the OS, or nil for an unknown class
+func (prog *program) classSymbol(name string) *symbol {
+	if sym, ok := prog.classes[name]; ok {
+		return sym
+	}
+	if !prog.ix.HasClass(name) {
+		return nil
+	}
+	sym := &symbol{name: name, detail: "class " + name}
+	prog.classes[name] = sym
+	return sym
+}
+
+// Returns the symbol of className.name, or nil when there is no such subroutine
+func (prog *program) subroutineSymbol(className string, name string) *symbol {
+	if sym, ok := prog.subroutines[className+"."+name]; ok {
+		return sym
+	}
+	sig, ok := prog.ix.Lookup(className, name)
+	if !ok {
+		return nil
+	}
+	sym := &symbol{name: name, detail: fmt.Sprintf("%s %s %s.%s(%s)", sig.Kind, sig.ReturnType, className, name, strings.Join(sig.Params, ", "))}
+	prog.subroutines[className+"."+name] = sym
+	return sym
+}
+
+// Declares the classes and subroutines of the program, then records the symbol of every name in
+// each file
+func (prog *program) resolve() {
+	for _, f := range prog.files {
+		class := f.class
+		if class == nil || class.Name == "" {
+			continue
+		}
+		if _, ok := prog.classes[class.Name]; !ok {
+			prog.classes[class.Name] = &symbol{name: class.Name, fileName: f.path, pos: class.NamePos, detail: "class " + class.Name}
+		}
+		for _, sub := range class.Subroutines {
+			key := class.Name + "." + sub.Name
+			if _, ok := prog.subroutines[key]; ok {
+				continue
+			}
+			prog.subroutines[key] = &symbol{name: sub.Name, fileName: f.path, pos: sub.NamePos, detail: subroutineDetail(class.Name, sub)}
+		}
+	}
+
+	for _, f := range prog.files {
+		if f.class != nil && f.class.Name != "" {
+			w := &walker{prog: prog, f: f, className: f.class.Name}
+			w.walkClass(f.class)
+		}
+	}
+}
+
+// Returns the declaration of a subroutine without its body
+func subroutineDetail(className string, sub *ast.Subroutine) string {
+	params := []string{}
+	for _, param := range sub.Params {
+		params = append(params, param.Type+" "+param.Name)
+	}
+	return fmt.Sprintf("%s %s %s.%s(%s)", sub.Kind, sub.ReturnType, className, sub.Name, strings.Join(params, ", "))
+}
+
+// Returns the symbols of the variables of a symbol table, which are declared in fileName
+func variables(fileName string, st *symbols.Table) map[string]*symbol {
+	vars := make(map[string]*symbol)
+	for _, e := range st.Entries() {
+		kind := e.Kind
+		if kind == symbols.Field {
+			kind = "field"
+		}
+		detail := fmt.Sprintf("%s %s %s (%s %d)", kind, e.DataType, e.Name, e.Kind, e.Index)
+		vars[e.Name] = &symbol{name: e.Name, fileName: fileName, pos: e.Pos, dataType: e.DataType, detail: detail}
+	}
+	return vars
+}
+
+// Records the symbols of the names of a class
+type walker struct {
+	prog      *program
+	f         *file
+	className string
+	classVars map[string]*symbol
+	subVars   map[string]*symbol
+}
+
+func (w *walker) add(name string, pos token.Pos, sym *symbol) {
+	if sym != nil {
+		w.f.occurrences = append(w.f.occurrences, occurrence{name: name, pos: pos, sym: sym})
+	}
+}
+
+// Records a type, which refers to a class unless it is a primitive type
+func (w *walker) addType(t string, pos token.Pos) {
+	w.add(t, pos, w.prog.classSymbol(t))
+}
+
+// Looks a variable up in the subroutine and then the class scope, returning nil when it is
+// undeclared
+func (w *walker) lookupVar(name string) *symbol {
+	if sym, ok := w.subVars[name]; ok {
+		return sym
+	}
+	return w.classVars[name]
+}
+
+func (w *walker) walkClass(class *ast.Class) {
+	w.add(class.Name, class.NamePos, w.prog.classes[class.Name])
+	w.classVars = variables(w.f.path, symbols.ClassTable(class))
+	for _, dec := range class.VarDecs {
+		w.addType(dec.Type, dec.TypePos)
+		for i, name := range dec.Names {
+			w.add(name, dec.NamePos[i], w.classVars[name])
+		}
+	}
+
+	for _, sub := range class.Subroutines {
+		w.subVars = variables(w.f.path, symbols.SubroutineTable(class.Name, sub))
+		// this is a keyword, not a name that can be referred to
+		delete(w.subVars, "this")
+		w.addType(sub.ReturnType, sub.TypePos)
+		w.add(sub.Name, sub.NamePos, w.prog.subroutineSymbol(class.Name, sub.Name))
+		for _, param := range sub.Params {
+			w.addType(param.Type, param.Pos)
+			w.add(param.Name, param.NamePos, w.subVars[param.Name])
+		}
+		for _, dec := range sub.VarDecs {
+			w.addType(dec.Type, dec.TypePos)
+			for i, name := range dec.Names {
+				w.add(name, dec.NamePos[i], w.subVars[name])
+			}
+		}
+		w.walkStatements(sub.Statements)
+	}
+}
+
+func (w *walker) walkStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			w.add(s.Name, s.NamePos, w.lookupVar(s.Name))
+			w.walkExpression(s.Index)
+			w.walkExpression(s.Value)
+		case *ast.IfStatement:
+			w.walkExpression(s.Cond)
+			w.walkStatements(s.Then)
+			w.walkStatements(s.Else)
+		case *ast.WhileStatement:
+			w.walkExpression(s.Cond)
+			w.walkStatements(s.Body)
+		case *ast.DoStatement:
+			w.walkTerm(s.Call)
+		case *ast.ReturnStatement:
+			w.walkExpression(s.Value)
+		}
+	}
+}
+
+func (w *walker) walkExpression(expr *ast.Expression) {
+	if expr == nil {
+		return
+	}
+	w.walkTerm(expr.Term)
+	for _, op := range expr.Ops {
+		w.walkTerm(op.Term)
+	}
+}
+
+func (w *walker) walkTerm(term ast.Term) {
+	switch t := term.(type) {
+	case *ast.VarRef:
+		w.add(t.Name, t.Pos, w.lookupVar(t.Name))
+	case *ast.ArrayAccess:
+		w.add(t.Name, t.Pos, w.lookupVar(t.Name))
+		w.walkExpression(t.Index)
+	case *ast.ParenExpr:
+		w.walkExpression(t.Expr)
+	case *ast.UnaryOp:
+		w.walkTerm(t.Term)
+	case *ast.SubroutineCall:
+		className := w.className
+		if t.Receiver != "" {
+			if v := w.lookupVar(t.Receiver); v != nil {
+				w.add(t.Receiver, t.Pos, v)
+				className = v.dataType
+			} else {
+				w.add(t.Receiver, t.Pos, w.prog.classSymbol(t.Receiver))
+				className = t.Receiver
+			}
+		}
+		w.add(t.Name, t.NamePos, w.prog.subroutineSymbol(className, t.Name))
+		for _, arg := range t.Args {
+			w.walkExpression(arg)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// Package lsp is a Language Server Protocol server for Jack. It keeps the jack files of every
+// directory with an open document parsed and checked as they are edited, and answers navigation
+// requests from the names it resolves in them.
+package lsp
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"jack/ast"
+	"jack/symbols"
+	"jack/token"
+	"path/filepath"
+	"unicode"
+)
+
+type server struct {
+	w io.Writer
+	// The text of the documents open in the editor by path
+	docs map[string]string
+	// The analysis of each directory with an open document
+	programs map[string]*program
+}
+
+// Serve answers the messages read from r, writing responses and notifications to w, until the exit
+// notification or the end of r
+func Serve(r io.Reader, w io.Writer) error {
+	s := &server{w: w, docs: make(map[string]string), programs: make(map[string]*program)}
+	br := bufio.NewReader(r)
+	for {
+		content, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			if err := writeMessage(w, errorResponse{JSONRPC: "2.0", Error: responseError{Code: parseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(msg message) error {
+	if msg.ID == nil {
+		return s.notify(msg.Method, msg.Params)
+	}
+	result, err := s.request(msg.Method, msg.Params)
+	if err != nil {
+		return writeMessage(s.w, errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: *err})
+	}
+	return writeMessage(s.w, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func decode(params json.RawMessage, v any) *responseError {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// Handles a notification. Notifications with invalid params and unknown notifications are ignored,
+// since there is no way to answer them.
+func (s *server) notify(method string, params json.RawMessage) error {
+	switch method {
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if decode(params, &p) != nil {
+			return nil
+		}
+		path := uriToPath(p.TextDocument.URI)
+		s.docs[path] = p.TextDocument.Text
+		return s.update(path)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if decode(params, &p) != nil || len(p.ContentChanges) == 0 {
+			return nil
+		}
+		// The server asks for full syncs, so the last change holds the whole text
+		path := uriToPath(p.TextDocument.URI)
+		s.docs[path] = p.ContentChanges[len(p.ContentChanges)-1].Text
+		return s.update(path)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if decode(params, &p) != nil {
+			return nil
+		}
+		path := uriToPath(p.TextDocument.URI)
+		delete(s.docs, path)
+		return s.update(path)
+	}
+	return nil
+}
+
+func (s *server) request(method string, params json.RawMessage) (any, *responseError) {
+	switch method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1, // full
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"completionProvider":     map[string]any{"triggerCharacters": []string{"."}},
+				"documentSymbolProvider": true,
+				"referencesProvider":     true,
+			},
+			"serverInfo": map[string]any{"name": "jacklsp"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/definition":
+		return s.withPosition(params, s.definition)
+	case "textDocument/hover":
+		return s.withPosition(params, s.hover)
+	case "textDocument/references":
+		return s.withPosition(params, s.references)
+	case "textDocument/completion":
+		return s.withPosition(params, s.completion)
+	case "textDocument/documentSymbol":
+		var p textDocumentPositionParams
+		if err := decode(params, &p); err != nil {
+			return nil, err
+		}
+		_, f := s.document(p.TextDocument.URI)
+		if f == nil {
+			return []documentSymbol{}, nil
+		}
+		return documentSymbols(f), nil
+	}
+	return nil, &responseError{Code: methodNotFound, Message: "method not found: " + method}
+}
+
+// Analyzes the program of the document at path again and publishes the diagnostics of every file
+// in it
+func (s *server) update(path string) error {
+	dir := filepath.Dir(path)
+	prog := analyze(dir, s.docs)
+	s.programs[dir] = prog
+	for _, f := range prog.files {
+		diagnostics := []diagnostic{}
+		for _, err := range f.errs {
+			d := diagnostic{Severity: errorSeverity, Source: "jack", Message: err.Error()}
+			var tokenErr *token.Error
+			if errors.As(err, &tokenErr) {
+				d.Range = errorRange(f.src, tokenErr.Pos)
+				d.Message = tokenErr.Msg
+			}
+			diagnostics = append(diagnostics, d)
+		}
+		params := publishDiagnosticsParams{URI: pathToURI(f.path), Diagnostics: diagnostics}
+		if err := writeMessage(s.w, notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics", Params: params}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the range of the word or character an error points at
+func errorRange(src string, pos token.Pos) lspRange {
+	line := []rune(lineText(src, pos.Line-1))
+	end := max(min(pos.Column, len(line)+1), 1)
+	for end <= len(line) && isNameRune(line[end-1]) {
+		end += 1
+	}
+	if end == pos.Column {
+		end += 1
+	}
+	return lspRange{Start: toPosition(src, pos), End: toPosition(src, token.Pos{Line: pos.Line, Column: end})}
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Returns the program and file of a document, analyzing its directory if it is not open
+func (s *server) document(uri string) (*program, *file) {
+	path := uriToPath(uri)
+	dir := filepath.Dir(path)
+	prog, ok := s.programs[dir]
+	if !ok {
+		prog = analyze(dir, s.docs)
+		s.programs[dir] = prog
+	}
+	return prog, prog.file(path)
+}
+
+// Decodes the params of a request at a position in a document and answers it with handle
+func (s *server) withPosition(params json.RawMessage, handle func(*program, *file, token.Pos, textDocumentPositionParams) any) (any, *responseError) {
+	var p textDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	prog, f := s.document(p.TextDocument.URI)
+	if f == nil {
+		return handle(prog, nil, token.Pos{}, p), nil
+	}
+	return handle(prog, f, fromPosition(f.src, p.Position), p), nil
+}
+
+// Returns the name at pos, or nil
+func occurrenceAt(f *file, pos token.Pos) *occurrence {
+	if f == nil {
+		return nil
+	}
+	for i, o := range f.occurrences {
+		if onName(pos, o.pos, o.name) {
+			return &f.occurrences[i]
+		}
+	}
+	return nil
+}
+
+// Returns where sym is declared, or nil for the OS classes and subroutines
+func (prog *program) declaration(sym *symbol) any {
+	f := prog.file(sym.fileName)
+	if f == nil {
+		return nil
+	}
+	return location{URI: pathToURI(f.path), Range: nameRange(f.src, sym.pos, sym.name)}
+}
+
+func (s *server) definition(prog *program, f *file, pos token.Pos, _ textDocumentPositionParams) any {
+	o := occurrenceAt(f, pos)
+	if o == nil {
+		return nil
+	}
+	return prog.declaration(o.sym)
+}
+
+func (s *server) hover(prog *program, f *file, pos token.Pos, _ textDocumentPositionParams) any {
+	o := occurrenceAt(f, pos)
+	if o == nil {
+		return nil
+	}
+	return hover{
+		Contents: markupContent{Kind: "markdown", Value: "```jack\n" + o.sym.detail + "\n```"},
+		Range:    nameRange(f.src, o.pos, o.name),
+	}
+}
+
+func (s *server) references(prog *program, f *file, pos token.Pos, p textDocumentPositionParams) any {
+	locations := []location{}
+	o := occurrenceAt(f, pos)
+	if o == nil {
+		return locations
+	}
+	for _, f := range prog.files {
+		for _, ref := range f.occurrences {
+			if ref.sym != o.sym {
+				continue
+			}
+			if !p.Context.IncludeDeclaration && f.path == ref.sym.fileName && ref.pos == ref.sym.pos {
+				continue
+			}
+			locations = append(locations, location{URI: pathToURI(f.path), Range: nameRange(f.src, ref.pos, ref.name)})
+		}
+	}
+	return locations
+}
+
+// Completes the subroutine name after a '.'. After a variable the methods of its class are offered,
+// after a class name its functions and constructors.
+func (s *server) completion(prog *program, f *file, pos token.Pos, _ textDocumentPositionParams) any {
+	items := []completionItem{}
+	if f == nil {
+		return items
+	}
+	line := []rune(lineText(f.src, pos.Line-1))
+	line = line[:min(pos.Column-1, len(line))]
+	// Skip the part of the name typed so far
+	dot := len(line)
+	for dot > 0 && isNameRune(line[dot-1]) {
+		dot -= 1
+	}
+	if dot == 0 || line[dot-1] != '.' {
+		return items
+	}
+	start := dot - 1
+	for start > 0 && isNameRune(line[start-1]) {
+		start -= 1
+	}
+	receiver := string(line[start : dot-1])
+	if receiver == "" {
+		return items
+	}
+
+	className, onObject := receiver, false
+	if e, ok := lookupVar(f.class, pos, receiver); ok {
+		className, onObject = e.DataType, true
+	}
+	for _, name := range prog.ix.Subroutines(className) {
+		sig, _ := prog.ix.Lookup(className, name)
+		if (sig.Kind == "method") != onObject {
+			continue
+		}
+		kind := functionItem
+		switch sig.Kind {
+		case "method":
+			kind = methodItem
+		case "constructor":
+			kind = constructorItem
+		}
+		items = append(items, completionItem{Label: name, Kind: kind, Detail: prog.subroutineSymbol(className, name).detail})
+	}
+	return items
+}
+
+// Looks a variable up in the scope of the subroutine of class that pos is in
+func lookupVar(class *ast.Class, pos token.Pos, name string) (symbols.Entry, bool) {
+	if class == nil {
+		return symbols.Entry{}, false
+	}
+	var enclosing *ast.Subroutine
+	for _, sub := range class.Subroutines {
+		if comparePos(sub.Pos, pos) <= 0 {
+			enclosing = sub
+		}
+	}
+	if enclosing != nil {
+		if e, ok := symbols.SubroutineTable(class.Name, enclosing).Lookup(name); ok {
+			return e, true
+		}
+	}
+	return symbols.ClassTable(class).Lookup(name)
+}
+
+func comparePos(a token.Pos, b token.Pos) int {
+	return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+}
+
+// Returns the outline of a file: its class with the class variables and subroutines as children.
+// A member spans up to the next member, as the tree does not record where declarations end.
+func documentSymbols(f *file) []documentSymbol {
+	class := f.class
+	if class == nil || class.Name == "" {
+		return []documentSymbol{}
+	}
+	lines := 1
+	for _, r := range f.src {
+		if r == '\n' {
+			lines += 1
+		}
+	}
+	end := toPosition(f.src, token.Pos{Line: lines, Column: len([]rune(lineText(f.src, lines-1))) + 1})
+
+	starts := []token.Pos{}
+	for _, dec := range class.VarDecs {
+		starts = append(starts, dec.Pos)
+	}
+	for _, sub := range class.Subroutines {
+		starts = append(starts, sub.Pos)
+	}
+	span := func(i int) lspRange {
+		r := lspRange{Start: toPosition(f.src, starts[i]), End: end}
+		if i+1 < len(starts) {
+			r.End = toPosition(f.src, starts[i+1])
+		}
+		return r
+	}
+
+	children := []documentSymbol{}
+	for i, dec := range class.VarDecs {
+		kind := variableSymbol
+		if dec.Kind == "field" {
+			kind = fieldSymbol
+		}
+		for j, name := range dec.Names {
+			children = append(children, documentSymbol{
+				Name:           name,
+				Detail:         dec.Kind + " " + dec.Type,
+				Kind:           kind,
+				Range:          span(i),
+				SelectionRange: nameRange(f.src, dec.NamePos[j], name),
+			})
+		}
+	}
+	for i, sub := range class.Subroutines {
+		kind := functionSymbol
+		switch sub.Kind {
+		case "method":
+			kind = methodSymbol
+		case "constructor":
+			kind = constructorSymbol
+		}
+		children = append(children, documentSymbol{
+			Name:           sub.Name,
+			Detail:         subroutineDetail(class.Name, sub),
+			Kind:           kind,
+			Range:          span(len(class.VarDecs) + i),
+			SelectionRange: nameRange(f.src, sub.NamePos, sub.Name),
+		})
+	}
+	return []documentSymbol{{
+		Name:           class.Name,
+		Kind:           classSymbol,
+		Range:          lspRange{Start: toPosition(f.src, class.Pos), End: end},
+		SelectionRange: nameRange(f.src, class.NamePos, class.Name),
+		Children:       children,
+	}}
+}
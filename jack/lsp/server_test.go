@@ -0,0 +1,387 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"jack/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const pointSrc = `class Point {
+  field int x, y;
+  static int count;
+
+  constructor Point new(int ax, int ay) {
+    let x = ax;
+    let y = ay;
+    let count = count + 1;
+    return this;
+  }
+
+  method int getX() { return x; }
+
+  function int total() { return count; }
+}
+`
+
+const mainSrc = `class Main {
+  function void main() {
+    var Point p;
+    let p = Point.new(1, 2);
+    do Output.printInt(p.getX());
+    return;
+  }
+}
+`
+
+// The outcome of a scripted session: the result of each request by id and the last diagnostics
+// published for each file by name
+type session struct {
+	results     map[int]json.RawMessage
+	diagnostics map[string][]diagnostic
+}
+
+// Writes Point.jack to a new directory, then runs the server on the messages of script, which are
+// given Main.jack's uri as the first argument
+func runSession(t *testing.T, script func(mainURI string) []any) session {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Point.jack"), []byte(pointSrc), 0644); err != nil {
+		t.Fatalf("Failed to write Point.jack: %v", err)
+	}
+
+	var in, out bytes.Buffer
+	for _, msg := range script(pathToURI(filepath.Join(dir, "Main.jack"))) {
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatalf("Failed to write message: %v", err)
+		}
+	}
+	if err := Serve(&in, &out); err != nil {
+		t.Fatalf("Failed to serve: %v", err)
+	}
+
+	s := session{results: make(map[int]json.RawMessage), diagnostics: make(map[string][]diagnostic)}
+	r := bufio.NewReader(&out)
+	for {
+		content, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var msg struct {
+			ID     *int
+			Method string
+			Params publishDiagnosticsParams
+			Result json.RawMessage
+		}
+		if err := json.Unmarshal(content, &msg); err != nil {
+			t.Fatalf("Failed to decode %s: %v", content, err)
+		}
+		if msg.ID != nil {
+			s.results[*msg.ID] = msg.Result
+		} else if msg.Method == "textDocument/publishDiagnostics" {
+			s.diagnostics[filepath.Base(uriToPath(msg.Params.URI))] = msg.Params.Diagnostics
+		}
+	}
+	return s
+}
+
+func request(id int, method string, params any) any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notify(method string, params any) any {
+	return map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func open(uri string, text string) any {
+	return notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "jack", "version": 1, "text": text}})
+}
+
+func at(uri string, line int, character int) map[string]any {
+	return map[string]any{"textDocument": map[string]any{"uri": uri}, "position": position{Line: line, Character: character}}
+}
+
+// Decodes the result of request id into v
+func (s session) result(t *testing.T, id int, v any) {
+	if err := json.Unmarshal(s.results[id], v); err != nil {
+		t.Fatalf("Failed to decode result %d %s: %v", id, s.results[id], err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected []diagnostic
+	}{
+		{mainSrc, []diagnostic{}},
+		{
+			strings.Replace(mainSrc, "let p", "let q", 1),
+			[]diagnostic{{Range: lspRange{Start: position{Line: 3, Character: 4}, End: position{Line: 3, Character: 7}}, Severity: errorSeverity, Source: "jack", Message: "undeclared identifier q"}},
+		},
+		{
+			strings.Replace(mainSrc, "return;", "return", 1),
+			[]diagnostic{{Range: lspRange{Start: position{Line: 6, Character: 2}, End: position{Line: 6, Character: 3}}, Severity: errorSeverity, Source: "jack", Message: "Syntax error at token }. Expected: ;"}},
+		},
+	}
+
+	for _, test := range tests {
+		s := runSession(t, func(mainURI string) []any {
+			// The document is opened with a different text so publishing the final one takes a change
+			return []any{
+				request(1, "initialize", map[string]any{}),
+				notify("initialized", map[string]any{}),
+				open(mainURI, "class Main {}"),
+				notify("textDocument/didChange", map[string]any{
+					"textDocument":   map[string]any{"uri": mainURI, "version": 2},
+					"contentChanges": []any{map[string]any{"text": test.src}},
+				}),
+			}
+		})
+		if got := s.diagnostics["Main.jack"]; !equalJSON(got, test.expected) {
+			t.Errorf("Main.jack has diagnostics %+v, expected %+v", got, test.expected)
+		}
+		if got := s.diagnostics["Point.jack"]; got == nil || len(got) != 0 {
+			t.Errorf("Point.jack has diagnostics %+v, expected none", got)
+		}
+	}
+}
+
+// A document without tokens, as a new file is when it is opened, is reported at its start
+func TestEmptyDocument(t *testing.T) {
+	tests := []struct {
+		src string
+		end int
+	}{
+		{src: "", end: 0},
+		{src: "// Th", end: 1},
+	}
+
+	for _, test := range tests {
+		s := runSession(t, func(mainURI string) []any {
+			return []any{
+				request(1, "initialize", map[string]any{}),
+				notify("initialized", map[string]any{}),
+				open(mainURI, test.src),
+			}
+		})
+		expected := []diagnostic{{Range: lspRange{Start: position{Line: 0, Character: 0}, End: position{Line: 0, Character: test.end}}, Severity: errorSeverity, Source: "jack", Message: "Syntax error at token end of file. Expected: class"}}
+		if got := s.diagnostics["Main.jack"]; !equalJSON(got, expected) {
+			t.Errorf("Main.jack opened as %q has diagnostics %+v, expected %+v", test.src, got, expected)
+		}
+	}
+}
+
+func TestDefinitionAndHover(t *testing.T) {
+	tests := []struct {
+		file      string
+		line      int
+		character int
+		// The file and line of the declaration, "" for none
+		declFile string
+		declLine int
+		hover    string
+	}{
+		{"Main.jack", 3, 12, "Point.jack", 0, "class Point"},
+		{"Main.jack", 3, 18, "Point.jack", 4, "constructor Point Point.new(int ax, int ay)"},
+		{"Main.jack", 4, 25, "Point.jack", 11, "method int Point.getX()"},
+		{"Main.jack", 4, 23, "Main.jack", 2, "local Point p (local 0)"},
+		{"Main.jack", 4, 10, "", 0, "class Output"},
+		{"Main.jack", 4, 17, "", 0, "function void Output.printInt(int)"},
+		{"Point.jack", 5, 8, "Point.jack", 1, "field int x (this 0)"},
+		{"Point.jack", 6, 13, "Point.jack", 4, "argument int ay (argument 1)"},
+		{"Point.jack", 7, 16, "Point.jack", 2, "static int count (static 0)"},
+	}
+
+	s := runSession(t, func(mainURI string) []any {
+		pointURI := strings.Replace(mainURI, "Main.jack", "Point.jack", 1)
+		script := []any{open(mainURI, mainSrc)}
+		for i, test := range tests {
+			uri := mainURI
+			if test.file == "Point.jack" {
+				uri = pointURI
+			}
+			script = append(script, request(2*i, "textDocument/definition", at(uri, test.line, test.character)))
+			script = append(script, request(2*i+1, "textDocument/hover", at(uri, test.line, test.character)))
+		}
+		return script
+	})
+
+	for i, test := range tests {
+		var loc *location
+		s.result(t, 2*i, &loc)
+		switch {
+		case test.declFile == "" && loc != nil:
+			t.Errorf("Definition at %s:%d:%d is %+v, expected none", test.file, test.line, test.character, loc)
+		case test.declFile != "" && (loc == nil || filepath.Base(uriToPath(loc.URI)) != test.declFile || loc.Range.Start.Line != test.declLine):
+			t.Errorf("Definition at %s:%d:%d is %+v, expected %s line %d", test.file, test.line, test.character, loc, test.declFile, test.declLine)
+		}
+
+		var h hover
+		s.result(t, 2*i+1, &h)
+		if expected := "```jack\n" + test.hover + "\n```"; h.Contents.Value != expected {
+			t.Errorf("Hover at %s:%d:%d is %q, expected %q", test.file, test.line, test.character, h.Contents.Value, expected)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	src := strings.Replace(mainSrc, "    return;", "    do p.\n    do Point.g\n    return;", 1)
+	tests := []struct {
+		line      int
+		character int
+		expected  []completionItem
+	}{
+		{5, 9, []completionItem{{Label: "getX", Kind: methodItem, Detail: "method int Point.getX()"}}},
+		{6, 13, []completionItem{
+			{Label: "new", Kind: constructorItem, Detail: "constructor Point Point.new(int ax, int ay)"},
+			{Label: "total", Kind: functionItem, Detail: "function int Point.total()"},
+		}},
+		{3, 10, []completionItem{}},
+	}
+
+	s := runSession(t, func(mainURI string) []any {
+		script := []any{open(mainURI, src)}
+		for i, test := range tests {
+			script = append(script, request(i, "textDocument/completion", at(mainURI, test.line, test.character)))
+		}
+		return script
+	})
+	for i, test := range tests {
+		var items []completionItem
+		s.result(t, i, &items)
+		if !equalJSON(items, test.expected) {
+			t.Errorf("Completion at %d:%d is %+v, expected %+v", test.line, test.character, items, test.expected)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	s := runSession(t, func(mainURI string) []any {
+		pointURI := strings.Replace(mainURI, "Main.jack", "Point.jack", 1)
+		return []any{request(1, "textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": pointURI}})}
+	})
+
+	var outline []documentSymbol
+	s.result(t, 1, &outline)
+	if len(outline) != 1 || outline[0].Name != "Point" || outline[0].Kind != classSymbol {
+		t.Fatalf("Outline of Point.jack is %+v, expected class Point", outline)
+	}
+	expected := []struct {
+		name string
+		kind int
+	}{{"x", fieldSymbol}, {"y", fieldSymbol}, {"count", variableSymbol}, {"new", constructorSymbol}, {"getX", methodSymbol}, {"total", functionSymbol}}
+	children := outline[0].Children
+	if len(children) != len(expected) {
+		t.Fatalf("Point has %d members, expected %d", len(children), len(expected))
+	}
+	for i, child := range children {
+		if child.Name != expected[i].name || child.Kind != expected[i].kind {
+			t.Errorf("Member %d of Point is %s of kind %d, expected %s of kind %d", i, child.Name, child.Kind, expected[i].name, expected[i].kind)
+		}
+	}
+	if r := children[4].Range; r.Start.Line != 11 || r.End.Line != 13 {
+		t.Errorf("getX spans %+v, expected lines 11 to 13", r)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		file               string
+		line               int
+		character          int
+		includeDeclaration bool
+		expected           []string
+	}{
+		{"Point.jack", 2, 13, true, []string{"Point.jack:2:13", "Point.jack:7:8", "Point.jack:7:16", "Point.jack:13:32"}},
+		{"Point.jack", 2, 13, false, []string{"Point.jack:7:8", "Point.jack:7:16", "Point.jack:13:32"}},
+		{"Main.jack", 3, 12, true, []string{"Main.jack:2:8", "Main.jack:3:12", "Point.jack:0:6", "Point.jack:4:14"}},
+		{"Main.jack", 5, 4, true, []string{}},
+	}
+
+	s := runSession(t, func(mainURI string) []any {
+		pointURI := strings.Replace(mainURI, "Main.jack", "Point.jack", 1)
+		script := []any{open(mainURI, mainSrc)}
+		for i, test := range tests {
+			uri := mainURI
+			if test.file == "Point.jack" {
+				uri = pointURI
+			}
+			params := at(uri, test.line, test.character)
+			params["context"] = map[string]any{"includeDeclaration": test.includeDeclaration}
+			script = append(script, request(i, "textDocument/references", params))
+		}
+		return script
+	})
+
+	for i, test := range tests {
+		var locations []location
+		s.result(t, i, &locations)
+		got := []string{}
+		for _, loc := range locations {
+			got = append(got, fmt.Sprintf("%s:%d:%d", filepath.Base(uriToPath(loc.URI)), loc.Range.Start.Line, loc.Range.Start.Character))
+		}
+		if !slices.Equal(got, test.expected) {
+			t.Errorf("References at %s:%d:%d are %v, expected %v", test.file, test.line, test.character, got, test.expected)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	src := "class A {\n  // é𝄞\n  field int x; // 𝄞 x\n}\n"
+	tests := []struct {
+		pos      token.Pos
+		expected position
+	}{
+		{token.Pos{Line: 1, Column: 1}, position{Line: 0, Character: 0}},
+		{token.Pos{Line: 2, Column: 6}, position{Line: 1, Character: 5}},
+		{token.Pos{Line: 2, Column: 8}, position{Line: 1, Character: 8}},
+		{token.Pos{Line: 3, Column: 20}, position{Line: 2, Character: 20}},
+	}
+	for _, test := range tests {
+		if got := toPosition(src, test.pos); got != test.expected {
+			t.Errorf("Position of %s is %+v, expected %+v", test.pos, got, test.expected)
+		}
+		if got := fromPosition(src, test.expected); got != test.pos {
+			t.Errorf("Position at %+v is %s, expected %s", test.expected, got, test.pos)
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	var in, out bytes.Buffer
+	in.WriteString("Content-Length: 5\r\n\r\n{nope")
+	writeMessage(&in, request(1, "textDocument/rename", map[string]any{}))
+	writeMessage(&in, notify("exit", nil))
+	writeMessage(&in, request(2, "shutdown", nil))
+	if err := Serve(&in, &out); err != nil {
+		t.Fatalf("Failed to serve: %v", err)
+	}
+
+	r := bufio.NewReader(&out)
+	for _, code := range []int{parseError, methodNotFound} {
+		content, err := readMessage(r)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		var msg errorResponse
+		if err := json.Unmarshal(content, &msg); err != nil || msg.Error.Code != code {
+			t.Errorf("Response is %s, expected error %d", content, code)
+		}
+	}
+	if _, err := readMessage(r); err != io.EOF {
+		t.Errorf("Server answered a request after exit")
+	}
+}
+
+// Compares values by their JSON encoding, so nil and empty slices differ like they do on the wire
+func equalJSON(a any, b any) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
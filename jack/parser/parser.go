@@ -0,0 +1,517 @@
+// Package parser builds the syntax tree of a Jack class by recursive descent.
+package parser
+
+import (
+	"cmp"
+	"fmt"
+	"jack/ast"
+	"jack/token"
+	"slices"
+)
+
+var statementKeywords = []string{"let", "if", "while", "do", "return"}
+var memberKeywords = []string{"static", "field", "constructor", "function", "method"}
+
+// Words the extended dialect reserves. They are identifiers in standard Jack, so the lexer leaves
+// them to the parser.
+var extendedKeywords = []string{"for", "break", "continue"}
+
+// Mode selects the dialect of Jack the parser accepts
+type Mode uint
+
+const (
+	// Extended adds for loops, break and continue, else if chains, character constants, hex and
+	// binary integer constants, and escape sequences in string constants
+	Extended Mode = 1 << iota
+)
+
+type parser struct {
+	mode     Mode
+	fileName string
+	src      string
+	lexer    *token.Lexer
+	curr     token.Token
+	next     token.Token
+	hasNext  bool
+	// Set once the current token is past the end of the file
+	atEnd bool
+	errs  []error
+}
+
+// Unwinds the parser from a syntax error to the nearest recovery point
+type bailout struct{}
+
+// Parse returns the syntax tree of the class in src along with every error found, ordered by
+// position. After a syntax error the parser skips ahead to the next statement or declaration, so
+// the tree of a class with errors is incomplete.
+func Parse(fileName string, src string) (*ast.Class, []error) {
+	return ParseMode(fileName, src, 0)
+}
+
+// ParseMode is Parse for the dialect selected by mode
+func ParseMode(fileName string, src string, mode Mode) (*ast.Class, []error) {
+	p := &parser{mode: mode, fileName: fileName, src: src, lexer: token.NewLexer(fileName, src)}
+	if p.extended() {
+		p.lexer = token.NewExtendedLexer(fileName, src)
+	}
+	p.next, p.hasNext = p.lexer.Next()
+	p.advance() // move to the first token
+
+	class := &ast.Class{Node: p.node(), FileName: fileName, Src: src}
+	p.recovering(func() {
+		p.parseClass(class)
+		if !p.atEnd {
+			p.fail("end of file")
+		}
+	})
+
+	errs := append(slices.Clone(p.lexer.Errors()), p.errs...)
+	slices.SortStableFunc(errs, func(a, b error) int {
+		pa, pb := a.(*token.Error).Pos, b.(*token.Error).Pos
+		return cmp.Or(cmp.Compare(pa.Line, pb.Line), cmp.Compare(pa.Column, pb.Column))
+	})
+	return class, errs
+}
+
+func (p *parser) advance() {
+	if !p.hasNext {
+		p.atEnd = true
+		// The end of a file without tokens is reported at its start
+		pos := p.curr.Pos
+		if pos.Line == 0 {
+			pos = token.Pos{Line: 1, Column: 1}
+		}
+		p.curr = token.Token{Pos: pos}
+		return
+	}
+	p.curr = p.next
+	p.next, p.hasNext = p.lexer.Next()
+}
+
+// Returns the text of the token after the current one, or "" at the end of the file
+func (p *parser) peek() string {
+	if !p.hasNext {
+		return ""
+	}
+	return p.next.Text
+}
+
+// Records an error at pos. Only the first error at a position is kept, since recovering from one
+// often trips over the same token again.
+func (p *parser) errorf(pos token.Pos, format string, args ...any) {
+	if len(p.errs) > 0 && p.errs[len(p.errs)-1].(*token.Error).Pos == pos {
+		return
+	}
+	p.errs = append(p.errs, token.NewError(p.fileName, p.src, pos, fmt.Sprintf(format, args...)))
+}
+
+// Records a syntax error at the current token and unwinds to the nearest recovery point
+func (p *parser) fail(expected string) {
+	found := p.curr.Text
+	if p.atEnd {
+		found = "end of file"
+	}
+	p.errorf(p.curr.Pos, "Syntax error at token %s. Expected: %s", found, expected)
+	panic(bailout{})
+}
+
+// Runs parse, recovering from a syntax error in it by skipping tokens up to a ';', which is
+// consumed, or a '}' or one of the sync tokens, which are not. Braces opened while skipping are
+// skipped up to the brace closing them. At least one token is skipped when parse consumed none, so
+// callers looping over recovering always make progress.
+func (p *parser) recovering(parse func(), sync ...string) {
+	start := p.curr.Pos
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.skipTo(sync)
+			if !p.atEnd && p.curr.Pos == start {
+				p.advance()
+				p.skipTo(sync)
+			}
+		}
+	}()
+	parse()
+}
+
+func (p *parser) skipTo(sync []string) {
+	depth := 0
+	for !p.atEnd {
+		switch {
+		case p.at("{"):
+			depth += 1
+		case p.at("}"):
+			if depth == 0 {
+				return
+			}
+			depth -= 1
+		case depth == 0 && p.at(";"):
+			p.advance()
+			return
+		case depth == 0 && p.at(sync...):
+			return
+		}
+		p.advance()
+	}
+}
+
+// Checks the current token is text and advances past it
+func (p *parser) process(text string) {
+	if p.atEnd || p.curr.Text != text || p.curr.Kind == token.StringConst {
+		p.fail(text)
+	}
+	p.advance()
+}
+
+func (p *parser) extended() bool {
+	return p.mode&Extended != 0
+}
+
+// Returns the keywords that start statements in the dialect being parsed
+func (p *parser) statementKeywords() []string {
+	if p.extended() {
+		return slices.Concat(statementKeywords, extendedKeywords)
+	}
+	return statementKeywords
+}
+
+// Returns the current token, which must be an identifier, and advances past it
+func (p *parser) identifier() string {
+	if p.atEnd || p.curr.Kind != token.Identifier || (p.extended() && slices.Contains(extendedKeywords, p.curr.Text)) {
+		p.fail("identifier")
+	}
+	name := p.curr.Text
+	p.advance()
+	return name
+}
+
+func (p *parser) node() ast.Node {
+	return ast.Node{Pos: p.curr.Pos}
+}
+
+// Returns whether the current token is the keyword or symbol text
+func (p *parser) at(text ...string) bool {
+	return !p.atEnd && p.curr.Kind != token.StringConst && slices.Contains(text, p.curr.Text)
+}
+
+// 'class' className '{' classVarDec* subroutineDec* '}'
+func (p *parser) parseClass(class *ast.Class) {
+	p.process("class")
+	class.NamePos = p.curr.Pos
+	class.Name = p.identifier()
+	p.process("{")
+	for !p.atEnd && !p.at("}") {
+		p.recovering(func() {
+			switch {
+			case p.at("static", "field") && len(class.Subroutines) == 0:
+				class.VarDecs = append(class.VarDecs, p.parseClassVarDec())
+			case p.at("constructor", "function", "method"):
+				class.Subroutines = append(class.Subroutines, p.parseSubroutine())
+			case len(class.Subroutines) == 0:
+				p.fail("class variable or subroutine declaration")
+			default:
+				p.fail("subroutine declaration")
+			}
+		}, memberKeywords...)
+	}
+	p.process("}")
+}
+
+// ('static' | 'field') type varName (',' varName)* ';'
+func (p *parser) parseClassVarDec() *ast.ClassVarDec {
+	dec := &ast.ClassVarDec{Node: p.node(), Kind: p.curr.Text}
+	p.advance()
+	dec.TypePos = p.curr.Pos
+	dec.Type = p.parseType(false)
+	dec.Names, dec.NamePos = p.parseNames()
+	p.process(";")
+	return dec
+}
+
+// ('constructor' | 'function' | 'method') ('void' | type) subroutineName '(' parameterList ')' subroutineBody
+func (p *parser) parseSubroutine() *ast.Subroutine {
+	sub := &ast.Subroutine{Node: p.node(), Kind: p.curr.Text}
+	p.advance()
+	sub.TypePos = p.curr.Pos
+	sub.ReturnType = p.parseType(true)
+	sub.NamePos = p.curr.Pos
+	sub.Name = p.identifier()
+
+	// ((type varName) (',' type varName)*)?
+	p.process("(")
+	for !p.at(")") {
+		param := &ast.Param{Node: p.node()}
+		param.Type = p.parseType(false)
+		param.NamePos = p.curr.Pos
+		param.Name = p.identifier()
+		sub.Params = append(sub.Params, param)
+		if !p.at(")") {
+			p.process(",")
+		}
+	}
+	p.process(")")
+
+	// '{' varDec* statements '}'
+	p.process("{")
+	for p.at("var") {
+		p.recovering(func() {
+			dec := &ast.VarDec{Node: p.node()}
+			p.process("var")
+			dec.TypePos = p.curr.Pos
+			dec.Type = p.parseType(false)
+			dec.Names, dec.NamePos = p.parseNames()
+			p.process(";")
+			sub.VarDecs = append(sub.VarDecs, dec)
+		}, append([]string{"var"}, p.statementKeywords()...)...)
+	}
+	sub.Statements = p.parseStatements()
+	p.process("}")
+	return sub
+}
+
+// 'int' | 'char' | 'boolean' | className, or 'void' when allowed
+func (p *parser) parseType(allowVoid bool) string {
+	if p.at("int", "char", "boolean") || (allowVoid && p.at("void")) {
+		t := p.curr.Text
+		p.advance()
+		return t
+	}
+	return p.identifier()
+}
+
+// varName (',' varName)*
+func (p *parser) parseNames() ([]string, []token.Pos) {
+	positions := []token.Pos{p.curr.Pos}
+	names := []string{p.identifier()}
+	for p.at(",") {
+		p.process(",")
+		positions = append(positions, p.curr.Pos)
+		names = append(names, p.identifier())
+	}
+	return names, positions
+}
+
+// (letStatement | ifStatement | whileStatement | doStatement | returnStatement)*
+// Statements run up to the '}' closing their block, so anything else in between is an error.
+func (p *parser) parseStatements() []ast.Statement {
+	statements := []ast.Statement{}
+	for !p.atEnd && !p.at("}") {
+		p.recovering(func() {
+			switch {
+			case p.at("let"):
+				statements = append(statements, p.parseLetStatement())
+			case p.at("if"):
+				statements = append(statements, p.parseIfStatement())
+			case p.at("while"):
+				statements = append(statements, p.parseWhileStatement())
+			case p.at("do"):
+				statements = append(statements, p.parseDoStatement())
+			case p.at("return"):
+				statements = append(statements, p.parseReturnStatement())
+			case p.extended() && p.at("for"):
+				statements = append(statements, p.parseForStatement())
+			case p.extended() && p.at("break"):
+				statements = append(statements, &ast.BreakStatement{Node: p.node()})
+				p.advance()
+				p.process(";")
+			case p.extended() && p.at("continue"):
+				statements = append(statements, &ast.ContinueStatement{Node: p.node()})
+				p.advance()
+				p.process(";")
+			default:
+				p.fail("statement")
+			}
+		}, p.statementKeywords()...)
+	}
+	return statements
+}
+
+// 'let' varName ('[' expression ']')? '=' expression ';'
+func (p *parser) parseLetStatement() *ast.LetStatement {
+	let := p.parseAssignment()
+	p.process(";")
+	return let
+}
+
+// 'let' varName ('[' expression ']')? '=' expression
+func (p *parser) parseAssignment() *ast.LetStatement {
+	let := &ast.LetStatement{Node: p.node()}
+	p.process("let")
+	let.NamePos = p.curr.Pos
+	let.Name = p.identifier()
+	if p.at("[") {
+		p.process("[")
+		let.Index = p.parseExpression()
+		p.process("]")
+	}
+	p.process("=")
+	let.Value = p.parseExpression()
+	return let
+}
+
+// 'if' '(' expression ')' '{' statements '}' ('else' '{' statements '}')?
+func (p *parser) parseIfStatement() *ast.IfStatement {
+	stmt := &ast.IfStatement{Node: p.node()}
+	p.process("if")
+	p.process("(")
+	stmt.Cond = p.parseExpression()
+	p.process(")")
+	p.process("{")
+	stmt.Then = p.parseStatements()
+	p.process("}")
+	if p.at("else") {
+		stmt.HasElse = true
+		p.process("else")
+		if p.extended() && p.at("if") {
+			stmt.ElseIf = true
+			stmt.Else = []ast.Statement{p.parseIfStatement()}
+			return stmt
+		}
+		p.process("{")
+		stmt.Else = p.parseStatements()
+		p.process("}")
+	}
+	return stmt
+}
+
+// 'while' '(' expression ')' '{' statements '}'
+func (p *parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Node: p.node()}
+	p.process("while")
+	p.process("(")
+	stmt.Cond = p.parseExpression()
+	p.process(")")
+	p.process("{")
+	stmt.Body = p.parseStatements()
+	p.process("}")
+	return stmt
+}
+
+// 'for' '(' letStatement expression ';' 'let' varName ('[' expression ']')? '=' expression ')'
+// '{' statements '}'
+func (p *parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Node: p.node()}
+	p.process("for")
+	p.process("(")
+	stmt.Init = p.parseLetStatement()
+	stmt.Cond = p.parseExpression()
+	p.process(";")
+	stmt.Update = p.parseAssignment()
+	p.process(")")
+	p.process("{")
+	stmt.Body = p.parseStatements()
+	p.process("}")
+	return stmt
+}
+
+// 'do' subroutineCall ';'
+func (p *parser) parseDoStatement() *ast.DoStatement {
+	stmt := &ast.DoStatement{Node: p.node()}
+	p.process("do")
+	if p.curr.Kind != token.Identifier || (p.peek() != "." && p.peek() != "(") {
+		p.fail("subroutine call")
+	}
+	stmt.Call = p.parseSubroutineCall()
+	p.process(";")
+	return stmt
+}
+
+// 'return' expression? ';'
+func (p *parser) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Node: p.node()}
+	p.process("return")
+	// A '}' right after return is a missing ';' rather than a missing expression
+	if !p.at(";", "}") {
+		stmt.Value = p.parseExpression()
+	}
+	p.process(";")
+	return stmt
+}
+
+// term (op term)*
+func (p *parser) parseExpression() *ast.Expression {
+	expr := &ast.Expression{Node: p.node()}
+	expr.Term = p.parseTerm()
+	for p.at("+", "-", "*", "/", "&", "|", "<", ">", "=") {
+		op := &ast.BinaryOp{Node: p.node(), Op: p.curr.Text}
+		p.advance()
+		op.Term = p.parseTerm()
+		expr.Ops = append(expr.Ops, op)
+	}
+	return expr
+}
+
+// integerConstant | stringConstant | keywordConstant | varName | varName '[' expression ']' |
+// '(' expression ')' | (unaryOp term) | subroutineCall
+func (p *parser) parseTerm() ast.Term {
+	node := p.node()
+	switch {
+	case p.atEnd:
+		p.fail("term")
+	case p.curr.Kind == token.IntConst:
+		value, err := p.curr.Int()
+		if err != nil || value > 32767 {
+			p.errorf(p.curr.Pos, "integer constant %s is out of range", p.curr.Text)
+		}
+		p.advance()
+		return &ast.IntConst{Node: node, Value: value}
+	case p.curr.Kind == token.StringConst:
+		value := p.curr.Value()
+		if p.extended() {
+			value = token.Unescape(value)
+		}
+		p.advance()
+		return &ast.StringConst{Node: node, Value: value}
+	case p.at("true", "false", "null", "this"):
+		value := p.curr.Text
+		p.advance()
+		return &ast.KeywordConst{Node: node, Value: value}
+	case p.at("("):
+		p.process("(")
+		expr := p.parseExpression()
+		p.process(")")
+		return &ast.ParenExpr{Node: node, Expr: expr}
+	case p.at("-", "~"):
+		op := p.curr.Text
+		p.advance()
+		return &ast.UnaryOp{Node: node, Op: op, Term: p.parseTerm()}
+	case p.curr.Kind == token.Identifier && (p.peek() == "." || p.peek() == "("):
+		return p.parseSubroutineCall()
+	case p.curr.Kind == token.Identifier && p.peek() == "[":
+		name := p.identifier()
+		p.process("[")
+		index := p.parseExpression()
+		p.process("]")
+		return &ast.ArrayAccess{Node: node, Name: name, Index: index}
+	case p.curr.Kind == token.Identifier:
+		return &ast.VarRef{Node: node, Name: p.identifier()}
+	}
+	p.fail("term")
+	return nil
+}
+
+// subroutineName '(' expressionList ')' | (className | varName) '.' subroutineName '(' expressionList ')'
+func (p *parser) parseSubroutineCall() *ast.SubroutineCall {
+	call := &ast.SubroutineCall{Node: p.node(), NamePos: p.curr.Pos}
+	call.Name = p.identifier()
+	if p.at(".") {
+		p.process(".")
+		call.Receiver = call.Name
+		call.NamePos = p.curr.Pos
+		call.Name = p.identifier()
+	}
+
+	// (expression (',' expression)*)?
+	p.process("(")
+	if !p.at(")") {
+		call.Args = append(call.Args, p.parseExpression())
+		for p.at(",") {
+			p.process(",")
+			call.Args = append(call.Args, p.parseExpression())
+		}
+	}
+	p.process(")")
+	return call
+}
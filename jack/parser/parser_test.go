@@ -0,0 +1,243 @@
+package parser
+
+import (
+	"io/fs"
+	"jack/ast"
+	"jack/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := "class Main {\n  field int x;\n  method int get(Array a) {\n    let a[1] = -x + (2 * x);\n    if (~(x = 0)) { do Output.printString(\"x\"); } else { }\n    return get(a);\n  }\n}\n"
+	pos := func(line, column int) ast.Node {
+		return ast.Node{Pos: token.Pos{Line: line, Column: column}}
+	}
+	expected := &ast.Class{
+		Node:     pos(1, 1),
+		FileName: "Main.jack",
+		Src:      src,
+		Name:     "Main",
+		NamePos:  token.Pos{Line: 1, Column: 7},
+		VarDecs: []*ast.ClassVarDec{
+			{Node: pos(2, 3), Kind: "field", Type: "int", TypePos: token.Pos{Line: 2, Column: 9}, Names: []string{"x"}, NamePos: []token.Pos{{Line: 2, Column: 13}}},
+		},
+		Subroutines: []*ast.Subroutine{{
+			Node:       pos(3, 3),
+			Kind:       "method",
+			ReturnType: "int",
+			TypePos:    token.Pos{Line: 3, Column: 10},
+			Name:       "get",
+			NamePos:    token.Pos{Line: 3, Column: 14},
+			Params:     []*ast.Param{{Node: pos(3, 18), Type: "Array", Name: "a", NamePos: token.Pos{Line: 3, Column: 24}}},
+			Statements: []ast.Statement{
+				&ast.LetStatement{
+					Node:    pos(4, 5),
+					Name:    "a",
+					NamePos: token.Pos{Line: 4, Column: 9},
+					Index:   &ast.Expression{Node: pos(4, 11), Term: &ast.IntConst{Node: pos(4, 11), Value: 1}},
+					Value: &ast.Expression{
+						Node: pos(4, 16),
+						Term: &ast.UnaryOp{Node: pos(4, 16), Op: "-", Term: &ast.VarRef{Node: pos(4, 17), Name: "x"}},
+						Ops: []*ast.BinaryOp{{
+							Node: pos(4, 19),
+							Op:   "+",
+							Term: &ast.ParenExpr{Node: pos(4, 21), Expr: &ast.Expression{
+								Node: pos(4, 22),
+								Term: &ast.IntConst{Node: pos(4, 22), Value: 2},
+								Ops:  []*ast.BinaryOp{{Node: pos(4, 24), Op: "*", Term: &ast.VarRef{Node: pos(4, 26), Name: "x"}}},
+							}},
+						}},
+					},
+				},
+				&ast.IfStatement{
+					Node: pos(5, 5),
+					Cond: &ast.Expression{Node: pos(5, 9), Term: &ast.UnaryOp{
+						Node: pos(5, 9),
+						Op:   "~",
+						Term: &ast.ParenExpr{Node: pos(5, 10), Expr: &ast.Expression{
+							Node: pos(5, 11),
+							Term: &ast.VarRef{Node: pos(5, 11), Name: "x"},
+							Ops:  []*ast.BinaryOp{{Node: pos(5, 13), Op: "=", Term: &ast.IntConst{Node: pos(5, 15), Value: 0}}},
+						}},
+					}},
+					Then: []ast.Statement{&ast.DoStatement{Node: pos(5, 21), Call: &ast.SubroutineCall{
+						Node:     pos(5, 24),
+						Receiver: "Output",
+						Name:     "printString",
+						NamePos:  token.Pos{Line: 5, Column: 31},
+						Args:     []*ast.Expression{{Node: pos(5, 43), Term: &ast.StringConst{Node: pos(5, 43), Value: "x"}}},
+					}}},
+					HasElse: true,
+					Else:    []ast.Statement{},
+				},
+				&ast.ReturnStatement{Node: pos(6, 5), Value: &ast.Expression{Node: pos(6, 12), Term: &ast.SubroutineCall{
+					Node:    pos(6, 12),
+					Name:    "get",
+					NamePos: token.Pos{Line: 6, Column: 12},
+					Args:    []*ast.Expression{{Node: pos(6, 16), Term: &ast.VarRef{Node: pos(6, 16), Name: "a"}}},
+				}}},
+			},
+		}},
+	}
+
+	class, errs := Parse("Main.jack", src)
+	if len(errs) > 0 {
+		t.Fatalf("Failed to parse: %v", errs)
+	}
+	if !reflect.DeepEqual(class, expected) {
+		t.Errorf("Parsed to %+v, expected %+v", class, expected)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			name:     "statements",
+			src:      "class Main {\n  function void f() {\n    let x = (1 + );\n    let = 2;\n    if (x { do g(); }\n    do h();\n    return;\n  }\n}",
+			expected: []string{"3:18: Syntax error at token ). Expected: term", "4:9: Syntax error at token =. Expected: identifier", "5:11: Syntax error at token {. Expected: )"},
+		},
+		{
+			name:     "stray tokens",
+			src:      "class Main {\n  function void f() {\n    x = 1;\n    return;\n  }\n}",
+			expected: []string{"3:5: Syntax error at token x. Expected: statement"},
+		},
+		{
+			name:     "declarations",
+			src:      "class Main {\n  field int x y;\n  function void f(int) { return; }\n  function void g() { var int; return; }\n  field int z;\n}",
+			expected: []string{"2:15: Syntax error at token y. Expected: ;", "3:22: Syntax error at token ). Expected: identifier", "4:30: Syntax error at token ;. Expected: identifier", "5:3: Syntax error at token field. Expected: subroutine declaration"},
+		},
+		{
+			name:     "tokens",
+			src:      "class Main {\n  function void f() {\n    let s = \"abc;\n    let x = 12ab # 40000;\n    return;\n  }\n}",
+			expected: []string{"3:13: unterminated string constant", "4:5: Syntax error at token let. Expected: ;", "4:13: invalid integer constant", "4:18: unexpected character '#'", "4:20: Syntax error at token 40000. Expected: ;"},
+		},
+		{
+			name:     "end of file",
+			src:      "class Main {\n  function void f() {\n    return;\n",
+			expected: []string{"3:11: Syntax error at token end of file. Expected: }"},
+		},
+		{
+			name:     "empty file",
+			src:      "",
+			expected: []string{"1:1: Syntax error at token end of file. Expected: class"},
+		},
+		{
+			name:     "comment only",
+			src:      "// Th",
+			expected: []string{"1:1: Syntax error at token end of file. Expected: class"},
+		},
+	}
+
+	for _, tc := range tests {
+		_, errs := Parse("Main.jack", tc.src)
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.(*token.Error).Pos.String()+": "+err.(*token.Error).Msg)
+		}
+		if !slices.Equal(msgs, tc.expected) {
+			t.Errorf("Parsing %s reported %q, expected %q", tc.name, msgs, tc.expected)
+		}
+	}
+}
+
+func TestErrorSnippet(t *testing.T) {
+	_, errs := Parse("Main.jack", "class Main {\n\tfunction void f() {\n\t\treturn 1 +;\n\t}\n}")
+	expected := "Main.jack:3:13: Syntax error at token ;. Expected: term\n\t\treturn 1 +;\n\t\t          ^"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("Parsing reported %v, expected %q", errs, expected)
+	}
+}
+
+// Every jack file in the repo parses
+func TestParseRepoFiles(t *testing.T) {
+	err := filepath.WalkDir("../..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".jack") {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		class, errs := Parse(path, string(src))
+		if len(errs) > 0 {
+			t.Errorf("Failed to parse %s: %v", path, errs)
+		} else if class.Name+".jack" != filepath.Base(path) {
+			t.Errorf("Parsed class %s from %s", class.Name, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk jack files: %v", err)
+	}
+}
+
+func TestParseExtended(t *testing.T) {
+	src := "class Main {\n  function void f() {\n    var int i;\n    for (let i = 0; i < 3; let i = i + 1) {\n      if (i = 1) { continue; } else if (i = 2) { break; } else { }\n    }\n    return;\n  }\n}"
+	class, errs := ParseMode("Main.jack", src, Extended)
+	if len(errs) > 0 {
+		t.Fatalf("Failed to parse: %v", errs)
+	}
+
+	loop, ok := class.Subroutines[0].Statements[0].(*ast.ForStatement)
+	if !ok || loop.Init.Name != "i" || loop.Cond.Ops[0].Op != "<" || loop.Update.Name != "i" || len(loop.Update.Value.Ops) != 1 || len(loop.Body) != 1 {
+		t.Fatalf("Parsed %+v, expected a for loop over i", class.Subroutines[0].Statements[0])
+	}
+	stmt := loop.Body[0].(*ast.IfStatement)
+	if _, ok := stmt.Then[0].(*ast.ContinueStatement); !ok || !stmt.HasElse || !stmt.ElseIf || len(stmt.Else) != 1 {
+		t.Fatalf("Parsed %+v, expected an if continuing with an else if", stmt)
+	}
+	elseIf := stmt.Else[0].(*ast.IfStatement)
+	if _, ok := elseIf.Then[0].(*ast.BreakStatement); !ok || !elseIf.HasElse || elseIf.ElseIf || len(elseIf.Else) != 0 {
+		t.Errorf("Parsed %+v, expected an else if breaking with an empty else", elseIf)
+	}
+
+	// The extended keywords are identifiers in standard Jack and reserved in the extended dialect
+	_, errs = Parse("Main.jack", src)
+	if len(errs) == 0 || errs[0].(*token.Error).Msg != "Syntax error at token for. Expected: statement" {
+		t.Errorf("Parsing standard Jack reported %v, expected for to be an error", errs)
+	}
+	src = "class Main {\n  function void f() {\n    var int break;\n    return;\n  }\n}"
+	if _, errs := Parse("Main.jack", src); len(errs) > 0 {
+		t.Errorf("Failed to parse break as a standard Jack variable: %v", errs)
+	}
+	if _, errs := ParseMode("Main.jack", src, Extended); len(errs) != 1 || errs[0].(*token.Error).Msg != "Syntax error at token break. Expected: identifier" {
+		t.Errorf("Parsing break as a variable reported %v, expected an error", errs)
+	}
+}
+
+func TestParseExtendedConstants(t *testing.T) {
+	src := "class Main {\n  function void f() {\n    do g('A', '\\n', 0x7FFF, 0b101, \"say \\\"hi\\\"\\n\");\n    do g(0x8000, 0b1000000000000000);\n    return;\n  }\n}"
+	class, errs := ParseMode("Main.jack", src, Extended)
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, err.(*token.Error).Pos.String()+": "+err.(*token.Error).Msg)
+	}
+	expected := []string{"4:10: integer constant 0x8000 is out of range", "4:18: integer constant 0b1000000000000000 is out of range"}
+	if !slices.Equal(msgs, expected) {
+		t.Fatalf("Parsing reported %q, expected %q", msgs, expected)
+	}
+
+	args := class.Subroutines[0].Statements[0].(*ast.DoStatement).Call.Args
+	values := []int{}
+	for _, arg := range args[:4] {
+		values = append(values, arg.Term.(*ast.IntConst).Value)
+	}
+	if !slices.Equal(values, []int{65, token.NewLine, 32767, 5}) {
+		t.Errorf("Parsed integer constants %v, expected [65 128 32767 5]", values)
+	}
+	if value := args[4].Term.(*ast.StringConst).Value; value != "say \"hi\"\u0080" {
+		t.Errorf("Parsed string constant %q, expected the escapes replaced", value)
+	}
+}
@@ -0,0 +1,231 @@
+// Package precedence regroups Jack expressions by operator precedence. Jack applies the operators
+// of an expression strictly left to right, so 1 + 2 * 3 is 9. With precedence, * and / bind
+// tighter than + and -, which bind tighter than the comparisons < > =, which bind tighter than
+// & and |, and operators of the same level apply left to right.
+package precedence
+
+import (
+	"fmt"
+	"jack/ast"
+	"jack/token"
+	"strconv"
+	"strings"
+)
+
+func level(op string) int {
+	switch op {
+	case "*", "/":
+		return 3
+	case "+", "-":
+		return 2
+	case "<", ">", "=":
+		return 1
+	}
+	return 0
+}
+
+// Returns whether precedence groups the operators of expr differently from left to right, which
+// happens when an operator binds tighter than the one before it
+func differs(expr *ast.Expression) bool {
+	for i := 1; i < len(expr.Ops); i++ {
+		if level(expr.Ops[i].Op) > level(expr.Ops[i-1].Op) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply regroups every expression of class by precedence. A regrouped expression stays a chain of
+// operators applied left to right, with the operands that bind tighter wrapped in parentheses, so
+// passes over the tree need not know about precedence.
+func Apply(class *ast.Class) {
+	walk(class, func(expr *ast.Expression) {
+		if differs(expr) {
+			*expr = *flatten(byPrecedence(expr))
+		}
+	})
+}
+
+// Audit returns a *token.Error for every expression of class whose value could change with
+// precedence, showing both groupings
+func Audit(class *ast.Class) []error {
+	errs := []error{}
+	walk(class, func(expr *ast.Expression) {
+		if differs(expr) {
+			msg := fmt.Sprintf("%s is %s left to right but %s with operator precedence", exprString(expr), leftToRight(expr), byPrecedence(expr))
+			errs = append(errs, token.NewError(class.FileName, class.Src, expr.Pos, msg))
+		}
+	})
+	return errs
+}
+
+// A binary tree of the terms and operators of an expression
+type tree struct {
+	// Set for a leaf
+	term        ast.Term
+	op          *ast.BinaryOp
+	left, right *tree
+}
+
+func terms(expr *ast.Expression) []ast.Term {
+	terms := []ast.Term{expr.Term}
+	for _, op := range expr.Ops {
+		terms = append(terms, op.Term)
+	}
+	return terms
+}
+
+func leftToRight(expr *ast.Expression) *tree {
+	t := &tree{term: expr.Term}
+	for _, op := range expr.Ops {
+		t = &tree{op: op, left: t, right: &tree{term: op.Term}}
+	}
+	return t
+}
+
+// Builds the tree of expr by precedence climbing
+func byPrecedence(expr *ast.Expression) *tree {
+	terms := terms(expr)
+	next := 0
+	var parse func(minLevel int) *tree
+	parse = func(minLevel int) *tree {
+		t := &tree{term: terms[next]}
+		for next < len(expr.Ops) && level(expr.Ops[next].Op) >= minLevel {
+			op := expr.Ops[next]
+			next += 1
+			t = &tree{op: op, left: t, right: parse(level(op.Op) + 1)}
+		}
+		return t
+	}
+	return parse(0)
+}
+
+// Returns the expression of a tree. Left operands continue the chain of the expression, right
+// operands that are not terms are wrapped in parentheses.
+func flatten(t *tree) *ast.Expression {
+	if t.term != nil {
+		return &ast.Expression{Node: ast.Node{Pos: t.term.Position()}, Term: t.term}
+	}
+	expr := flatten(t.left)
+	operand := t.right.term
+	if operand == nil {
+		right := flatten(t.right)
+		operand = &ast.ParenExpr{Node: right.Node, Expr: right}
+	}
+	expr.Ops = append(expr.Ops, &ast.BinaryOp{Node: t.op.Node, Op: t.op.Op, Term: operand})
+	return expr
+}
+
+// Returns the tree with parentheses around every operation it contains, except along a chain of
+// operators of the same level
+func (t *tree) String() string {
+	if t.term != nil {
+		return termString(t.term)
+	}
+	left, right := t.left.String(), t.right.String()
+	if t.left.term == nil && level(t.left.op.Op) != level(t.op.Op) {
+		left = "(" + left + ")"
+	}
+	if t.right.term == nil {
+		right = "(" + right + ")"
+	}
+	return left + " " + t.op.Op + " " + right
+}
+
+func exprString(expr *ast.Expression) string {
+	var b strings.Builder
+	b.WriteString(termString(expr.Term))
+	for _, op := range expr.Ops {
+		b.WriteString(" " + op.Op + " " + termString(op.Term))
+	}
+	return b.String()
+}
+
+func termString(term ast.Term) string {
+	switch t := term.(type) {
+	case *ast.IntConst:
+		return strconv.Itoa(t.Value)
+	case *ast.StringConst:
+		return `"` + t.Value + `"`
+	case *ast.KeywordConst:
+		return t.Value
+	case *ast.VarRef:
+		return t.Name
+	case *ast.ArrayAccess:
+		return t.Name + "[" + exprString(t.Index) + "]"
+	case *ast.ParenExpr:
+		return "(" + exprString(t.Expr) + ")"
+	case *ast.UnaryOp:
+		return t.Op + termString(t.Term)
+	case *ast.SubroutineCall:
+		args := []string{}
+		for _, arg := range t.Args {
+			args = append(args, exprString(arg))
+		}
+		name := t.Name
+		if t.Receiver != "" {
+			name = t.Receiver + "." + t.Name
+		}
+		return name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return ""
+}
+
+// Calls f on every expression of class, inner expressions before the expressions containing them
+func walk(class *ast.Class, f func(*ast.Expression)) {
+	for _, sub := range class.Subroutines {
+		walkStatements(sub.Statements, f)
+	}
+}
+
+func walkStatements(statements []ast.Statement, f func(*ast.Expression)) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			if s.Index != nil {
+				walkExpression(s.Index, f)
+			}
+			walkExpression(s.Value, f)
+		case *ast.IfStatement:
+			walkExpression(s.Cond, f)
+			walkStatements(s.Then, f)
+			walkStatements(s.Else, f)
+		case *ast.WhileStatement:
+			walkExpression(s.Cond, f)
+			walkStatements(s.Body, f)
+		case *ast.ForStatement:
+			walkStatements([]ast.Statement{s.Init}, f)
+			walkExpression(s.Cond, f)
+			walkStatements([]ast.Statement{s.Update}, f)
+			walkStatements(s.Body, f)
+		case *ast.DoStatement:
+			walkTerm(s.Call, f)
+		case *ast.ReturnStatement:
+			if s.Value != nil {
+				walkExpression(s.Value, f)
+			}
+		}
+	}
+}
+
+func walkExpression(expr *ast.Expression, f func(*ast.Expression)) {
+	for _, term := range terms(expr) {
+		walkTerm(term, f)
+	}
+	f(expr)
+}
+
+func walkTerm(term ast.Term, f func(*ast.Expression)) {
+	switch t := term.(type) {
+	case *ast.ArrayAccess:
+		walkExpression(t.Index, f)
+	case *ast.ParenExpr:
+		walkExpression(t.Expr, f)
+	case *ast.UnaryOp:
+		walkTerm(t.Term, f)
+	case *ast.SubroutineCall:
+		for _, arg := range t.Args {
+			walkExpression(arg, f)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package precedence
+
+import (
+	"jack/ast"
+	"jack/parser"
+	"jack/token"
+	"slices"
+	"testing"
+)
+
+// Parses expr as the value returned by a function
+func parseExpression(t *testing.T, expr string) *ast.Class {
+	class, errs := parser.Parse("Main.jack", "class Main {\n  function int f() {\n    return "+expr+";\n  }\n}\n")
+	if len(errs) > 0 {
+		t.Fatalf("Failed to parse %s: %v", expr, errs)
+	}
+	return class
+}
+
+func returned(class *ast.Class) *ast.Expression {
+	return class.Subroutines[0].Statements[0].(*ast.ReturnStatement).Value
+}
+
+// Evaluates an expression of integer constants left to right, the way Jack does
+func eval(expr *ast.Expression) int {
+	evalTerm := func(term ast.Term) int {
+		switch t := term.(type) {
+		case *ast.IntConst:
+			return t.Value
+		case *ast.ParenExpr:
+			return eval(t.Expr)
+		}
+		panic("not a constant")
+	}
+	value := evalTerm(expr.Term)
+	for _, op := range expr.Ops {
+		operand := evalTerm(op.Term)
+		switch op.Op {
+		case "+":
+			value += operand
+		case "-":
+			value -= operand
+		case "*":
+			value *= operand
+		case "/":
+			value /= operand
+		}
+	}
+	return value
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected int
+	}{
+		{"1 + 2 * 3", 7},
+		{"2 * 3 + 4 * 5 - 6 / 2", 23},
+		{"10 - 4 / 2 * 3 - 1", 3},
+		{"(1 + 2) * 3", 9},
+		{"8 / 2 / 2", 2},
+	}
+
+	for _, test := range tests {
+		class := parseExpression(t, test.expr)
+		Apply(class)
+		if got := eval(returned(class)); got != test.expected {
+			t.Errorf("%s regrouped to %s evaluates to %d, expected %d", test.expr, exprString(returned(class)), got, test.expected)
+		}
+	}
+}
+
+func TestApplyNested(t *testing.T) {
+	class := parseExpression(t, "a[i + j * 2] < f(x - y / 2) + 1 & ~(b | c = d)")
+	Apply(class)
+	expected := "a[i + (j * 2)] < (f(x - (y / 2)) + 1) & ~(b | (c = d))"
+	if got := exprString(returned(class)); got != expected {
+		t.Errorf("Regrouped to %s, expected %s", got, expected)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"a * b + c - d", []string{}},
+		{"1 + 2 * 3", []string{"3:12: 1 + 2 * 3 is (1 + 2) * 3 left to right but 1 + (2 * 3) with operator precedence"}},
+		{"a < b + 1 & c", []string{"3:12: a < b + 1 & c is ((a < b) + 1) & c left to right but (a < (b + 1)) & c with operator precedence"}},
+		{"f(x + y * 2) * 2", []string{"3:14: x + y * 2 is (x + y) * 2 left to right but x + (y * 2) with operator precedence"}},
+	}
+
+	for _, test := range tests {
+		errs := Audit(parseExpression(t, test.expr))
+		got := []string{}
+		for _, err := range errs {
+			e := err.(*token.Error)
+			got = append(got, e.Pos.String()+": "+e.Msg)
+		}
+		if !slices.Equal(got, test.expected) {
+			t.Errorf("Auditing %s reported %q, expected %q", test.expr, got, test.expected)
+		}
+	}
+}
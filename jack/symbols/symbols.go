@@ -0,0 +1,107 @@
+// Package symbols allocates the variables of Jack classes and subroutines to vm segments the way
+// the compiler does, for the compiler and the tools that describe its output.
+package symbols
+
+import (
+	"cmp"
+	"jack/ast"
+	"jack/token"
+	"maps"
+	"slices"
+)
+
+// Kinds of variables, named after the vm segment they are stored in
+const (
+	Static   = "static"
+	Field    = "this"
+	Argument = "argument"
+	Local    = "local"
+)
+
+// Entry is a variable along with where it is stored and declared
+type Entry struct {
+	Name     string
+	DataType string
+	Kind     string
+	Index    int
+	Pos      token.Pos
+}
+
+// Table is the symbol table of a class or subroutine. Variables of each kind are numbered from 0
+// in declaration order.
+type Table struct {
+	entries map[string]Entry
+	counts  map[string]int
+}
+
+func NewTable() *Table {
+	return &Table{entries: make(map[string]Entry), counts: make(map[string]int)}
+}
+
+// Add declares a variable as the next one of its kind. A name declared again replaces the earlier
+// entry but still takes an index.
+func (st *Table) Add(name string, dataType string, kind string, pos token.Pos) Entry {
+	entry := Entry{Name: name, DataType: dataType, Kind: kind, Index: st.counts[kind], Pos: pos}
+	st.entries[name] = entry
+	st.counts[kind] += 1
+	return entry
+}
+
+func (st *Table) Lookup(name string) (Entry, bool) {
+	entry, ok := st.entries[name]
+	return entry, ok
+}
+
+// Count returns the number of variables of a kind
+func (st *Table) Count(kind string) int {
+	return st.counts[kind]
+}
+
+// Entries returns the variables in the order they were declared
+func (st *Table) Entries() []Entry {
+	return slices.SortedFunc(maps.Values(st.entries), func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(a.Pos.Line, b.Pos.Line), cmp.Compare(a.Pos.Column, b.Pos.Column), cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Index, b.Index))
+	})
+}
+
+// ClassTable returns the table of the static and field variables of a class
+func ClassTable(class *ast.Class) *Table {
+	st := NewTable()
+	for _, dec := range class.VarDecs {
+		kind := Static
+		if dec.Kind == "field" {
+			kind = Field
+		}
+		for i, name := range dec.Names {
+			st.Add(name, dec.Type, kind, namePos(dec.NamePos, i, dec.Pos))
+		}
+	}
+	return st
+}
+
+// SubroutineTable returns the table of the arguments and locals of a subroutine of className. The
+// object a method is called on is its argument 0, named this.
+func SubroutineTable(className string, sub *ast.Subroutine) *Table {
+	st := NewTable()
+	if sub.Kind == "method" {
+		st.Add("this", className, Argument, sub.NamePos)
+	}
+	for _, param := range sub.Params {
+		st.Add(param.Name, param.Type, Argument, param.NamePos)
+	}
+	for _, dec := range sub.VarDecs {
+		for i, name := range dec.Names {
+			st.Add(name, dec.Type, Local, namePos(dec.NamePos, i, dec.Pos))
+		}
+	}
+	return st
+}
+
+// Returns the position of the ith name of a declaration, or the declaration's position for trees
+// built without name positions
+func namePos(positions []token.Pos, i int, decPos token.Pos) token.Pos {
+	if i < len(positions) {
+		return positions[i]
+	}
+	return decPos
+}
@@ -0,0 +1,41 @@
+package symbols
+
+import (
+	"jack/parser"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+	src := "class Point {\n  field int x, y;\n  static Point origin;\n  method int dist(Point other) {\n    var int dx, dy;\n    return dx;\n  }\n}\n"
+	class, errs := parser.Parse("Point.jack", src)
+	if len(errs) > 0 {
+		t.Fatalf("Failed to parse Point: %v", errs)
+	}
+	classSt := ClassTable(class)
+	subSt := SubroutineTable(class.Name, class.Subroutines[0])
+
+	tests := []struct {
+		st       *Table
+		name     string
+		expected Entry
+	}{
+		{classSt, "y", Entry{Name: "y", DataType: "int", Kind: Field, Index: 1}},
+		{classSt, "origin", Entry{Name: "origin", DataType: "Point", Kind: Static, Index: 0}},
+		{subSt, "this", Entry{Name: "this", DataType: "Point", Kind: Argument, Index: 0}},
+		{subSt, "other", Entry{Name: "other", DataType: "Point", Kind: Argument, Index: 1}},
+		{subSt, "dy", Entry{Name: "dy", DataType: "int", Kind: Local, Index: 1}},
+	}
+	for _, test := range tests {
+		entry, ok := test.st.Lookup(test.name)
+		entry.Pos = test.expected.Pos
+		if !ok || entry != test.expected {
+			t.Errorf("Entry of %s is %+v, expected %+v", test.name, entry, test.expected)
+		}
+	}
+	if classSt.Count(Field) != 2 || subSt.Count(Local) != 2 {
+		t.Errorf("Point has %d fields and dist %d locals, expected 2 and 2", classSt.Count(Field), subSt.Count(Local))
+	}
+	if entry, _ := subSt.Lookup("dy"); entry.Pos.Line != 5 || entry.Pos.Column != 17 {
+		t.Errorf("dy is declared at %s, expected 5:17", entry.Pos)
+	}
+}
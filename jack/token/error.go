@@ -0,0 +1,48 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is an error in Jack source, reported with the line it was found on and a caret under the
+// column
+type Error struct {
+	FileName string
+	Pos      Pos
+	Msg      string
+	Snippet  string
+}
+
+func NewError(fileName string, src string, pos Pos, msg string) *Error {
+	return &Error{FileName: fileName, Pos: pos, Msg: msg, Snippet: snippet(src, pos)}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s:%s: %s", e.FileName, e.Pos, e.Msg)
+	if e.Snippet != "" {
+		msg += "\n" + e.Snippet
+	}
+	return msg
+}
+
+// Returns the source line at pos followed by a line with a caret under its column. Tabs before the
+// column are kept so the caret lines up however the line is displayed.
+func snippet(src string, pos Pos) string {
+	lines := strings.Split(src, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+	line := []rune(strings.TrimRight(lines[pos.Line-1], "\r"))
+
+	var caret strings.Builder
+	for i := 0; i < pos.Column-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return string(line) + "\n" + caret.String()
+}
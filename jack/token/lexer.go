@@ -0,0 +1,225 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Lexer reads the tokens of Jack source a rune at a time. Malformed tokens are recorded as errors
+// and lexing carries on, so a parser sees every token it can make sense of.
+type Lexer struct {
+	fileName string
+	text     string
+	src      []rune
+	errs     []error
+	comments []Comment
+	pos      int
+	line     int
+	column   int
+	// Whether to read the constants of the extended dialect
+	extended bool
+}
+
+func NewLexer(fileName string, src string) *Lexer {
+	return &Lexer{fileName: fileName, text: src, src: []rune(src), line: 1, column: 1}
+}
+
+// NewExtendedLexer is NewLexer for the extended dialect, which adds 'c' character constants, 0x and
+// 0b integer constants, and the escape sequences of Escapes in string and character constants
+func NewExtendedLexer(fileName string, src string) *Lexer {
+	l := NewLexer(fileName, src)
+	l.extended = true
+	return l
+}
+
+// Errors returns the errors found in the tokens read so far
+func (l *Lexer) Errors() []error {
+	return l.errs
+}
+
+// Comments returns the comments skipped so far
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
+// Next returns the next token, or false once the source is exhausted
+func (l *Lexer) Next() (Token, bool) {
+	for {
+		l.skipSpaceAndComments()
+		if l.pos == len(l.src) {
+			return Token{}, false
+		}
+		if isDigit(l.src[l.pos]) || isIdentifierRune(l.src[l.pos]) || l.src[l.pos] == '"' || Symbols[string(l.src[l.pos])] ||
+			(l.extended && l.src[l.pos] == '\'') {
+			break
+		}
+		l.errorf(Pos{Line: l.line, Column: l.column}, "unexpected character %q", l.src[l.pos])
+		l.advance()
+	}
+
+	start := Token{Pos: Pos{Line: l.line, Column: l.column}}
+	startPos := l.pos
+	r := l.src[l.pos]
+	switch {
+	case r == '"':
+		start.Kind = StringConst
+		if !l.quoted('"') {
+			// Close the string so its value is everything up to the end of the line
+			l.errorf(start.Pos, "unterminated string constant")
+			start.Text = string(l.src[startPos:l.pos]) + `"`
+			return start, true
+		}
+	case r == '\'':
+		start.Kind = IntConst
+		closed := l.quoted('\'')
+		start.Text = string(l.src[startPos:l.pos])
+		if !closed {
+			l.errorf(start.Pos, "unterminated character constant")
+		} else if _, err := start.Int(); err != nil {
+			l.errorf(start.Pos, "%v", err)
+		} else {
+			return start, true
+		}
+		// Stand in a zero for the malformed constant so it is reported once
+		start.Text = "0"
+		return start, true
+	case isDigit(r):
+		isBaseDigit := isDigit
+		if l.extended && (l.hasPrefix("0x") || l.hasPrefix("0b")) {
+			isBaseDigit = isHexDigit
+			if l.src[l.pos+1] == 'b' {
+				isBaseDigit = isBinaryDigit
+			}
+			l.advance()
+			l.advance()
+		}
+		digitsPos := l.pos
+		for l.pos < len(l.src) && isBaseDigit(l.src[l.pos]) {
+			l.advance()
+		}
+		start.Kind = IntConst
+		if l.pos == digitsPos || (l.pos < len(l.src) && (isIdentifierRune(l.src[l.pos]) || isDigit(l.src[l.pos]))) {
+			// Skip the rest of the malformed constant, keeping its digits
+			l.errorf(start.Pos, "invalid integer constant")
+			start.Text = string(l.src[startPos:l.pos])
+			if l.pos == digitsPos {
+				start.Text = "0"
+			}
+			for l.pos < len(l.src) && (isIdentifierRune(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+				l.advance()
+			}
+			return start, true
+		}
+	case isIdentifierRune(r):
+		for l.pos < len(l.src) && (isIdentifierRune(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.advance()
+		}
+		start.Kind = Identifier
+		if Keywords[string(l.src[startPos:l.pos])] {
+			start.Kind = Keyword
+		}
+	default:
+		l.advance()
+		start.Kind = Symbol
+	}
+
+	start.Text = string(l.src[startPos:l.pos])
+	return start, true
+}
+
+// Reads a string or character constant up to its closing quote, reporting whether the quote was
+// found on the same line. In the extended dialect a backslash escapes the rune after it.
+func (l *Lexer) quoted(quote rune) bool {
+	l.advance()
+	for l.pos < len(l.src) && l.src[l.pos] != quote && l.src[l.pos] != '\n' {
+		if l.extended && l.src[l.pos] == '\\' {
+			pos := Pos{Line: l.line, Column: l.column}
+			l.advance()
+			if l.pos == len(l.src) || l.src[l.pos] == '\n' {
+				break
+			}
+			if _, ok := Escapes[l.src[l.pos]]; !ok {
+				l.errorf(pos, "unknown escape sequence \\%c", l.src[l.pos])
+			}
+		}
+		l.advance()
+	}
+	if l.pos == len(l.src) || l.src[l.pos] != quote {
+		return false
+	}
+	l.advance()
+	return true
+}
+
+// Skips whitespace along with // line comments and /* */ block comments, which may span lines
+func (l *Lexer) skipSpaceAndComments() {
+	for l.pos < len(l.src) {
+		switch {
+		case unicode.IsSpace(l.src[l.pos]):
+			l.advance()
+		case l.hasPrefix("//"):
+			start, startPos := Pos{Line: l.line, Column: l.column}, l.pos
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance()
+			}
+			text := strings.TrimRight(string(l.src[startPos:l.pos]), "\r")
+			l.comments = append(l.comments, Comment{Text: text, Pos: start})
+		case l.hasPrefix("/*"):
+			start, startPos := Pos{Line: l.line, Column: l.column}, l.pos
+			l.advance()
+			l.advance()
+			for !l.hasPrefix("*/") {
+				if l.pos == len(l.src) {
+					l.errorf(start, "unterminated comment")
+					return
+				}
+				l.advance()
+			}
+			l.advance()
+			l.advance()
+			l.comments = append(l.comments, Comment{Text: string(l.src[startPos:l.pos]), Pos: start})
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) hasPrefix(prefix string) bool {
+	for i, r := range []rune(prefix) {
+		if l.pos+i >= len(l.src) || l.src[l.pos+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *Lexer) advance() {
+	if l.src[l.pos] == '\n' {
+		l.line += 1
+		l.column = 1
+	} else {
+		l.column += 1
+	}
+	l.pos += 1
+}
+
+func (l *Lexer) errorf(pos Pos, format string, args ...any) {
+	l.errs = append(l.errs, NewError(l.fileName, l.text, pos, fmt.Sprintf(format, args...)))
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isHexDigit(r rune) bool {
+	return isDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func isBinaryDigit(r rune) bool {
+	return r == '0' || r == '1'
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
@@ -0,0 +1,153 @@
+package token
+
+import (
+	"slices"
+	"testing"
+)
+
+// Reads every token of l, returning the tokens as kind:text and the errors as line:column: message
+func lex(l *Lexer) ([]string, []string) {
+	tokens, errs := []string{}, []string{}
+	for t, ok := l.Next(); ok; t, ok = l.Next() {
+		tokens = append(tokens, t.Kind+":"+t.Text)
+	}
+	for _, err := range l.Errors() {
+		errs = append(errs, err.(*Error).Pos.String()+": "+err.(*Error).Msg)
+	}
+	return tokens, errs
+}
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		extended bool
+		tokens   []string
+		errs     []string
+	}{
+		{
+			name:   "standard",
+			src:    "let x = 12; // twelve\n/* a\n b */ do f(\"a\\n\");",
+			tokens: []string{"keyword:let", "identifier:x", "symbol:=", "integerConstant:12", "symbol:;", "keyword:do", "identifier:f", "symbol:(", `stringConstant:"a\n"`, "symbol:)", "symbol:;"},
+			errs:   []string{},
+		},
+		{
+			name:   "spaces in strings",
+			src:    `let s = "a  b;c";`,
+			tokens: []string{"keyword:let", "identifier:s", "symbol:=", `stringConstant:"a  b;c"`, "symbol:;"},
+			errs:   []string{},
+		},
+		{
+			name:   "comment in the middle of a line",
+			src:    "let y = x /* c */ + 1;",
+			tokens: []string{"keyword:let", "identifier:y", "symbol:=", "identifier:x", "symbol:+", "integerConstant:1", "symbol:;"},
+			errs:   []string{},
+		},
+		{
+			name:   "extended constants in standard jack",
+			src:    "'A' 0x1F",
+			tokens: []string{"identifier:A", "integerConstant:0"},
+			errs:   []string{"1:1: unexpected character '\\''", "1:3: unexpected character '\\''", "1:5: invalid integer constant"},
+		},
+		{
+			name:     "character constants",
+			src:      `'A' ' ' '\n' '\'' '"' '\\'`,
+			extended: true,
+			tokens:   []string{"integerConstant:'A'", "integerConstant:' '", `integerConstant:'\n'`, `integerConstant:'\''`, `integerConstant:'"'`, `integerConstant:'\\'`},
+			errs:     []string{},
+		},
+		{
+			name:     "malformed character constants",
+			src:      "'' 'ab' '\\q' 'a\n",
+			extended: true,
+			tokens:   []string{"integerConstant:0", "integerConstant:0", "integerConstant:'\\q'", "integerConstant:0"},
+			errs:     []string{"1:1: character constant '' is not one character", "1:4: character constant 'ab' is not one character", "1:10: unknown escape sequence \\q", "1:14: unterminated character constant"},
+		},
+		{
+			name:     "hex and binary constants",
+			src:      "0x7FFF 0xff 0b101 0 007",
+			extended: true,
+			tokens:   []string{"integerConstant:0x7FFF", "integerConstant:0xff", "integerConstant:0b101", "integerConstant:0", "integerConstant:007"},
+			errs:     []string{},
+		},
+		{
+			name:     "malformed hex and binary constants",
+			src:      "0x 0x1g 0b102 0X1",
+			extended: true,
+			tokens:   []string{"integerConstant:0", "integerConstant:0x1", "integerConstant:0b10", "integerConstant:0"},
+			errs:     []string{"1:1: invalid integer constant", "1:4: invalid integer constant", "1:9: invalid integer constant", "1:15: invalid integer constant"},
+		},
+		{
+			name:     "string escapes",
+			src:      `"say \"hi\"\n" "a\\" "\t"`,
+			extended: true,
+			tokens:   []string{`stringConstant:"say \"hi\"\n"`, `stringConstant:"a\\"`, `stringConstant:"\t"`},
+			errs:     []string{"1:23: unknown escape sequence \\t"},
+		},
+		{
+			name:     "unterminated escaped string",
+			src:      "\"a\\\" + 1\n",
+			extended: true,
+			tokens:   []string{`stringConstant:"a\" + 1"`},
+			errs:     []string{"1:1: unterminated string constant"},
+		},
+	}
+
+	for _, tc := range tests {
+		l := NewLexer("Main.jack", tc.src)
+		if tc.extended {
+			l = NewExtendedLexer("Main.jack", tc.src)
+		}
+		tokens, errs := lex(l)
+		if !slices.Equal(tokens, tc.tokens) {
+			t.Errorf("Lexing %s read %q, expected %q", tc.name, tokens, tc.tokens)
+		}
+		if !slices.Equal(errs, tc.errs) {
+			t.Errorf("Lexing %s reported %q, expected %q", tc.name, errs, tc.errs)
+		}
+	}
+}
+
+func TestInt(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{text: "32767", expected: 32767},
+		{text: "0x7FFF", expected: 32767},
+		{text: "0x1f", expected: 31},
+		{text: "0b101", expected: 5},
+		{text: "'A'", expected: 65},
+		{text: `'\n'`, expected: NewLine},
+		{text: `'\''`, expected: '\''},
+		{text: "'é'", expected: 233},
+	}
+
+	for _, tc := range tests {
+		value, err := Token{Kind: IntConst, Text: tc.text}.Int()
+		if err != nil {
+			t.Errorf("Failed to read integer constant %s: %v", tc.text, err)
+		} else if value != tc.expected {
+			t.Errorf("Integer constant %s is %d, expected %d", tc.text, value, tc.expected)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "plain", expected: "plain"},
+		{value: `say \"hi\"`, expected: `say "hi"`},
+		{value: `a\\b`, expected: `a\b`},
+		{value: `line\n`, expected: "line\u0080"},
+		{value: `\t`, expected: "t"},
+	}
+
+	for _, tc := range tests {
+		if got := Unescape(tc.value); got != tc.expected {
+			t.Errorf("Unescaped %q to %q, expected %q", tc.value, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package token holds the tokens of Jack source and the lexer producing them.
+package token
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kinds of tokens, spelled like the elements of the course's XML token files
+const (
+	Keyword     = "keyword"
+	Symbol      = "symbol"
+	Identifier  = "identifier"
+	IntConst    = "integerConstant"
+	StringConst = "stringConstant"
+)
+
+var Symbols = map[string]bool{
+	"{": true,
+	"}": true,
+	"(": true,
+	")": true,
+	"[": true,
+	"]": true,
+	".": true,
+	",": true,
+	";": true,
+	"+": true,
+	"-": true,
+	"*": true,
+	"/": true,
+	"&": true,
+	"|": true,
+	"<": true,
+	">": true,
+	"=": true,
+	"~": true,
+}
+
+var Keywords = map[string]bool{
+	"class":       true,
+	"method":      true,
+	"function":    true,
+	"constructor": true,
+	"int":         true,
+	"boolean":     true,
+	"char":        true,
+	"void":        true,
+	"var":         true,
+	"static":      true,
+	"field":       true,
+	"let":         true,
+	"do":          true,
+	"if":          true,
+	"else":        true,
+	"while":       true,
+	"return":      true,
+	"true":        true,
+	"false":       true,
+	"null":        true,
+	"this":        true,
+}
+
+// NewLine is the character code of a newline in the Hack character set
+const NewLine = 128
+
+// Escapes maps the rune after a backslash in the extended dialect's string and character constants
+// to the character it stands for
+var Escapes = map[rune]rune{
+	'n':  NewLine,
+	'"':  '"',
+	'\'': '\'',
+	'\\': '\\',
+}
+
+// Pos is the line and column a token starts at, both counted from 1
+type Pos struct {
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// A Token of Jack source and the position it starts at. The text of a string constant keeps its
+// quotes so it can never be mistaken for a symbol or keyword with the same spelling.
+type Token struct {
+	Kind string
+	Text string
+	Pos  Pos
+}
+
+// Value returns the text of a string constant without its quotes, and the text of other tokens
+func (t Token) Value() string {
+	if t.Kind == StringConst {
+		return t.Text[1 : len(t.Text)-1]
+	}
+	return t.Text
+}
+
+// Int returns the value of an integer constant, which in the extended dialect may also be written in
+// hex as 0x1F, in binary as 0b101 or as a character constant 'A'
+func (t Token) Int() (int, error) {
+	switch {
+	case strings.HasPrefix(t.Text, "'"):
+		runes := []rune(Unescape(t.Text[1 : len(t.Text)-1]))
+		if len(runes) != 1 {
+			return 0, fmt.Errorf("character constant %s is not one character", t.Text)
+		}
+		return int(runes[0]), nil
+	case strings.HasPrefix(t.Text, "0x"):
+		value, err := strconv.ParseInt(t.Text[2:], 16, 64)
+		return int(value), err
+	case strings.HasPrefix(t.Text, "0b"):
+		value, err := strconv.ParseInt(t.Text[2:], 2, 64)
+		return int(value), err
+	}
+	return strconv.Atoi(t.Text)
+}
+
+// Unescape replaces the escape sequences of the extended dialect in the value of a string or
+// character constant. An unknown escape stands for the rune after its backslash.
+func Unescape(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			if e, ok := Escapes[r]; ok {
+				r = e
+			}
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Comment is a // or /* */ comment, with its text including the delimiters
+type Comment struct {
+	Text string
+	Pos  Pos
+}
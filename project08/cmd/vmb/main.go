@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"jackvmt/vmtranslator"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	decode := flag.Bool("d", false, "decode .vmb bytecode files to vm code on stdout")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("Path to vm file or directory for encoding was not provided")
+	}
+
+	ext := ".vm"
+	if *decode {
+		ext = ".vmb"
+	}
+	for _, programPath := range flag.Args() {
+		vmFilePaths := []string{programPath}
+		if !strings.HasSuffix(programPath, ext) {
+			var err error
+			vmFilePaths, err = filepath.Glob(filepath.Join(programPath, "*"+ext))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		for _, vmFilePath := range vmFilePaths {
+			if *decode {
+				vmtranslator.Decode(vmFilePath, os.Stdout)
+				continue
+			}
+
+			// Bytecode is written next to the vm file it encodes
+			vmbFile, err := os.Create(vmFilePath + "b")
+			if err != nil {
+				log.Fatal(err)
+			}
+			vmtranslator.Encode(vmFilePath, vmbFile)
+			if err := vmbFile.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
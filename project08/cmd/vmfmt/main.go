@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"jackvmt/vmtranslator"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	write := flag.Bool("w", false, "write the formatted vm code back to the vm files instead of stdout")
+	cmp := flag.Bool("cmp", false, "compare the commands of two vm files, ignoring formatting")
+	flag.Parse()
+
+	if *cmp {
+		if flag.NArg() != 2 {
+			log.Fatal("Comparing requires the paths to two vm files")
+		}
+		if err := vmtranslator.Compare(flag.Arg(0), flag.Arg(1)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Comparison ended successfully")
+		return
+	}
+
+	if flag.NArg() < 1 {
+		log.Fatal("Path to vm file or directory for formatting was not provided")
+	}
+
+	for _, programPath := range flag.Args() {
+		vmFilePaths := []string{programPath}
+		if !strings.HasSuffix(programPath, ".vm") {
+			var err error
+			vmFilePaths, err = filepath.Glob(filepath.Join(programPath, "*.vm"))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		for _, vmFilePath := range vmFilePaths {
+			src, err := os.ReadFile(vmFilePath)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			formatted := vmtranslator.Format(src)
+			if !*write {
+				if _, err := os.Stdout.Write(formatted); err != nil {
+					log.Fatal(err)
+				}
+				continue
+			}
+			if err := os.WriteFile(vmFilePath, formatted, 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"jackvmt/vmtranslator"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	write := flag.Bool("w", false, "write the optimized vm code back to the vm files instead of stdout")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("Path to vm file or directory for optimization was not provided")
+	}
+
+	for _, programPath := range flag.Args() {
+		// Only a directory is known to hold the whole program
+		vmFilePaths := []string{programPath}
+		var programFilePaths []string
+		if !strings.HasSuffix(programPath, ".vm") {
+			var err error
+			vmFilePaths, err = filepath.Glob(filepath.Join(programPath, "*.vm"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			programFilePaths = vmFilePaths
+		}
+
+		if !*write {
+			for _, vmFilePath := range vmFilePaths {
+				vmtranslator.Optimize(vmFilePath, programFilePaths, os.Stdout)
+			}
+			continue
+		}
+
+		// Every file is optimized before any is written back, as each is optimized knowing the others
+		optimized := make([]bytes.Buffer, len(vmFilePaths))
+		for i, vmFilePath := range vmFilePaths {
+			vmtranslator.Optimize(vmFilePath, programFilePaths, &optimized[i])
+		}
+		for i, vmFilePath := range vmFilePaths {
+			if err := os.WriteFile(vmFilePath, optimized[i].Bytes(), 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
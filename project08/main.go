@@ -1,15 +1,63 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"jackvmt/vmtranslator"
 	"log"
 	"os"
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	target := flag.String("target", vmtranslator.TargetHack, "output language: hack, c or wat")
+	stackReport := flag.Bool("stack-report", false, "print the stack usage of each function")
+	stackCheck := flag.Bool("stack-check", false, "halt in VM.STACK_OVERFLOW when a function entry would overflow the stack")
+	tailCalls := flag.Bool("tail-calls", false, "make a call immediately followed by return reuse the current frame")
+	allocateRegisters := flag.Bool("regalloc", false, "keep the most used locals and arguments of leaf functions in spare static cells")
+	optimize := flag.Bool("O", false, "optimize the vm code before translating it")
+	inline := flag.Int("inline", 0, "inline calls to leaf functions of at most this many commands")
+	report := flag.Bool("report", false, "print the ROM used by each function and vm command")
+	bootstrap := flag.String("bootstrap", "auto", "write the bootstrap code: auto (when there is a Sys.vm), force or none")
+	entry := flag.String("entry", "Sys.init", "function the bootstrap code calls")
+	onReturn := flag.String("on-return", vmtranslator.OnReturnHalt, "once the entry function returns: halt, reset or trap")
+	trap := flag.String("trap", "Sys.halt", "function called when the entry function returns with -on-return trap")
+
+	layout := vmtranslator.CourseLayout
+	flag.IntVar(&layout.StackBase, "stack-base", layout.StackBase, "address the stack starts at, the initial SP of the bootstrap code")
+	flag.IntVar(&layout.StackLimit, "stack-limit", layout.StackLimit, "address the stack must stay below")
+	flag.IntVar(&layout.TempBase, "temp-base", layout.TempBase, "address of temp 0")
+	flag.IntVar(&layout.StaticStart, "static-start", layout.StaticStart, "first address of static variables")
+	flag.IntVar(&layout.StaticLimit, "static-limit", layout.StaticLimit, "last address of static variables")
+	flag.Func("registers", "addresses of the frame, return address and pop registers (default 13,14,15)", func(value string) error {
+		_, err := fmt.Sscanf(value, "%d,%d,%d", &layout.Registers[0], &layout.Registers[1], &layout.Registers[2])
+		return err
+	})
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatal("Path to vm file or directory for translation was not provided")
 	}
-	programPath := os.Args[1]
-	vmtranslator.Translate(programPath)
+	programPath := flag.Arg(0)
+	opts := vmtranslator.Options{
+		Target:            *target,
+		StackCheck:        *stackCheck,
+		TailCalls:         *tailCalls,
+		AllocateRegisters: *allocateRegisters,
+		Optimize:          *optimize,
+		Inline:            *inline,
+		Layout:            &layout,
+		Entry:             *entry,
+		OnReturn:          *onReturn,
+		Trap:              *trap,
+	}
+	if *bootstrap != "auto" {
+		opts.Bootstrap = *bootstrap
+	}
+	if *stackReport {
+		opts.StackReport = os.Stdout
+	}
+	if *report {
+		opts.Report = os.Stdout
+	}
+	vmtranslator.Translate(programPath, opts)
 }
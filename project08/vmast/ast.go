@@ -0,0 +1,105 @@
+// Package vmast holds a typed representation of vm code, a streaming parser producing it and a
+// printer writing it back out as text.
+package vmast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Pos is the line and column a command starts at, both counted from 1
+type Pos struct {
+	Line   int
+	Column int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Command is one of the command types below. String returns the command as vm code.
+type Command interface {
+	Position() Pos
+	String() string
+}
+
+// Node records where a command was parsed from
+type Node struct {
+	Pos Pos
+}
+
+func (n Node) Position() Pos {
+	return n.Pos
+}
+
+// Arithmetic is one of add, sub, neg, eq, gt, lt, and, or and not
+type Arithmetic struct {
+	Node
+	Op string
+}
+
+type Push struct {
+	Node
+	Segment string
+	Index   int
+}
+
+type Pop struct {
+	Node
+	Segment string
+	Index   int
+}
+
+type Label struct {
+	Node
+	Name string
+}
+
+type Goto struct {
+	Node
+	Label string
+}
+
+type IfGoto struct {
+	Node
+	Label string
+}
+
+type Function struct {
+	Node
+	Name  string
+	NVars int
+}
+
+type Call struct {
+	Node
+	Name  string
+	NArgs int
+}
+
+type Return struct {
+	Node
+}
+
+func (c Arithmetic) String() string { return c.Op }
+func (c Push) String() string       { return "push " + c.Segment + " " + strconv.Itoa(c.Index) }
+func (c Pop) String() string        { return "pop " + c.Segment + " " + strconv.Itoa(c.Index) }
+func (c Label) String() string      { return "label " + c.Name }
+func (c Goto) String() string       { return "goto " + c.Label }
+func (c IfGoto) String() string     { return "if-goto " + c.Label }
+func (c Function) String() string   { return "function " + c.Name + " " + strconv.Itoa(c.NVars) }
+func (c Call) String() string       { return "call " + c.Name + " " + strconv.Itoa(c.NArgs) }
+func (c Return) String() string     { return "return" }
+
+// Print writes commands to w as vm code, one per line
+func Print(w io.Writer, commands []Command) error {
+	bw := bufio.NewWriter(w)
+	for _, command := range commands {
+		if _, err := bw.WriteString(command.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
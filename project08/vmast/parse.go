@@ -0,0 +1,168 @@
+package vmast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Error is a syntax error along with the position of the offending command
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+var segmentLimits = map[string]int{
+	"constant": 32767,
+	"argument": -1,
+	"local":    -1,
+	"static":   -1,
+	"this":     -1,
+	"that":     -1,
+	"pointer":  1,
+	"temp":     7,
+}
+
+// Commands reads vm code from r a line at a time, yielding each command as it is parsed. Blank
+// lines and comments are skipped. Iteration stops after the first error, which is yielded with a
+// nil command.
+func Commands(r io.Reader) iter.Seq2[Command, error] {
+	return func(yield func(Command, error) bool) {
+		scanner := bufio.NewScanner(r)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text, _, _ := strings.Cut(scanner.Text(), "//")
+			fields := strings.Fields(text)
+			if len(fields) == 0 {
+				continue
+			}
+
+			pos := Pos{Line: line, Column: strings.IndexFunc(text, func(r rune) bool { return !unicode.IsSpace(r) }) + 1}
+			command, err := parseCommand(Node{Pos: pos}, fields)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(command, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Parse reads all the commands of r
+func Parse(r io.Reader) ([]Command, error) {
+	commands := []Command{}
+	for command, err := range Commands(r) {
+		if err != nil {
+			return commands, err
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+func parseCommand(node Node, fields []string) (Command, error) {
+	errorf := func(format string, args ...any) error {
+		return &Error{Pos: node.Pos, Msg: fmt.Sprintf(format, args...)}
+	}
+	wantArgs := func(n int) error {
+		if len(fields)-1 != n {
+			return errorf("%s takes %d arguments, got %d", fields[0], n, len(fields)-1)
+		}
+		return nil
+	}
+	number := func(arg string) (int, error) {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return 0, errorf("invalid number %s", arg)
+		}
+		return n, nil
+	}
+	symbol := func(arg string) (string, error) {
+		if arg[0] >= '0' && arg[0] <= '9' {
+			return "", errorf("invalid symbol %s", arg)
+		}
+		return arg, nil
+	}
+
+	switch fields[0] {
+	case "add", "sub", "neg", "eq", "gt", "lt", "and", "or", "not":
+		if err := wantArgs(0); err != nil {
+			return nil, err
+		}
+		return Arithmetic{Node: node, Op: fields[0]}, nil
+	case "push", "pop":
+		if err := wantArgs(2); err != nil {
+			return nil, err
+		}
+		segment := fields[1]
+		limit, ok := segmentLimits[segment]
+		if !ok {
+			return nil, errorf("invalid segment %s", segment)
+		}
+		index, err := number(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		if limit != -1 && index > limit {
+			return nil, errorf("%s %d is out of range", segment, index)
+		}
+		if fields[0] == "pop" {
+			if segment == "constant" {
+				return nil, errorf("cannot pop to constant")
+			}
+			return Pop{Node: node, Segment: segment, Index: index}, nil
+		}
+		return Push{Node: node, Segment: segment, Index: index}, nil
+	case "label", "goto", "if-goto":
+		if err := wantArgs(1); err != nil {
+			return nil, err
+		}
+		label, err := symbol(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		switch fields[0] {
+		case "label":
+			return Label{Node: node, Name: label}, nil
+		case "goto":
+			return Goto{Node: node, Label: label}, nil
+		}
+		return IfGoto{Node: node, Label: label}, nil
+	case "function", "call":
+		if err := wantArgs(2); err != nil {
+			return nil, err
+		}
+		name, err := symbol(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		n, err := number(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		if fields[0] == "function" {
+			return Function{Node: node, Name: name, NVars: n}, nil
+		}
+		return Call{Node: node, Name: name, NArgs: n}, nil
+	case "return":
+		if err := wantArgs(0); err != nil {
+			return nil, err
+		}
+		return Return{Node: node}, nil
+	}
+	return nil, errorf("invalid command %s", strings.Join(fields, " "))
+}
@@ -0,0 +1,115 @@
+package vmast
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := "// Adds one\nfunction Main.inc 1\n    push argument 0 // n\n\tpush constant 1\nadd\nif-goto END\nlabel END\ncall Math.abs 1\npop temp 7\nreturn\n"
+	expected := []Command{
+		Function{Node: Node{Pos{2, 1}}, Name: "Main.inc", NVars: 1},
+		Push{Node: Node{Pos{3, 5}}, Segment: "argument", Index: 0},
+		Push{Node: Node{Pos{4, 2}}, Segment: "constant", Index: 1},
+		Arithmetic{Node: Node{Pos{5, 1}}, Op: "add"},
+		IfGoto{Node: Node{Pos{6, 1}}, Label: "END"},
+		Label{Node: Node{Pos{7, 1}}, Name: "END"},
+		Call{Node: Node{Pos{8, 1}}, Name: "Math.abs", NArgs: 1},
+		Pop{Node: Node{Pos{9, 1}}, Segment: "temp", Index: 7},
+		Return{Node: Node{Pos{10, 1}}},
+	}
+
+	commands, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("Failed to parse vm code: %v", err)
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("Parsed to %v, expected %v", commands, expected)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{src: "push constant", expected: "1:1: push takes 2 arguments, got 1"},
+		{src: "add\n  pop constant 1", expected: "2:3: cannot pop to constant"},
+		{src: "push heap 0", expected: "1:1: invalid segment heap"},
+		{src: "push temp 8", expected: "1:1: temp 8 is out of range"},
+		{src: "push pointer 2", expected: "1:1: pointer 2 is out of range"},
+		{src: "push constant 32768", expected: "1:1: constant 32768 is out of range"},
+		{src: "push local -1", expected: "1:1: invalid number -1"},
+		{src: "call Main.f x", expected: "1:1: invalid number x"},
+		{src: "label 1LOOP", expected: "1:1: invalid symbol 1LOOP"},
+		{src: "return 0", expected: "1:1: return takes 0 arguments, got 1"},
+		{src: "jump LOOP", expected: "1:1: invalid command jump LOOP"},
+	}
+
+	for _, tc := range tests {
+		_, err := Parse(strings.NewReader(tc.src))
+		var syntaxErr *Error
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parsing %q returned %v, expected a syntax error", tc.src, err)
+			continue
+		}
+		if err.Error() != tc.expected {
+			t.Errorf("Parsing %q failed with %q, expected %q", tc.src, err, tc.expected)
+		}
+	}
+}
+
+// Printing the commands of every vm file in the repo and parsing them again gives the same commands
+func TestPrintRoundTrip(t *testing.T) {
+	vmFilePaths := []string{}
+	err := filepath.WalkDir("../..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".vm") {
+			vmFilePaths = append(vmFilePaths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to list vm files: %v", err)
+	}
+
+	for _, vmFilePath := range vmFilePaths {
+		f, err := os.Open(vmFilePath)
+		if err != nil {
+			t.Fatalf("Failed to open vm file %s: %v", vmFilePath, err)
+		}
+		commands, err := Parse(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", vmFilePath, err)
+			continue
+		}
+
+		var b strings.Builder
+		if err := Print(&b, commands); err != nil {
+			t.Fatalf("Failed to print %s: %v", vmFilePath, err)
+		}
+		reparsed, err := Parse(strings.NewReader(b.String()))
+		if err != nil {
+			t.Errorf("Failed to parse printed %s: %v", vmFilePath, err)
+			continue
+		}
+		if len(reparsed) != len(commands) {
+			t.Errorf("Printed %s has %d commands, expected %d", vmFilePath, len(reparsed), len(commands))
+			continue
+		}
+		for i := range commands {
+			if reparsed[i].String() != commands[i].String() {
+				t.Errorf("Command %d of %s printed as %q, expected %q", i+1, vmFilePath, reparsed[i], commands[i])
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package vmtranslator
+
+import (
+	"jackvmt/vmast"
+	"log"
+	"slices"
+)
+
+const (
+	// Writes the bootstrap code when the program has a Sys.vm
+	BootstrapAuto  = ""
+	BootstrapForce = "force"
+	BootstrapNone  = "none"
+
+	// Loops forever once the entry function returns
+	OnReturnHalt = "halt"
+	// Runs the bootstrap code again, starting the program over
+	OnReturnReset = "reset"
+	// Calls the trap function, then loops forever if it returns
+	OnReturnTrap = "trap"
+)
+
+// How the bootstrap code starts a program, resolved from the translation options
+type bootstrap struct {
+	enabled  bool
+	entry    string
+	onReturn string
+	trap     string
+}
+
+func newBootstrap(opts Options, vmFiles []vmFile, hasSysVm bool) bootstrap {
+	boot := bootstrap{
+		entry:    opts.Entry,
+		onReturn: opts.OnReturn,
+		trap:     opts.Trap,
+	}
+	if boot.entry == "" {
+		boot.entry = "Sys.init"
+	}
+	if boot.onReturn == "" {
+		boot.onReturn = OnReturnHalt
+	}
+	if boot.trap == "" {
+		boot.trap = "Sys.halt"
+	}
+
+	switch opts.Bootstrap {
+	case BootstrapAuto:
+		boot.enabled = hasSysVm
+	case BootstrapForce:
+		boot.enabled = true
+	case BootstrapNone:
+	default:
+		log.Fatalf("vmtranslator.newBootstrap: unknown bootstrap mode %s\n", opts.Bootstrap)
+	}
+	if !slices.Contains([]string{OnReturnHalt, OnReturnReset, OnReturnTrap}, boot.onReturn) {
+		log.Fatalf("vmtranslator.newBootstrap: unknown entry return behavior %s\n", boot.onReturn)
+	}
+	if !boot.enabled {
+		return boot
+	}
+
+	// The bootstrap code jumps to these functions, so they have to be part of the program
+	functions := map[string]bool{}
+	for _, vmFile := range vmFiles {
+		for _, command := range vmFile.commands {
+			if fn, ok := command.(vmast.Function); ok {
+				functions[fn.Name] = true
+			}
+		}
+	}
+	if !functions[boot.entry] {
+		log.Fatalf("vmtranslator.newBootstrap: entry function %s is not defined by the program\n", boot.entry)
+	}
+	if boot.onReturn == OnReturnTrap && !functions[boot.trap] {
+		log.Fatalf("vmtranslator.newBootstrap: trap function %s is not defined by the program\n", boot.trap)
+	}
+
+	return boot
+}
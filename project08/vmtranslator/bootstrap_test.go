@@ -0,0 +1,125 @@
+package vmtranslator
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a program made of a single Main.vm into a temporary directory, translates it to
+// WebAssembly text with opts and runs it, returning the RAM it leaves
+func runWatProgram(t *testing.T, program string, opts Options) func(addr int) int {
+	t.Helper()
+
+	programDir := filepath.Join(t.TempDir(), "Program")
+	if err := os.MkdirAll(programDir, 0755); err != nil {
+		t.Fatalf("Failed to create program directory %s: %v", programDir, err)
+	}
+	vmFilePath := filepath.Join(programDir, "Main.vm")
+	if err := os.WriteFile(vmFilePath, []byte(program), 0644); err != nil {
+		t.Fatalf("Failed to create vm file %s: %v", vmFilePath, err)
+	}
+
+	opts.Target = TargetWat
+	Translate(programDir, opts)
+
+	watFilePath := filepath.Join(programDir, "Program.wat")
+	src, err := os.ReadFile(watFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read generated output file %s: %v", watFilePath, err)
+	}
+	m, err := loadWatModule(string(src))
+	if err != nil {
+		t.Fatalf("Invalid module %s: %v", watFilePath, err)
+	}
+	if err := m.run("main", 1_000_000); err != nil {
+		t.Fatalf("Failed to run %s: %v", watFilePath, err)
+	}
+
+	return func(addr int) int {
+		return int(int16(binary.LittleEndian.Uint16(m.mem[addr*2:])))
+	}
+}
+
+func TestBootstrapOptions(t *testing.T) {
+	program := strings.Join([]string{
+		"function Main.main 0",
+		"push static 0",
+		"push constant 1",
+		"add",
+		"pop static 0",
+		"push static 0",
+		"push constant 3",
+		"eq",
+		"if-goto DONE",
+		"push constant 0",
+		"return",
+		"label DONE",
+		"label STOP",
+		"goto STOP",
+		"function Main.trap 0",
+		"push constant 9",
+		"pop static 1",
+		"push constant 0",
+		"return",
+	}, "\n")
+	stackBase300 := CourseLayout
+	stackBase300.StackBase = 300
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected map[int]int
+	}{
+		{
+			name:     "halt",
+			opts:     Options{Bootstrap: BootstrapForce, Entry: "Main.main"},
+			expected: map[int]int{0: 257, 16: 1, 17: 0},
+		},
+		{
+			name:     "reset",
+			opts:     Options{Bootstrap: BootstrapForce, Entry: "Main.main", OnReturn: OnReturnReset},
+			expected: map[int]int{16: 3, 17: 0},
+		},
+		{
+			name:     "trap",
+			opts:     Options{Bootstrap: BootstrapForce, Entry: "Main.main", OnReturn: OnReturnTrap, Trap: "Main.trap"},
+			expected: map[int]int{16: 1, 17: 9},
+		},
+		{
+			name:     "stack base",
+			opts:     Options{Bootstrap: BootstrapForce, Entry: "Main.main", Layout: &stackBase300},
+			expected: map[int]int{0: 301, 16: 1},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ram := runWatProgram(t, program, tc.opts)
+			for addr, value := range tc.expected {
+				if got := ram(addr); got != value {
+					t.Errorf("RAM[%d] = %d, expected %d", addr, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestBootstrapNone(t *testing.T) {
+	programDir := copyVmProgram(t, "../vm/FunctionCalls/FibonacciElement")
+	Translate(programDir, Options{Bootstrap: BootstrapNone})
+
+	asmFilePath := filepath.Join(programDir, "FibonacciElement.asm")
+	content, err := os.ReadFile(asmFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read generated output file %s: %v", asmFilePath, err)
+	}
+	if strings.Contains(string(content), "Bootstrap$") {
+		t.Errorf("Expected no bootstrap code in generated output")
+	}
+	if !strings.Contains(string(content), "(FibonacciElement.END_LOOP)") {
+		t.Errorf("Expected an end of program loop in generated output")
+	}
+}
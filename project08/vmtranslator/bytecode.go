@@ -0,0 +1,280 @@
+package vmtranslator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"jackvmt/vmast"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Bytecode files (.vmb) hold the commands of a vm file in a compact binary form:
+//
+//	magic    "VMB1"
+//	statics  uvarint, size of the file's static segment
+//	names    uvarint count, then each name as a uvarint length and its bytes
+//	commands uvarint count, then each command as its opcode and operands
+//
+// Opcodes number the commands in the order below. Arithmetic commands take the operation as a byte,
+// push and pop the segment as a byte and the index as a uvarint, label, goto and if-goto the label's
+// index in names, and function and call the function's index in names followed by nVars or nArgs.
+const vmbMagic = "VMB1"
+
+const (
+	vmbArithmetic = iota
+	vmbPush
+	vmbPop
+	vmbLabel
+	vmbGoto
+	vmbIfGoto
+	vmbFunction
+	vmbCall
+	vmbReturn
+)
+
+var vmbOperations = []string{"add", "sub", "neg", "eq", "gt", "lt", "and", "or", "not"}
+var vmbSegments = []string{"constant", "argument", "local", "static", "this", "that", "pointer", "temp"}
+
+// Encode writes the bytecode of a vm file to out
+func Encode(vmFilePath string, out io.Writer) {
+	if _, err := out.Write(encodeVmFile(parseVmFile(vmFilePath))); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Decode writes the vm code of a bytecode file to out
+func Decode(vmbFilePath string, out io.Writer) {
+	vmFile := parseVmbFile(vmbFilePath)
+	if err := vmast.Print(out, vmFile.commands); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseVmbFile(vmbFilePath string) vmFile {
+	data, err := os.ReadFile(vmbFilePath)
+	if err != nil {
+		log.Fatalf("vmtranslator.parseVmbFile: %e\n", err)
+	}
+
+	fname, _ := strings.CutSuffix(filepath.Base(vmbFilePath), ".vmb")
+	vmFile, err := decodeVmFile(fname, data)
+	if err != nil {
+		log.Fatalf("vmtranslator.parseVmbFile: %s: %v\n", vmbFilePath, err)
+	}
+	return vmFile
+}
+
+func encodeVmFile(vmFile vmFile) []byte {
+	names := []string{}
+	nameIds := map[string]int{}
+	intern := func(name string) int {
+		id, ok := nameIds[name]
+		if !ok {
+			id = len(names)
+			nameIds[name] = id
+			names = append(names, name)
+		}
+		return id
+	}
+
+	statics := 0
+	var code []byte
+	segment := func(segment string, index int) {
+		if segment == "static" {
+			statics = max(statics, index+1)
+		}
+		code = append(code, byte(vmbIndex(vmbSegments, segment)))
+		code = binary.AppendUvarint(code, uint64(index))
+	}
+	for _, command := range vmFile.commands {
+		switch c := command.(type) {
+		case vmast.Arithmetic:
+			code = append(code, vmbArithmetic, byte(vmbIndex(vmbOperations, c.Op)))
+		case vmast.Push:
+			code = append(code, vmbPush)
+			segment(c.Segment, c.Index)
+		case vmast.Pop:
+			code = append(code, vmbPop)
+			segment(c.Segment, c.Index)
+		case vmast.Label:
+			code = append(code, vmbLabel)
+			code = binary.AppendUvarint(code, uint64(intern(c.Name)))
+		case vmast.Goto:
+			code = append(code, vmbGoto)
+			code = binary.AppendUvarint(code, uint64(intern(c.Label)))
+		case vmast.IfGoto:
+			code = append(code, vmbIfGoto)
+			code = binary.AppendUvarint(code, uint64(intern(c.Label)))
+		case vmast.Function:
+			code = append(code, vmbFunction)
+			code = binary.AppendUvarint(code, uint64(intern(c.Name)))
+			code = binary.AppendUvarint(code, uint64(c.NVars))
+		case vmast.Call:
+			code = append(code, vmbCall)
+			code = binary.AppendUvarint(code, uint64(intern(c.Name)))
+			code = binary.AppendUvarint(code, uint64(c.NArgs))
+		case vmast.Return:
+			code = append(code, vmbReturn)
+		}
+	}
+
+	data := []byte(vmbMagic)
+	data = binary.AppendUvarint(data, uint64(statics))
+	data = binary.AppendUvarint(data, uint64(len(names)))
+	for _, name := range names {
+		data = binary.AppendUvarint(data, uint64(len(name)))
+		data = append(data, name...)
+	}
+	data = binary.AppendUvarint(data, uint64(len(vmFile.commands)))
+	return append(data, code...)
+}
+
+func vmbIndex(values []string, value string) int {
+	i := slices.Index(values, value)
+	if i == -1 {
+		log.Fatalf("vmtranslator.encodeVmFile: invalid operand %s", value)
+	}
+	return i
+}
+
+var errVmbTruncated = errors.New("bytecode is truncated")
+
+// Reads bytecode, checking every operand so corrupt input is reported rather than translated
+func decodeVmFile(fname string, data []byte) (vmFile, error) {
+	r := bytes.NewReader(data)
+	readUvarint := func() (int, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > 1<<31 {
+			return 0, errVmbTruncated
+		}
+		return int(n), nil
+	}
+
+	magic := make([]byte, len(vmbMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != vmbMagic {
+		return vmFile{}, errors.New("not a vm bytecode file")
+	}
+
+	statics, err := readUvarint()
+	if err != nil {
+		return vmFile{}, err
+	}
+	nNames, err := readUvarint()
+	if err != nil {
+		return vmFile{}, err
+	}
+	names := []string{}
+	for range nNames {
+		size, err := readUvarint()
+		if err != nil {
+			return vmFile{}, err
+		}
+		// A corrupt size is rejected before it is allocated
+		if size > r.Len() {
+			return vmFile{}, errVmbTruncated
+		}
+		name := make([]byte, size)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return vmFile{}, errVmbTruncated
+		}
+		names = append(names, string(name))
+	}
+	readName := func() (string, error) {
+		id, err := readUvarint()
+		if err != nil {
+			return "", err
+		}
+		if id >= len(names) {
+			return "", fmt.Errorf("name %d out of range", id)
+		}
+		return names[id], nil
+	}
+
+	nCommands, err := readUvarint()
+	if err != nil {
+		return vmFile{}, err
+	}
+	vmFile := vmFile{fname: fname}
+	for i := range nCommands {
+		opcode, err := r.ReadByte()
+		if err != nil {
+			return vmFile, errVmbTruncated
+		}
+		var command vmast.Command
+		switch int(opcode) {
+		case vmbArithmetic:
+			op, err := r.ReadByte()
+			if err != nil {
+				return vmFile, errVmbTruncated
+			}
+			if int(op) >= len(vmbOperations) {
+				return vmFile, fmt.Errorf("command %d: invalid operation %d", i, op)
+			}
+			command = vmast.Arithmetic{Op: vmbOperations[op]}
+		case vmbPush, vmbPop:
+			segment, err := r.ReadByte()
+			if err != nil {
+				return vmFile, errVmbTruncated
+			}
+			if int(segment) >= len(vmbSegments) {
+				return vmFile, fmt.Errorf("command %d: invalid segment %d", i, segment)
+			}
+			index, err := readUvarint()
+			if err != nil {
+				return vmFile, err
+			}
+			if vmbSegments[segment] == "static" && index >= statics {
+				return vmFile, fmt.Errorf("command %d: static %d is outside the file's %d statics", i, index, statics)
+			}
+			command = vmast.Push{Segment: vmbSegments[segment], Index: index}
+			if opcode == vmbPop {
+				if vmbSegments[segment] == "constant" {
+					return vmFile, fmt.Errorf("command %d: cannot pop to constant", i)
+				}
+				command = vmast.Pop{Segment: vmbSegments[segment], Index: index}
+			}
+		case vmbLabel, vmbGoto, vmbIfGoto:
+			label, err := readName()
+			if err != nil {
+				return vmFile, err
+			}
+			switch int(opcode) {
+			case vmbLabel:
+				command = vmast.Label{Name: label}
+			case vmbGoto:
+				command = vmast.Goto{Label: label}
+			default:
+				command = vmast.IfGoto{Label: label}
+			}
+		case vmbFunction, vmbCall:
+			name, err := readName()
+			if err != nil {
+				return vmFile, err
+			}
+			n, err := readUvarint()
+			if err != nil {
+				return vmFile, err
+			}
+			command = vmast.Call{Name: name, NArgs: n}
+			if opcode == vmbFunction {
+				command = vmast.Function{Name: name, NVars: n}
+			}
+		case vmbReturn:
+			command = vmast.Return{}
+		default:
+			return vmFile, fmt.Errorf("command %d: invalid opcode %d", i, opcode)
+		}
+		vmFile.commands = append(vmFile.commands, command)
+	}
+
+	if r.Len() > 0 {
+		return vmFile, fmt.Errorf("%d bytes after the last command", r.Len())
+	}
+	return vmFile, nil
+}
@@ -0,0 +1,102 @@
+package vmtranslator
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"jackvmt/vmast"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	vmFilePaths := []string{}
+	err := filepath.WalkDir("../..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".vm") {
+			vmFilePaths = append(vmFilePaths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to list vm files: %v", err)
+	}
+	if len(vmFilePaths) == 0 {
+		t.Fatal("Found no vm files in the repo")
+	}
+
+	for _, vmFilePath := range vmFilePaths {
+		vmFile := parseVmFile(vmFilePath)
+		decoded, err := decodeVmFile(vmFile.fname, encodeVmFile(vmFile))
+		if err != nil {
+			t.Errorf("Failed to decode %s: %v", vmFilePath, err)
+			continue
+		}
+		// Bytecode keeps no positions, so the commands are compared as vm code
+		sameCode := func(a, b vmast.Command) bool { return a.String() == b.String() }
+		if !slices.EqualFunc(decoded.commands, vmFile.commands, sameCode) {
+			t.Errorf("Decoded commands of %s differ from the original", vmFilePath)
+		}
+	}
+}
+
+func TestBytecodeCorrupt(t *testing.T) {
+	vmFile := parseVmFile("../vm/FunctionCalls/StaticsTest/Class1.vm")
+	data := encodeVmFile(vmFile)
+
+	for _, corrupt := range [][]byte{
+		data[:len(data)-1],
+		append(slices.Clone(data), 0),
+		append([]byte("VMB0"), data[4:]...),
+	} {
+		if _, err := decodeVmFile(vmFile.fname, corrupt); err == nil {
+			t.Errorf("Expected an error decoding corrupt bytecode %v", corrupt)
+		}
+	}
+	// A name claiming to be a gigabyte long in a file of a few bytes
+	huge := binary.AppendUvarint([]byte(vmbMagic+"\x00\x01"), 1<<30)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := decodeVmFile(vmFile.fname, huge)
+	runtime.ReadMemStats(&after)
+	if err != errVmbTruncated {
+		t.Errorf("Decoding a name longer than the bytecode reported %v, expected %v", err, errVmbTruncated)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Decoding a name longer than the bytecode allocated %d bytes", allocated)
+	}
+}
+
+func TestTranslateBytecode(t *testing.T) {
+	programDir := copyVmProgram(t, "../vm/FunctionCalls/StaticsTest")
+	Translate(programDir, Options{})
+	expected, err := os.ReadFile(filepath.Join(programDir, "StaticsTest.asm"))
+	if err != nil {
+		t.Fatalf("Failed to read generated output file: %v", err)
+	}
+
+	// Replace the vm files of the program with their bytecode
+	vmFilePaths, _ := filepath.Glob(filepath.Join(programDir, "*.vm"))
+	for _, vmFilePath := range vmFilePaths {
+		if err := os.WriteFile(vmFilePath+"b", encodeVmFile(parseVmFile(vmFilePath)), 0644); err != nil {
+			t.Fatalf("Failed to write bytecode of %s: %v", vmFilePath, err)
+		}
+		if err := os.Remove(vmFilePath); err != nil {
+			t.Fatalf("Failed to remove %s: %v", vmFilePath, err)
+		}
+	}
+
+	Translate(programDir, Options{})
+	got, err := os.ReadFile(filepath.Join(programDir, "StaticsTest.asm"))
+	if err != nil {
+		t.Fatalf("Failed to read generated output file: %v", err)
+	}
+	if string(got) != string(expected) {
+		t.Errorf("Translating bytecode differs from translating vm code")
+	}
+}
@@ -2,29 +2,60 @@ package vmtranslator
 
 import (
 	"fmt"
+	"io"
+	"jackvmt/vmast"
 	"log"
-	"os"
 	"strconv"
 	"strings"
 )
 
 const (
-	tempBase    = 5
 	pointerBase = 3
-	regR13      = "R13"
-	regR14      = "R14"
-	regR15      = "R15"
+
+	stackOverflowLabel = "VM.STACK_OVERFLOW"
 )
 
+// Not a vm command: a call immediately followed by return, marked by markTailCalls
+type tailCall struct {
+	vmast.Call
+}
+
+// Replaces each call immediately followed by return with a tail call. No label separates the two,
+// so the return can only be reached from the call.
+func markTailCalls(file vmFile) vmFile {
+	commands := []vmast.Command{}
+	for i := 0; i < len(file.commands); i++ {
+		command := file.commands[i]
+		if call, ok := command.(vmast.Call); ok && i+1 < len(file.commands) {
+			if _, ok := file.commands[i+1].(vmast.Return); ok {
+				command = tailCall{call}
+				i++
+			}
+		}
+		commands = append(commands, command)
+	}
+	return vmFile{fname: file.fname, commands: commands}
+}
+
+// A codeWriter owns the label counter for everything it writes, so each vm file is given its own
+// writer and the generated labels are namespaced by the file (or function) they were written for.
 type codeWriter struct {
-	outfile         *os.File
+	out             io.Writer
 	currFname       string
+	currFunction    string
 	strBuilder      *strings.Builder
 	numLabels       int
 	segmentMappings map[string]string
+	// Stack words each function uses, set when the writer guards function entries against overflow
+	stackLimits map[string]int
+	// Instruction counts of everything written, recorded when a ROM report is requested
+	stats  *romStats
+	layout MemoryLayout
+	// Addresses of the program's static variables keyed by File.index
+	statics map[string]int
 }
 
-func newCodeWriter(outfile *os.File) codeWriter {
+func newCodeWriter(out io.Writer, layout MemoryLayout) codeWriter {
 	segmentMappings := map[string]string{
 		"local":    "LCL",
 		"argument": "ARG",
@@ -35,22 +66,74 @@ func newCodeWriter(outfile *os.File) codeWriter {
 	var b strings.Builder
 
 	return codeWriter{
-		outfile:         outfile,
+		out:             out,
 		currFname:       "",
+		currFunction:    "",
 		strBuilder:      &b,
 		numLabels:       0,
 		segmentMappings: segmentMappings,
+		layout:          layout,
 	}
 }
 
-func (cw *codeWriter) writeInit() {
-	cw.strBuilder.WriteString("@256\n")
+func (cw *codeWriter) writeInit(boot bootstrap) {
+	fmt.Fprintf(cw.strBuilder, "@%d\n", cw.layout.StackBase)
 	cw.strBuilder.WriteString("D=A\n")
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("M=D\n")
-	cw.writeCall("Sys.init", 0)
+	cw.writeCall(boot.entry, 0)
+
+	switch boot.onReturn {
+	case OnReturnReset:
+		// The bootstrap code starts at the first ROM address
+		cw.strBuilder.WriteString("@0\n")
+		cw.strBuilder.WriteString("0;JEQ\n")
+	case OnReturnTrap:
+		cw.writeCall(boot.trap, 0)
+		cw.writeHalt()
+	default:
+		cw.writeHalt()
+	}
+
+	if cw.stats != nil {
+		cw.stats.add(cw.currFname, "bootstrap", cw.strBuilder.String())
+	}
+	if _, err := io.WriteString(cw.out, cw.strBuilder.String()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (cw *codeWriter) writeHalt() {
+	fmt.Fprintf(cw.strBuilder, "(%s$HALT)\n", cw.labelScope())
+	fmt.Fprintf(cw.strBuilder, "@%s$HALT\n", cw.labelScope())
+	cw.strBuilder.WriteString("0;JEQ\n")
+}
+
+// Makes the writer test on each function entry that the function's own stack usage fits below the
+// heap, jumping to the overflow routine otherwise. The usage includes the frames the function's calls
+// push, since a callee only gets to check its own usage once its frame is on the stack.
+func (cw *codeWriter) setStackCheck(sa stackAnalysis) {
+	cw.stackLimits = map[string]int{}
+	for fnName, usage := range sa {
+		limit := usage.localMax
+		for _, site := range usage.calls {
+			limit = max(limit, site.depth+callFrameSize)
+		}
+		cw.stackLimits[fnName] = limit
+	}
+}
+
+// Writes the routine function entries jump to when the stack would overflow into the heap. It halts
+// the program in a loop the same way a finished program does.
+func (cw *codeWriter) writeStackOverflow() {
+	fmt.Fprintf(cw.strBuilder, "(%s)\n", stackOverflowLabel)
+	fmt.Fprintf(cw.strBuilder, "@%s\n", stackOverflowLabel)
+	cw.strBuilder.WriteString("0;JEQ\n")
 
-	if _, err := cw.outfile.WriteString(cw.strBuilder.String()); err != nil {
+	if cw.stats != nil {
+		cw.stats.add(stackOverflowLabel, "stack check", cw.strBuilder.String())
+	}
+	if _, err := io.WriteString(cw.out, cw.strBuilder.String()); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -59,43 +142,53 @@ func (cw *codeWriter) setCurrFname(vmFileFname string) {
 	cw.currFname = vmFileFname
 }
 
-func (cw *codeWriter) write(commandType int, arg1 string, arg2 string) {
+// Returns the namespace used to make labels unique: the enclosing function when there is one,
+// otherwise the name of the vm file being translated
+func (cw *codeWriter) labelScope() string {
+	if cw.currFunction != "" {
+		return cw.currFunction
+	}
+	return cw.currFname
+}
+
+func (cw *codeWriter) write(command vmast.Command) {
 	cw.strBuilder.Reset()
-	switch commandType {
-	case c_push:
-		cw.writePush(arg1, arg2)
-	case c_pop:
-		cw.writePop(arg1, arg2)
-	case c_arithmetic:
-		cw.writeArithmetic(arg1)
-	case c_label:
-		cw.writeLabel(arg1)
-	case c_goto:
-		cw.writeGoto(arg1)
-	case c_if:
-		cw.writeIf(arg1)
-	case c_function:
-		nVars, err := strconv.Atoi(arg2)
-		if err != nil {
-			log.Fatal(err)
-		}
-		cw.writeFunction(arg1, nVars)
-	case c_call:
-		nArgs, err := strconv.Atoi(arg2)
-		if err != nil {
-			log.Fatal(err)
-		}
-		cw.writeCall(arg1, nArgs)
-	case c_return:
+	switch c := command.(type) {
+	case vmast.Push:
+		cw.writePush(c.Segment, c.Index)
+	case vmast.Pop:
+		cw.writePop(c.Segment, c.Index)
+	case vmast.Arithmetic:
+		cw.writeArithmetic(c.Op)
+	case vmast.Label:
+		cw.writeLabel(c.Name)
+	case vmast.Goto:
+		cw.writeGoto(c.Label)
+	case vmast.IfGoto:
+		cw.writeIf(c.Label)
+	case vmast.Function:
+		cw.writeFunction(c.Name, c.NVars)
+	case vmast.Call:
+		cw.writeCall(c.Name, c.NArgs)
+	case tailCall:
+		cw.writeTailCall(c.Name, c.NArgs)
+	case operate:
+		cw.writeOperate(c.op, c.operand)
+	case move:
+		cw.writeMove(c.src, c.dst)
+	case vmast.Return:
 		cw.writeReturn()
 	}
 
-	if _, err := cw.outfile.WriteString(cw.strBuilder.String()); err != nil {
+	if cw.stats != nil {
+		cw.stats.add(cw.labelScope(), commandName(command), cw.strBuilder.String())
+	}
+	if _, err := io.WriteString(cw.out, cw.strBuilder.String()); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func (cw *codeWriter) writePush(segment string, index string) {
+func (cw *codeWriter) writePush(segment string, index int) {
 	switch segment {
 	case "constant":
 		cw.writePushConstant(index)
@@ -107,10 +200,12 @@ func (cw *codeWriter) writePush(segment string, index string) {
 		cw.writePushTemp(index)
 	case "pointer":
 		cw.writePushPointer(index)
+	case registerSegment:
+		cw.writePushRegister(index)
 	}
 }
 
-func (cw *codeWriter) writePop(segment string, index string) {
+func (cw *codeWriter) writePop(segment string, index int) {
 	switch segment {
 	case "static":
 		cw.writePopStatic(index)
@@ -120,6 +215,8 @@ func (cw *codeWriter) writePop(segment string, index string) {
 		cw.writePopTemp(index)
 	case "pointer":
 		cw.writePopPointer(index)
+	case registerSegment:
+		cw.writePopRegister(index)
 	}
 }
 
@@ -135,11 +232,11 @@ func (cw *codeWriter) writeArithmetic(command string) {
 }
 
 func (cw *codeWriter) writeLabel(label string) {
-	fmt.Fprintf(cw.strBuilder, "(%s)\n", label)
+	fmt.Fprintf(cw.strBuilder, "(%s$%s)\n", cw.labelScope(), label)
 }
 
 func (cw *codeWriter) writeGoto(label string) {
-	fmt.Fprintf(cw.strBuilder, "@%s\n", label)
+	fmt.Fprintf(cw.strBuilder, "@%s$%s\n", cw.labelScope(), label)
 	cw.strBuilder.WriteString("0;JEQ\n")
 }
 
@@ -147,20 +244,29 @@ func (cw *codeWriter) writeIf(label string) {
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("AM=M-1\n")
 	cw.strBuilder.WriteString("D=M\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", label)
+	fmt.Fprintf(cw.strBuilder, "@%s$%s\n", cw.labelScope(), label)
 	cw.strBuilder.WriteString("D;JNE\n")
 }
 
 func (cw *codeWriter) writeFunction(fnName string, nVars int) {
-	cw.writeLabel(fnName)
+	cw.currFunction = fnName
+	fmt.Fprintf(cw.strBuilder, "(%s)\n", fnName)
+	if limit, ok := cw.stackLimits[fnName]; ok {
+		cw.strBuilder.WriteString("@SP\n")
+		cw.strBuilder.WriteString("D=M\n")
+		fmt.Fprintf(cw.strBuilder, "@%d\n", max(cw.layout.StackLimit-limit, 0))
+		cw.strBuilder.WriteString("D=D-A\n")
+		fmt.Fprintf(cw.strBuilder, "@%s\n", stackOverflowLabel)
+		cw.strBuilder.WriteString("D;JGT\n")
+	}
 	for range nVars {
-		cw.writePushConstant("0")
+		cw.writePushConstant(0)
 	}
 }
 
 func (cw *codeWriter) writeCall(fnName string, nArgs int) {
 	cw.numLabels += 1
-	fnReturnLabel := fmt.Sprintf("%s$ret.%d", fnName, cw.numLabels)
+	fnReturnLabel := fmt.Sprintf("%s$ret.%d", cw.labelScope(), cw.numLabels)
 
 	// Push return address to the stack
 	fmt.Fprintf(cw.strBuilder, "@%s\n", fnReturnLabel)
@@ -229,24 +335,77 @@ func (cw *codeWriter) writeCall(fnName string, nArgs int) {
 	fmt.Fprintf(cw.strBuilder, "(%s)\n", fnReturnLabel)
 }
 
+// Calls fnName in place of the current function, which returns whatever fnName returns. The frame
+// saved by the current function's call is moved above fnName's arguments, so fnName returns
+// straight to the current function's caller.
+func (cw *codeWriter) writeTailCall(fnName string, nArgs int) {
+	// Push the return address and the caller's LCL, ARG, THIS and THAT pointers
+	for i := 5; i > 0; i-- {
+		cw.strBuilder.WriteString("@LCL\n")
+		cw.strBuilder.WriteString("D=M\n")
+		fmt.Fprintf(cw.strBuilder, "@%d\n", i)
+		cw.strBuilder.WriteString("A=D-A\n")
+		cw.strBuilder.WriteString("D=M\n")
+		cw.strBuilder.WriteString("@SP\n")
+		cw.strBuilder.WriteString("A=M\n")
+		cw.strBuilder.WriteString("M=D\n")
+		cw.strBuilder.WriteString("@SP\n")
+		cw.strBuilder.WriteString("M=M+1\n")
+	}
+
+	// Move the arguments and the frame down to ARG, overwriting the current function's frame. Each
+	// word moves to a lower address, so copying from the bottom up never overwrites a word before
+	// it is copied.
+	for i := range nArgs + 5 {
+		cw.strBuilder.WriteString("@ARG\n")
+		cw.strBuilder.WriteString("D=M\n")
+		fmt.Fprintf(cw.strBuilder, "@%d\n", i)
+		cw.strBuilder.WriteString("D=D+A\n")
+		fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
+		cw.strBuilder.WriteString("M=D\n")
+		cw.strBuilder.WriteString("@SP\n")
+		cw.strBuilder.WriteString("D=M\n")
+		fmt.Fprintf(cw.strBuilder, "@%d\n", nArgs+5-i)
+		cw.strBuilder.WriteString("A=D-A\n")
+		cw.strBuilder.WriteString("D=M\n")
+		fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
+		cw.strBuilder.WriteString("A=M\n")
+		cw.strBuilder.WriteString("M=D\n")
+	}
+
+	// Reposition LCL and SP past the moved frame, ARG is already in place
+	cw.strBuilder.WriteString("@ARG\n")
+	cw.strBuilder.WriteString("D=M\n")
+	fmt.Fprintf(cw.strBuilder, "@%d\n", nArgs+5)
+	cw.strBuilder.WriteString("D=D+A\n")
+	cw.strBuilder.WriteString("@LCL\n")
+	cw.strBuilder.WriteString("M=D\n")
+	cw.strBuilder.WriteString("@SP\n")
+	cw.strBuilder.WriteString("M=D\n")
+
+	// Transfer control to called function
+	fmt.Fprintf(cw.strBuilder, "@%s\n", fnName)
+	cw.strBuilder.WriteString("0;JEQ\n")
+}
+
 func (cw *codeWriter) writeReturn() {
 	// Get a reference to the start of caller's function frame
 	cw.strBuilder.WriteString("@LCL\n")
 	cw.strBuilder.WriteString("D=M\n")
-	cw.strBuilder.WriteString("@frame\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.frameReg())
 	cw.strBuilder.WriteString("M=D\n")
 
 	// Write return address to a temporary variable
 	cw.strBuilder.WriteString("@5\n")
 	cw.strBuilder.WriteString("D=A\n")
-	cw.strBuilder.WriteString("@frame\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.frameReg())
 	cw.strBuilder.WriteString("A=M-D\n")
 	cw.strBuilder.WriteString("D=M\n")
-	cw.strBuilder.WriteString("@ret\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.retReg())
 	cw.strBuilder.WriteString("M=D\n")
 
 	// Pop top value of the stack into argument 0 for use by the caller
-	cw.writePopSegment("argument", "0")
+	cw.writePopSegment("argument", 0)
 
 	// Reposition the stack pointer to the appropriate position in the caller (@ARG+1)
 	cw.strBuilder.WriteString("@ARG\n")
@@ -257,7 +416,7 @@ func (cw *codeWriter) writeReturn() {
 	// Reposition THAT pointer
 	cw.strBuilder.WriteString("@1\n")
 	cw.strBuilder.WriteString("D=A\n")
-	cw.strBuilder.WriteString("@frame\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.frameReg())
 	cw.strBuilder.WriteString("A=M-D\n")
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@THAT\n")
@@ -266,7 +425,7 @@ func (cw *codeWriter) writeReturn() {
 	// Reposition THIS pointer
 	cw.strBuilder.WriteString("@2\n")
 	cw.strBuilder.WriteString("D=A\n")
-	cw.strBuilder.WriteString("@frame\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.frameReg())
 	cw.strBuilder.WriteString("A=M-D\n")
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@THIS\n")
@@ -275,7 +434,7 @@ func (cw *codeWriter) writeReturn() {
 	// Reposition ARG pointer
 	cw.strBuilder.WriteString("@3\n")
 	cw.strBuilder.WriteString("D=A\n")
-	cw.strBuilder.WriteString("@frame\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.frameReg())
 	cw.strBuilder.WriteString("A=M-D\n")
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@ARG\n")
@@ -284,20 +443,49 @@ func (cw *codeWriter) writeReturn() {
 	// Reposition LCL pointer
 	cw.strBuilder.WriteString("@4\n")
 	cw.strBuilder.WriteString("D=A\n")
-	cw.strBuilder.WriteString("@frame\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.frameReg())
 	cw.strBuilder.WriteString("A=M-D\n")
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@LCL\n")
 	cw.strBuilder.WriteString("M=D\n")
 
 	// goto return address
-	cw.strBuilder.WriteString("@ret\n")
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.retReg())
 	cw.strBuilder.WriteString("A=M\n")
 	cw.strBuilder.WriteString("0;JEQ\n")
 }
 
-func (cw *codeWriter) writePushConstant(index string) {
-	fmt.Fprintf(cw.strBuilder, "@%s\n", index)
+// Returns the address a static variable of the vm file being translated is allocated at
+func (cw *codeWriter) staticAddr(index int) int {
+	addr, ok := cw.statics[fmt.Sprintf("%s.%d", cw.currFname, index)]
+	if !ok {
+		log.Fatalf("vmtranslator.staticAddr: static %d of %s was not allocated", index, cw.currFname)
+	}
+	return addr
+}
+
+func (cw *codeWriter) frameReg() string {
+	return registerSymbol(cw.layout.Registers[0])
+}
+
+func (cw *codeWriter) retReg() string {
+	return registerSymbol(cw.layout.Registers[1])
+}
+
+func (cw *codeWriter) popReg() string {
+	return registerSymbol(cw.layout.Registers[2])
+}
+
+// Registers among R0-R15 are written with their predefined symbol
+func registerSymbol(addr int) string {
+	if addr < 16 {
+		return fmt.Sprintf("R%d", addr)
+	}
+	return strconv.Itoa(addr)
+}
+
+func (cw *codeWriter) writePushConstant(index int) {
+	fmt.Fprintf(cw.strBuilder, "@%d\n", index)
 	cw.strBuilder.WriteString("D=A\n")
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("A=M\n")
@@ -306,12 +494,12 @@ func (cw *codeWriter) writePushConstant(index string) {
 	cw.strBuilder.WriteString("M=M+1\n")
 }
 
-func (cw *codeWriter) writePushSegment(segment string, index string) {
+func (cw *codeWriter) writePushSegment(segment string, index int) {
 	memVar, _ := cw.segmentMappings[segment]
 
 	fmt.Fprintf(cw.strBuilder, "@%s\n", memVar)
 	cw.strBuilder.WriteString("D=M\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", index)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", index)
 	cw.strBuilder.WriteString("A=D+A\n")
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@SP\n")
@@ -321,8 +509,8 @@ func (cw *codeWriter) writePushSegment(segment string, index string) {
 	cw.strBuilder.WriteString("M=M+1\n")
 }
 
-func (cw *codeWriter) writePushStatic(index string) {
-	fmt.Fprintf(cw.strBuilder, "@%s.%s\n", cw.currFname, index)
+func (cw *codeWriter) writePushStatic(index int) {
+	fmt.Fprintf(cw.strBuilder, "@%d\n", cw.staticAddr(index))
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("A=M\n")
@@ -331,10 +519,10 @@ func (cw *codeWriter) writePushStatic(index string) {
 	cw.strBuilder.WriteString("M=M+1\n")
 }
 
-func (cw *codeWriter) writePushTemp(index string) {
-	fmt.Fprintf(cw.strBuilder, "@%d\n", tempBase)
+func (cw *codeWriter) writePushTemp(index int) {
+	fmt.Fprintf(cw.strBuilder, "@%d\n", cw.layout.TempBase)
 	cw.strBuilder.WriteString("D=A\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", index)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", index)
 	cw.strBuilder.WriteString("A=D+A\n")
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@SP\n")
@@ -344,10 +532,10 @@ func (cw *codeWriter) writePushTemp(index string) {
 	cw.strBuilder.WriteString("M=M+1\n")
 }
 
-func (cw *codeWriter) writePushPointer(index string) {
+func (cw *codeWriter) writePushPointer(index int) {
 	fmt.Fprintf(cw.strBuilder, "@%d\n", pointerBase)
 	cw.strBuilder.WriteString("D=A\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", index)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", index)
 	cw.strBuilder.WriteString("A=D+A\n")
 	cw.strBuilder.WriteString("D=M\n")
 	cw.strBuilder.WriteString("@SP\n")
@@ -357,57 +545,57 @@ func (cw *codeWriter) writePushPointer(index string) {
 	cw.strBuilder.WriteString("M=M+1\n")
 }
 
-func (cw *codeWriter) writePopSegment(segment string, index string) {
+func (cw *codeWriter) writePopSegment(segment string, index int) {
 	memVar, _ := cw.segmentMappings[segment]
 
 	fmt.Fprintf(cw.strBuilder, "@%s\n", memVar)
 	cw.strBuilder.WriteString("D=M\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", index)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", index)
 	cw.strBuilder.WriteString("D=D+A\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", regR15)
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
 	cw.strBuilder.WriteString("M=D\n")
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("AM=M-1\n")
 	cw.strBuilder.WriteString("D=M\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", regR15)
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
 	cw.strBuilder.WriteString("A=M\n")
 	cw.strBuilder.WriteString("M=D\n")
 }
 
-func (cw *codeWriter) writePopStatic(index string) {
+func (cw *codeWriter) writePopStatic(index int) {
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("AM=M-1\n")
 	cw.strBuilder.WriteString("D=M\n")
-	fmt.Fprintf(cw.strBuilder, "@%s.%s\n", cw.currFname, index)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", cw.staticAddr(index))
 	cw.strBuilder.WriteString("M=D\n")
 }
 
-func (cw *codeWriter) writePopTemp(index string) {
-	fmt.Fprintf(cw.strBuilder, "@%d\n", tempBase)
+func (cw *codeWriter) writePopTemp(index int) {
+	fmt.Fprintf(cw.strBuilder, "@%d\n", cw.layout.TempBase)
 	cw.strBuilder.WriteString("D=A\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", index)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", index)
 	cw.strBuilder.WriteString("D=D+A\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", regR15)
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
 	cw.strBuilder.WriteString("M=D\n")
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("AM=M-1\n")
 	cw.strBuilder.WriteString("D=M\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", regR15)
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
 	cw.strBuilder.WriteString("A=M\n")
 	cw.strBuilder.WriteString("M=D\n")
 }
 
-func (cw *codeWriter) writePopPointer(index string) {
+func (cw *codeWriter) writePopPointer(index int) {
 	fmt.Fprintf(cw.strBuilder, "@%d\n", pointerBase)
 	cw.strBuilder.WriteString("D=A\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", index)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", index)
 	cw.strBuilder.WriteString("D=D+A\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", regR15)
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
 	cw.strBuilder.WriteString("M=D\n")
 	cw.strBuilder.WriteString("@SP\n")
 	cw.strBuilder.WriteString("AM=M-1\n")
 	cw.strBuilder.WriteString("D=M\n")
-	fmt.Fprintf(cw.strBuilder, "@%s\n", regR15)
+	fmt.Fprintf(cw.strBuilder, "@%s\n", cw.popReg())
 	cw.strBuilder.WriteString("A=M\n")
 	cw.strBuilder.WriteString("M=D\n")
 }
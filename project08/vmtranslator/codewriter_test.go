@@ -0,0 +1,79 @@
+package vmtranslator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTailCalls(t *testing.T) {
+	programDir := filepath.Join(t.TempDir(), "Count")
+	if err := os.MkdirAll(programDir, 0755); err != nil {
+		t.Fatalf("Failed to create program directory %s: %v", programDir, err)
+	}
+	// Counts down in a loop of tail calls between functions taking a different number of arguments,
+	// far deeper than the stack fits without reusing frames
+	files := map[string]string{
+		"Sys.vm": strings.Join([]string{
+			"function Sys.init 0",
+			"push constant 3000",
+			"push constant 0",
+			"call Main.count 2",
+			"pop static 0",
+			"label END",
+			"goto END",
+		}, "\n"),
+		"Main.vm": strings.Join([]string{
+			"function Main.count 1",
+			"push argument 0",
+			"if-goto STEP",
+			"push argument 1",
+			"return",
+			"label STEP",
+			"push argument 0",
+			"push argument 1",
+			"push constant 1",
+			"call Main.step 3",
+			"return",
+			"function Main.step 0",
+			"push argument 0",
+			"push constant 1",
+			"sub",
+			"push argument 1",
+			"push argument 2",
+			"add",
+			"call Main.count 2",
+			"return",
+		}, "\n"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(programDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create vm file %s: %v", name, err)
+		}
+	}
+	asmFilePath := filepath.Join(programDir, "Count.asm")
+
+	m := loadTranslatedHackProgram(t, programDir, asmFilePath, Options{StackCheck: true})
+	if err := m.run(10_000_000); err != nil {
+		t.Fatalf("Failed to run %s: %v", asmFilePath, err)
+	}
+	if label := m.haltLabel(); label != stackOverflowLabel {
+		t.Errorf("Halted at %s without tail calls, expected %s", label, stackOverflowLabel)
+	}
+
+	m = loadTranslatedHackProgram(t, programDir, asmFilePath, Options{StackCheck: true, TailCalls: true})
+	if err := m.run(10_000_000); err != nil {
+		t.Fatalf("Failed to run %s: %v", asmFilePath, err)
+	}
+	if label := m.haltLabel(); label != "Sys.init$END" {
+		t.Errorf("Halted at %s with tail calls, expected Sys.init$END", label)
+	}
+	if got := m.ram[16]; got != 3000 {
+		t.Errorf("RAM[16] = %d, expected 3000", got)
+	}
+	// Sys.init's frame sits on top of the bootstrap's call
+	if got := m.ram[0]; got != 261 {
+		t.Errorf("SP = %d, expected 261", got)
+	}
+}
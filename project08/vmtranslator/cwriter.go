@@ -0,0 +1,400 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"io"
+	"jackvmt/vmast"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Runtime shared by every translated program. RAM is modelled as the 32K words of the Hack platform
+// with SP, LCL, ARG, THIS and THAT at addresses 0-4, so programs that inspect memory directly (the OS
+// Memory class, the screen and keyboard memory maps) behave as they do on the Hack computer.
+const cPrelude = `#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#define RAM_SIZE 32768
+#define SCREEN 16384
+#define SCREEN_SIZE 8192
+#define KBD 24576
+
+static uint16_t ram[RAM_SIZE];
+static const char *screen_path;
+static int ram_dump_size;
+
+#define SP ram[0]
+#define LCL ram[1]
+#define ARG ram[2]
+#define THIS ram[3]
+#define THAT ram[4]
+#define ADDR(a) ((uint16_t)(a) & (RAM_SIZE - 1))
+
+static void push(uint16_t value) {
+	ram[ADDR(SP)] = value;
+	SP++;
+}
+
+static uint16_t pop(void) {
+	SP--;
+	return ram[ADDR(SP)];
+}
+
+static void vm_call(void (*fn)(void), int nArgs) {
+	push(0); // there is no return address to save, the C call stack keeps track of it
+	push(LCL);
+	push(ARG);
+	push(THIS);
+	push(THAT);
+	ARG = SP - nArgs - 5;
+	LCL = SP;
+	fn();
+}
+
+static void vm_return(void) {
+	uint16_t frame = LCL;
+	ram[ADDR(ARG)] = pop();
+	SP = ARG + 1;
+	THAT = ram[ADDR(frame - 1)];
+	THIS = ram[ADDR(frame - 2)];
+	ARG = ram[ADDR(frame - 3)];
+	LCL = ram[ADDR(frame - 4)];
+}
+
+// Writes the screen memory map as a portable bitmap. Bit 0 of each word is the leftmost pixel.
+static void write_screen(const char *path) {
+	FILE *f = fopen(path, "wb");
+	if (f == NULL) {
+		perror(path);
+		return;
+	}
+	fprintf(f, "P4\n512 256\n");
+	for (int i = 0; i < SCREEN_SIZE; i++) {
+		uint16_t word = ram[SCREEN + i];
+		for (int b = 0; b < 2; b++) {
+			unsigned char out = 0;
+			for (int bit = 0; bit < 8; bit++) {
+				if (word & (1 << (b * 8 + bit))) {
+					out |= 0x80 >> bit;
+				}
+			}
+			fputc(out, f);
+		}
+	}
+	fclose(f);
+}
+
+// Programs on the Hack platform never terminate, they spin in a loop instead. Natively that loop is
+// replaced by a call to vm_halt which reports the machine state and exits.
+static void vm_halt(void) {
+	for (int i = 0; i < ram_dump_size; i++) {
+		printf("RAM[%d] = %d\n", i, (int16_t)ram[i]);
+	}
+	if (screen_path != NULL) {
+		write_screen(screen_path);
+	}
+	exit(0);
+}
+
+// Supported arguments:
+//   -set addr=value  initializes a RAM word before the program runs
+//   -ram n           prints RAM[0..n) when the program halts
+//   -screen path     writes the screen to path as a PBM image when the program halts
+static void parse_args(int argc, char **argv) {
+	for (int i = 1; i + 1 < argc; i += 2) {
+		if (strcmp(argv[i], "-set") == 0) {
+			int addr, value;
+			if (sscanf(argv[i + 1], "%d=%d", &addr, &value) != 2) {
+				fprintf(stderr, "invalid -set argument: %s\n", argv[i + 1]);
+				exit(2);
+			}
+			ram[ADDR(addr)] = (uint16_t)value;
+		} else if (strcmp(argv[i], "-ram") == 0) {
+			ram_dump_size = atoi(argv[i + 1]);
+			if (ram_dump_size > RAM_SIZE) {
+				ram_dump_size = RAM_SIZE;
+			}
+		} else if (strcmp(argv[i], "-screen") == 0) {
+			screen_path = argv[i + 1];
+		} else {
+			fprintf(stderr, "unknown argument: %s\n", argv[i]);
+			exit(2);
+		}
+	}
+}
+`
+
+// Translates vm commands into C. Every vm function becomes a C function whose vm labels are C labels,
+// and vm commands written outside of a function are collected into a function for their vm file.
+type cWriter struct {
+	out          io.Writer
+	currFname    string
+	currFunction string
+	prevLabel    string
+	inFunction   bool
+	hasFileBody  bool
+	functions    []string
+	calls        []string
+	layout       MemoryLayout
+	strBuilder   *strings.Builder
+}
+
+func newCWriter(out io.Writer, layout MemoryLayout) cWriter {
+	var b strings.Builder
+
+	return cWriter{
+		out:        out,
+		layout:     layout,
+		strBuilder: &b,
+	}
+}
+
+func (cw *cWriter) setCurrFname(vmFileFname string) {
+	cw.currFname = vmFileFname
+}
+
+func (cw *cWriter) write(command vmast.Command) {
+	cw.strBuilder.Reset()
+
+	if !cw.inFunction && !isFunction(command) {
+		cw.hasFileBody = true
+		cw.inFunction = true
+		fmt.Fprintf(cw.strBuilder, "static void %s(void) {\n", cFileBodyName(cw.currFname))
+	}
+
+	prevLabel := cw.prevLabel
+	cw.prevLabel = ""
+
+	switch c := command.(type) {
+	case vmast.Push:
+		cw.writePush(c.Segment, c.Index)
+	case vmast.Pop:
+		cw.writePop(c.Segment, c.Index)
+	case vmast.Arithmetic:
+		cw.writeArithmetic(c.Op)
+	case vmast.Label:
+		cw.prevLabel = c.Name
+		fmt.Fprintf(cw.strBuilder, "%s:;\n", cLabelName(c.Name))
+	case vmast.Goto:
+		if c.Label == prevLabel {
+			// A label immediately followed by a jump to itself is how a vm program halts
+			cw.strBuilder.WriteString("\tvm_halt();\n")
+			fmt.Fprintf(cw.strBuilder, "\tgoto %s;\n", cLabelName(c.Label))
+		} else {
+			fmt.Fprintf(cw.strBuilder, "\tgoto %s;\n", cLabelName(c.Label))
+		}
+	case vmast.IfGoto:
+		fmt.Fprintf(cw.strBuilder, "\tif (pop() != 0) goto %s;\n", cLabelName(c.Label))
+	case vmast.Function:
+		cw.writeFunction(c.Name, c.NVars)
+	case vmast.Call:
+		cw.writeCall(c.Name, c.NArgs)
+	case vmast.Return:
+		cw.strBuilder.WriteString("\tvm_return();\n")
+		cw.strBuilder.WriteString("\treturn;\n")
+	}
+
+	if _, err := io.WriteString(cw.out, cw.strBuilder.String()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Closes the C function left open by the last vm command of the file
+func (cw *cWriter) close() {
+	if cw.inFunction {
+		if _, err := io.WriteString(cw.out, "}\n\n"); err != nil {
+			log.Fatal(err)
+		}
+		cw.inFunction = false
+	}
+}
+
+func (cw *cWriter) writeFunction(fnName string, nVars int) {
+	if cw.inFunction {
+		cw.strBuilder.WriteString("}\n\n")
+	}
+	cw.inFunction = true
+	cw.currFunction = fnName
+	cw.functions = append(cw.functions, fnName)
+
+	fmt.Fprintf(cw.strBuilder, "static void %s(void) {\n", cFunctionName(fnName))
+	for range nVars {
+		cw.strBuilder.WriteString("\tpush(0);\n")
+	}
+}
+
+func (cw *cWriter) writeCall(fnName string, nArgs int) {
+	// Sys.halt spins forever on the Hack platform
+	if fnName == "Sys.halt" {
+		cw.strBuilder.WriteString("\tvm_halt();\n")
+		return
+	}
+
+	cw.calls = append(cw.calls, fnName)
+	fmt.Fprintf(cw.strBuilder, "\tvm_call(%s, %d);\n", cFunctionName(fnName), nArgs)
+}
+
+func (cw *cWriter) writePush(segment string, index int) {
+	fmt.Fprintf(cw.strBuilder, "\tpush(%s);\n", cw.segmentValue(segment, index))
+}
+
+func (cw *cWriter) writePop(segment string, index int) {
+	fmt.Fprintf(cw.strBuilder, "\t%s = pop();\n", cw.segmentValue(segment, index))
+}
+
+// Returns the C expression for a word of a memory segment, which is an lvalue for every segment
+// except constant
+func (cw *cWriter) segmentValue(segment string, index int) string {
+	switch segment {
+	case "constant":
+		return strconv.Itoa(index)
+	case "static":
+		return cStaticName(cw.currFname, index)
+	case "local":
+		return fmt.Sprintf("ram[ADDR(LCL + %d)]", index)
+	case "argument":
+		return fmt.Sprintf("ram[ADDR(ARG + %d)]", index)
+	case "this":
+		return fmt.Sprintf("ram[ADDR(THIS + %d)]", index)
+	case "that":
+		return fmt.Sprintf("ram[ADDR(THAT + %d)]", index)
+	case "temp":
+		return fmt.Sprintf("ram[%d + %d]", cw.layout.TempBase, index)
+	case "pointer":
+		return fmt.Sprintf("ram[%d + %d]", pointerBase, index)
+	default:
+		log.Fatalf("vmtranslator.segmentValue: invalid segment %s", segment)
+		return ""
+	}
+}
+
+func (cw *cWriter) writeArithmetic(command string) {
+	switch command {
+	case "add", "sub", "and", "or":
+		opMap := map[string]string{
+			"add": "+",
+			"sub": "-",
+			"and": "&",
+			"or":  "|",
+		}
+		cw.strBuilder.WriteString("\t{ uint16_t y = pop(); uint16_t x = pop(); ")
+		fmt.Fprintf(cw.strBuilder, "push(x %s y); }\n", opMap[command])
+	case "neg":
+		cw.strBuilder.WriteString("\tpush(-pop());\n")
+	case "not":
+		cw.strBuilder.WriteString("\tpush(~pop());\n")
+	case "eq", "gt", "lt":
+		opMap := map[string]string{
+			"eq": "==",
+			"gt": ">",
+			"lt": "<",
+		}
+		cw.strBuilder.WriteString("\t{ int16_t y = (int16_t)pop(); int16_t x = (int16_t)pop(); ")
+		fmt.Fprintf(cw.strBuilder, "push(x %s y ? 0xFFFF : 0); }\n", opMap[command])
+	}
+}
+
+// Writes the complete C program: the runtime, the static variables and function declarations, the
+// translated vm files and the entrypoint
+func writeCProgram(out io.Writer, cWriters []cWriter, fileBodies []string, statics []staticVar, boot bootstrap, layout MemoryLayout) {
+	var b strings.Builder
+
+	b.WriteString(cPrelude)
+	b.WriteString("\n")
+
+	for _, v := range statics {
+		fmt.Fprintf(&b, "#define %s ram[%d]\n", cStaticName(v.fname, v.index), v.addr)
+	}
+
+	declared := map[string]bool{}
+	for i := range cWriters {
+		for _, fnName := range append(cWriters[i].functions, cWriters[i].calls...) {
+			if !declared[fnName] {
+				declared[fnName] = true
+				fmt.Fprintf(&b, "static void %s(void);\n", cFunctionName(fnName))
+			}
+		}
+	}
+	b.WriteString("\n")
+
+	for _, fileBody := range fileBodies {
+		b.WriteString(fileBody)
+	}
+
+	b.WriteString("int main(int argc, char **argv) {\n")
+	if boot.enabled {
+		// Like the Hack bootstrap code, the stack pointer is set after any initial RAM values
+		b.WriteString("\tparse_args(argc, argv);\n")
+		if boot.onReturn == OnReturnReset {
+			b.WriteString("\tfor (;;) {\n")
+		}
+		fmt.Fprintf(&b, "\tSP = %d;\n", layout.StackBase)
+		fmt.Fprintf(&b, "\tvm_call(%s, 0);\n", cFunctionName(boot.entry))
+		switch boot.onReturn {
+		case OnReturnReset:
+			b.WriteString("\t}\n")
+		case OnReturnTrap:
+			fmt.Fprintf(&b, "\tvm_call(%s, 0);\n", cFunctionName(boot.trap))
+		}
+	} else {
+		fmt.Fprintf(&b, "\tSP = %d;\n", layout.StackBase)
+		b.WriteString("\tparse_args(argc, argv);\n")
+		// Without a bootstrap, execution starts at the first vm command of the program
+		for i := range cWriters {
+			if cWriters[i].hasFileBody {
+				fmt.Fprintf(&b, "\t%s();\n", cFileBodyName(cWriters[i].currFname))
+			} else if i == 0 && len(cWriters[i].functions) > 0 {
+				fmt.Fprintf(&b, "\t%s();\n", cFunctionName(cWriters[i].functions[0]))
+			}
+		}
+	}
+	b.WriteString("\tvm_halt();\n")
+	b.WriteString("\treturn 0;\n")
+	b.WriteString("}\n")
+
+	if _, err := io.WriteString(out, b.String()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Mangles a vm name into a C identifier. Letters and digits are kept, '_' is doubled and every
+// other character is escaped after a '_', so distinct vm names never map to the same identifier.
+func cMangle(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '_':
+			b.WriteString("__")
+		case r == '.':
+			b.WriteString("_0")
+		case r == '$':
+			b.WriteString("_1")
+		default:
+			fmt.Fprintf(&b, "_x%04x", r)
+		}
+	}
+	return b.String()
+}
+
+// The runtime's own names start with vm_, so vm functions named call, return or halt are not
+// confused with them
+func cFunctionName(fnName string) string {
+	return "fn_" + cMangle(fnName)
+}
+
+func cFileBodyName(vmFileFname string) string {
+	return "file_" + cMangle(vmFileFname)
+}
+
+func cStaticName(vmFileFname string, index int) string {
+	return fmt.Sprintf("static_%s_%d", cMangle(vmFileFname), index)
+}
+
+func cLabelName(label string) string {
+	return "label_" + cMangle(label)
+}
@@ -0,0 +1,261 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A Hack computer running assembly directly, without assembling it to binary first
+type hackMachine struct {
+	rom    []hackInstruction
+	ram    [32768]int16
+	labels map[string]int
+	pc     int
+}
+
+type hackInstruction struct {
+	// Value loaded by an A-instruction, -1 for C-instructions
+	value int
+	dest  string
+	comp  string
+	jump  string
+}
+
+var hackPredefinedSymbols = map[string]int{
+	"SP": 0, "LCL": 1, "ARG": 2, "THIS": 3, "THAT": 4, "SCREEN": 16384, "KBD": 24576,
+}
+
+func loadHackProgram(src string) (*hackMachine, error) {
+	m := &hackMachine{labels: map[string]int{}}
+
+	lines := []string{}
+	for line := range strings.SplitSeq(src, "\n") {
+		if idx := strings.Index(line, "//"); idx != -1 {
+			line = line[:idx]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "(") && strings.HasSuffix(line, ")") {
+			m.labels[line[1:len(line)-1]] = len(lines)
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	variables := map[string]int{}
+	for _, line := range lines {
+		if symbol, ok := strings.CutPrefix(line, "@"); ok {
+			value, err := strconv.Atoi(symbol)
+			if err != nil {
+				value, ok = m.symbolAddr(symbol, variables)
+			}
+			if !ok || value < 0 || value >= len(m.ram) {
+				return nil, fmt.Errorf("invalid address %s", line)
+			}
+			m.rom = append(m.rom, hackInstruction{value: value})
+			continue
+		}
+
+		instr := hackInstruction{value: -1}
+		rest := line
+		if dest, comp, ok := strings.Cut(rest, "="); ok {
+			instr.dest, rest = dest, comp
+		}
+		instr.comp, instr.jump, _ = strings.Cut(rest, ";")
+		if _, err := evalHackComp(instr.comp, 0, 0, 0); err != nil {
+			return nil, fmt.Errorf("invalid instruction %s: %v", line, err)
+		}
+		m.rom = append(m.rom, instr)
+	}
+	return m, nil
+}
+
+// Resolves a symbol to a label, a predefined symbol or a variable allocated from RAM[16]
+func (m *hackMachine) symbolAddr(symbol string, variables map[string]int) (int, bool) {
+	if addr, ok := m.labels[symbol]; ok {
+		return addr, true
+	}
+	if addr, ok := hackPredefinedSymbols[symbol]; ok {
+		return addr, true
+	}
+	if n, ok := strings.CutPrefix(symbol, "R"); ok {
+		if addr, err := strconv.Atoi(n); err == nil && addr < 16 {
+			return addr, true
+		}
+	}
+	if _, err := strconv.Atoi(symbol[:1]); err == nil {
+		return 0, false
+	}
+	if _, ok := variables[symbol]; !ok {
+		variables[symbol] = 16 + len(variables)
+	}
+	return variables[symbol], true
+}
+
+// Evaluates a comp field such as D+1, M-D or !A
+func evalHackComp(comp string, a, d, mem int16) (int16, error) {
+	operand := func(s string) (int16, bool) {
+		switch s {
+		case "A":
+			return a, true
+		case "D":
+			return d, true
+		case "M":
+			return mem, true
+		case "0":
+			return 0, true
+		case "1":
+			return 1, true
+		}
+		return 0, false
+	}
+
+	if x, ok := operand(comp); ok {
+		return x, nil
+	}
+	if comp == "-1" {
+		return -1, nil
+	}
+	if len(comp) == 2 {
+		if x, ok := operand(comp[1:]); ok {
+			switch comp[0] {
+			case '!':
+				return ^x, nil
+			case '-':
+				return -x, nil
+			}
+		}
+	}
+	if len(comp) == 3 {
+		x, okX := operand(comp[:1])
+		y, okY := operand(comp[2:])
+		if okX && okY {
+			switch comp[1] {
+			case '+':
+				return x + y, nil
+			case '-':
+				return x - y, nil
+			case '&':
+				return x & y, nil
+			case '|':
+				return x | y, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown comp %s", comp)
+}
+
+// Reports whether the machine is at an unconditional jump to itself, the loop programs halt in
+func (m *hackMachine) halted() bool {
+	if m.pc+1 >= len(m.rom) {
+		return m.pc >= len(m.rom)
+	}
+	load, jump := m.rom[m.pc], m.rom[m.pc+1]
+	return load.value == m.pc && jump.value == -1 && jump.comp == "0" && (jump.jump == "JMP" || jump.jump == "JEQ")
+}
+
+// Runs the program until it halts, failing once it has run maxSteps instructions
+func (m *hackMachine) run(maxSteps int) error {
+	var a, d int16
+	for range maxSteps {
+		if m.halted() {
+			return nil
+		}
+		instr := m.rom[m.pc]
+		if instr.value != -1 {
+			a = int16(instr.value)
+			m.pc++
+			continue
+		}
+
+		out, _ := evalHackComp(instr.comp, a, d, m.ram[uint16(a)%uint16(len(m.ram))])
+		addr := uint16(a) % uint16(len(m.ram))
+		if strings.Contains(instr.dest, "M") {
+			m.ram[addr] = out
+		}
+		if strings.Contains(instr.dest, "D") {
+			d = out
+		}
+		if strings.Contains(instr.dest, "A") {
+			a = out
+		}
+
+		jumps := map[string]bool{
+			"JGT": out > 0, "JEQ": out == 0, "JGE": out >= 0, "JLT": out < 0,
+			"JNE": out != 0, "JLE": out <= 0, "JMP": true,
+		}
+		if jumps[instr.jump] {
+			m.pc = int(uint16(a))
+		} else {
+			m.pc++
+		}
+	}
+	return fmt.Errorf("still running after %d steps", maxSteps)
+}
+
+// Returns the label the machine halted at
+func (m *hackMachine) haltLabel() string {
+	for label, addr := range m.labels {
+		if addr == m.pc {
+			return label
+		}
+	}
+	return ""
+}
+
+// Translates a program to Hack assembly with opts and loads the output into a machine
+func loadTranslatedHackProgram(t *testing.T, programPath string, asmFilePath string, opts Options) *hackMachine {
+	t.Helper()
+
+	Translate(programPath, opts)
+	src, err := os.ReadFile(asmFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read generated output file %s: %v", asmFilePath, err)
+	}
+	m, err := loadHackProgram(string(src))
+	if err != nil {
+		t.Fatalf("Invalid program %s: %v", asmFilePath, err)
+	}
+	return m
+}
+
+func TestTranslateToHack(t *testing.T) {
+	modes := []struct {
+		name string
+		opts Options
+	}{
+		{name: "plain", opts: Options{}},
+		{name: "registers", opts: Options{AllocateRegisters: true}},
+	}
+
+	for _, mode := range modes {
+		for _, tc := range courseTestPrograms {
+			t.Run(mode.name+"/"+tc.name, func(t *testing.T) {
+				programDir := copyVmProgram(t, tc.programDir)
+				programPath, asmFilePath := translatedPath(programDir, tc.name, ".asm")
+				m := loadTranslatedHackProgram(t, programPath, asmFilePath, mode.opts)
+
+				initial, expected := readTestScript(t,
+					filepath.Join(tc.programDir, tc.name+".tst"),
+					filepath.Join(tc.programDir, tc.name+".cmp"))
+				for addr, value := range initial {
+					m.ram[addr] = int16(value)
+				}
+				if err := m.run(10_000_000); err != nil {
+					t.Fatalf("Failed to run %s: %v", asmFilePath, err)
+				}
+
+				for addr, value := range expected {
+					if got := int(m.ram[addr]); got != value {
+						t.Errorf("RAM[%d] = %d, expected %d", addr, got, value)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package vmtranslator
+
+import (
+	"jackvmt/vmast"
+)
+
+// Temp registers inlined functions keep their arguments, locals and the caller's segment pointers in.
+// temp 0 is left to the Jack compiler and temp 7 to the optimizer.
+const (
+	inlineTempFirst = 1
+	inlineTempLast  = 6
+)
+
+// A function that can be inlined: a straight line of commands ending in its only return
+type inlineCandidate struct {
+	fname string
+	nVars int
+	body  []vmast.Command
+	// Highest argument index used by the body plus one
+	nArgs int
+	// Pointer registers the body writes, which are restored for the caller after the body runs
+	writesPointer [2]bool
+}
+
+// Replaces calls to small leaf functions with their body. A function is inlined when its body is at
+// most threshold commands long, makes no calls, has no control flow other than its final return
+// and only uses the temp segment and statics of its own file. Its arguments and locals are kept in
+// temp registers, which every function shares, so nothing is inlined into a program using them.
+func inlineFunctions(vmFiles []vmFile, threshold int) []vmFile {
+	for _, vmFile := range vmFiles {
+		if usesInlineTemps(vmFile.commands) {
+			return vmFiles
+		}
+	}
+
+	candidates := map[string]inlineCandidate{}
+	for _, vmFile := range vmFiles {
+		for fnName, body := range functionBodies(vmFile.commands) {
+			if candidate, ok := newInlineCandidate(vmFile.fname, body, threshold); ok {
+				candidates[fnName] = candidate
+			}
+		}
+	}
+
+	inlined := make([]vmFile, len(vmFiles))
+	for i, vmFile := range vmFiles {
+		inlined[i] = vmFile
+		commands := []vmast.Command{}
+		for _, command := range vmFile.commands {
+			call, ok := command.(vmast.Call)
+			candidate, isCandidate := candidates[call.Name]
+			if !ok || !isCandidate {
+				commands = append(commands, command)
+				continue
+			}
+			expansion, ok := candidate.expand(vmFile.fname, call)
+			if !ok {
+				commands = append(commands, command)
+				continue
+			}
+			commands = append(commands, expansion...)
+		}
+		inlined[i].commands = commands
+	}
+	return inlined
+}
+
+func newInlineCandidate(fname string, function []vmast.Command, threshold int) (inlineCandidate, bool) {
+	nVars := function[0].(vmast.Function).NVars
+	body := function[1:]
+	if len(body) == 0 || len(body)-1 > threshold {
+		return inlineCandidate{}, false
+	}
+	if _, ok := body[len(body)-1].(vmast.Return); !ok {
+		return inlineCandidate{}, false
+	}
+	body = body[:len(body)-1]
+
+	candidate := inlineCandidate{fname: fname, nVars: nVars, body: body}
+	depth := 0
+	for _, command := range body {
+		switch c := command.(type) {
+		case vmast.Push, vmast.Pop:
+			segment, index, _ := segmentOperand(command)
+			switch segment {
+			case "temp":
+				return inlineCandidate{}, false
+			case "argument":
+				candidate.nArgs = max(candidate.nArgs, index+1)
+			case "local":
+				if index >= nVars {
+					return inlineCandidate{}, false
+				}
+			case "pointer":
+				if _, ok := command.(vmast.Pop); ok && index <= 1 {
+					candidate.writesPointer[index] = true
+				}
+			}
+			if _, ok := command.(vmast.Push); ok {
+				depth++
+			} else {
+				depth--
+			}
+		case vmast.Arithmetic:
+			if c.Op != "neg" && c.Op != "not" {
+				depth--
+			}
+		default:
+			return inlineCandidate{}, false
+		}
+		if depth < 0 {
+			return inlineCandidate{}, false
+		}
+	}
+	// The return value has to be all that is left on the stack
+	if depth != 1 {
+		return inlineCandidate{}, false
+	}
+	return candidate, true
+}
+
+// Returns the commands replacing a call to the candidate, if its arguments, locals and saved
+// pointers fit in the inline temp registers
+func (ic inlineCandidate) expand(callerFname string, call vmast.Call) ([]vmast.Command, bool) {
+	nArgs := call.NArgs
+	if nArgs < ic.nArgs {
+		return nil, false
+	}
+	usesStatics := false
+	for _, command := range ic.body {
+		segment, _, _ := segmentOperand(command)
+		usesStatics = usesStatics || segment == "static"
+	}
+	if usesStatics && ic.fname != callerFname {
+		return nil, false
+	}
+
+	next := inlineTempFirst
+	alloc := func() int {
+		reg := next
+		next++
+		return reg
+	}
+	argRegs := make([]int, nArgs)
+	for i := range argRegs {
+		argRegs[i] = alloc()
+	}
+	localRegs := make([]int, ic.nVars)
+	for i := range localRegs {
+		localRegs[i] = alloc()
+	}
+	savedRegs := [2]int{}
+	for i, writes := range ic.writesPointer {
+		if writes {
+			savedRegs[i] = alloc()
+		}
+	}
+	if next-1 > inlineTempLast {
+		return nil, false
+	}
+
+	// The last argument is on top of the stack
+	commands := []vmast.Command{}
+	for i := nArgs - 1; i >= 0; i-- {
+		commands = append(commands, vmast.Pop{Segment: "temp", Index: argRegs[i]})
+	}
+	for i, reg := range savedRegs {
+		if ic.writesPointer[i] {
+			commands = append(commands, vmast.Push{Segment: "pointer", Index: i}, vmast.Pop{Segment: "temp", Index: reg})
+		}
+	}
+	for _, reg := range localRegs {
+		commands = append(commands, vmast.Push{Segment: "constant", Index: 0}, vmast.Pop{Segment: "temp", Index: reg})
+	}
+
+	// Arguments and locals are moved to the temp registers given to them
+	rename := func(segment string, index int) (string, int) {
+		switch segment {
+		case "argument":
+			return "temp", argRegs[index]
+		case "local":
+			return "temp", localRegs[index]
+		}
+		return segment, index
+	}
+	for _, command := range ic.body {
+		switch c := command.(type) {
+		case vmast.Push:
+			c.Segment, c.Index = rename(c.Segment, c.Index)
+			command = c
+		case vmast.Pop:
+			c.Segment, c.Index = rename(c.Segment, c.Index)
+			command = c
+		}
+		commands = append(commands, command)
+	}
+
+	for i, reg := range savedRegs {
+		if ic.writesPointer[i] {
+			commands = append(commands, vmast.Push{Segment: "temp", Index: reg}, vmast.Pop{Segment: "pointer", Index: i})
+		}
+	}
+	return commands, true
+}
+
+// Reports whether commands use the temp registers inlined functions are given
+func usesInlineTemps(commands []vmast.Command) bool {
+	for _, command := range commands {
+		if segment, index, ok := segmentOperand(command); ok && segment == "temp" && index >= inlineTempFirst && index <= inlineTempLast {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package vmtranslator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "arguments",
+			src:      "function Main.main 0\npush constant 2\npush constant 3\ncall Main.sub 2\nreturn\nfunction Main.sub 0\npush argument 0\npush argument 1\nsub\nreturn",
+			expected: "function Main.main 0\npush constant 2\npush constant 3\npop temp 2\npop temp 1\npush temp 1\npush temp 2\nsub\nreturn\nfunction Main.sub 0\npush argument 0\npush argument 1\nsub\nreturn",
+		},
+		{
+			name:     "locals and pointers",
+			src:      "function Main.main 0\npush local 0\ncall Main.getX 1\nreturn\nfunction Main.getX 1\npush argument 0\npop pointer 0\npush this 0\npop local 0\npush local 0\nreturn",
+			expected: "function Main.main 0\npush local 0\npop temp 1\npush pointer 0\npop temp 3\npush constant 0\npop temp 2\npush temp 1\npop pointer 0\npush this 0\npop temp 2\npush temp 2\npush temp 3\npop pointer 0\nreturn\nfunction Main.getX 1\npush argument 0\npop pointer 0\npush this 0\npop local 0\npush local 0\nreturn",
+		},
+		{
+			name:     "over the threshold",
+			src:      "function Main.main 0\ncall Main.f 0\nreturn\nfunction Main.f 0\npush constant 1\npush constant 1\nadd\npush constant 1\nadd\nnot\nreturn",
+			expected: "function Main.main 0\ncall Main.f 0\nreturn\nfunction Main.f 0\npush constant 1\npush constant 1\nadd\npush constant 1\nadd\nnot\nreturn",
+		},
+		{
+			name:     "recursive",
+			src:      "function Main.f 0\npush argument 0\ncall Main.f 1\nreturn",
+			expected: "function Main.f 0\npush argument 0\ncall Main.f 1\nreturn",
+		},
+		{
+			name:     "control flow",
+			src:      "function Main.main 0\ncall Main.f 0\nreturn\nfunction Main.f 0\nlabel A\npush constant 0\nreturn",
+			expected: "function Main.main 0\ncall Main.f 0\nreturn\nfunction Main.f 0\nlabel A\npush constant 0\nreturn",
+		},
+		{
+			name:     "caller uses temps",
+			src:      "function Main.main 0\npush constant 1\npop temp 1\ncall Main.f 0\nreturn\nfunction Main.f 0\npush constant 0\nreturn",
+			expected: "function Main.main 0\npush constant 1\npop temp 1\ncall Main.f 0\nreturn\nfunction Main.f 0\npush constant 0\nreturn",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inlined := inlineFunctions([]vmFile{{fname: "Main", commands: parseVmCommands(t, tc.src)}}, 5)
+
+			lines := []string{}
+			for _, command := range inlined[0].commands {
+				lines = append(lines, command.String())
+			}
+			if got := strings.Join(lines, "\n"); got != tc.expected {
+				t.Errorf("Inlined to:\n%s\n\nExpected:\n%s", got, tc.expected)
+			}
+		})
+	}
+}
+
+// Temp registers are shared by every function, so one holding temp 1 across a call two calls up
+// keeps anything from being inlined
+func TestInlineTempsUpTheCallStack(t *testing.T) {
+	vmFiles := []vmFile{
+		{fname: "Main", commands: parseVmCommands(t, "function Main.main 0\npush constant 5\npop temp 1\ncall Game.run 0\npop temp 0\npush temp 1\nreturn")},
+		{fname: "Game", commands: parseVmCommands(t, "function Game.run 0\npush constant 2\ncall Game.double 1\nreturn\nfunction Game.double 0\npush argument 0\npush argument 0\nadd\nreturn")},
+	}
+	inlined := inlineFunctions(vmFiles, 5)
+
+	lines := []string{}
+	for _, command := range inlined[1].commands {
+		lines = append(lines, command.String())
+	}
+	expected := "function Game.run 0\npush constant 2\ncall Game.double 1\nreturn\nfunction Game.double 0\npush argument 0\npush argument 0\nadd\nreturn"
+	if got := strings.Join(lines, "\n"); got != expected {
+		t.Errorf("Inlined to:\n%s\n\nExpected:\n%s", got, expected)
+	}
+}
+
+func TestInlineStatics(t *testing.T) {
+	vmFiles := []vmFile{
+		{fname: "Main", commands: parseVmCommands(t, "function Main.main 0\ncall Counter.get 0\ncall Main.get 0\nadd\nreturn\nfunction Main.get 0\npush static 0\nreturn")},
+		{fname: "Counter", commands: parseVmCommands(t, "function Counter.get 0\npush static 0\nreturn")},
+	}
+	inlined := inlineFunctions(vmFiles, 4)
+
+	lines := []string{}
+	for _, command := range inlined[0].commands[:4] {
+		lines = append(lines, command.String())
+	}
+	expected := "function Main.main 0\ncall Counter.get 0\npush static 0\nadd"
+	if got := strings.Join(lines, "\n"); got != expected {
+		t.Errorf("Inlined to:\n%s\n\nExpected:\n%s", got, expected)
+	}
+}
+
+func TestInlinedProgram(t *testing.T) {
+	program := strings.Join([]string{
+		"function Main.main 0",
+		"push constant 3000",
+		"pop pointer 0",
+		"push constant 7",
+		"pop this 0",
+		"push constant 3001",
+		"pop pointer 1",
+		"push constant 3000",
+		"call Main.twice 1",
+		"pop static 0",
+		"push pointer 0",
+		"pop static 1",
+		"push constant 0",
+		"return",
+		"function Main.twice 1",
+		"push argument 0",
+		"pop pointer 0",
+		"push this 0",
+		"pop local 0",
+		"push local 0",
+		"push local 0",
+		"add",
+		"return",
+	}, "\n")
+
+	for _, opts := range []Options{{Bootstrap: BootstrapForce, Entry: "Main.main"}, {Bootstrap: BootstrapForce, Entry: "Main.main", Inline: 8}} {
+		ram := runWatProgram(t, program, opts)
+		for addr, value := range map[int]int{16: 14, 17: 3000} {
+			if got := ram(addr); got != value {
+				t.Errorf("Inline %d: RAM[%d] = %d, expected %d", opts.Inline, addr, got, value)
+			}
+		}
+	}
+}
+
+func TestInlinedCoursePrograms(t *testing.T) {
+	for _, tc := range courseTestPrograms {
+		t.Run(tc.name, func(t *testing.T) {
+			runWatTestProgram(t, tc.name, tc.programDir, Options{Target: TargetWat, Inline: 16, Optimize: true})
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+)
+
+// Addresses of the segment pointers, fixed by the Hack platform
+const (
+	spAddr   = 0
+	thatAddr = 4
+)
+
+// MemoryLayout places the stack, the temp segment, static variables and the registers used by the
+// generated code in RAM. Every field is used as given, so a custom layout starts from a copy of
+// CourseLayout.
+type MemoryLayout struct {
+	// Address SP is set to by the bootstrap code
+	StackBase int
+	// First address the stack must not grow into, which is where the heap starts
+	StackLimit int
+	// Address of temp 0, the segment being 8 words long
+	TempBase int
+	// First and last address static variables are allocated at
+	StaticStart int
+	StaticLimit int
+	// General purpose registers the Hack code uses for the frame of a returning function, its return
+	// address and the address a pop writes to
+	Registers [3]int
+}
+
+// The memory layout of the course's vm implementation
+var CourseLayout = MemoryLayout{
+	StackBase:   256,
+	StackLimit:  2048,
+	TempBase:    5,
+	StaticStart: 16,
+	StaticLimit: 255,
+	Registers:   [3]int{13, 14, 15},
+}
+
+const tempSize = 8
+
+// A range of RAM addresses, first and last included
+type memoryRegion struct {
+	name  string
+	first int
+	last  int
+}
+
+// Checks that the regions of the layout fit in RAM below the screen and do not overlap each other
+func (ml MemoryLayout) validate() error {
+	regions := []memoryRegion{
+		{name: "segment pointers", first: spAddr, last: thatAddr},
+		{name: "temp segment", first: ml.TempBase, last: ml.TempBase + tempSize - 1},
+		{name: "static segment", first: ml.StaticStart, last: ml.StaticLimit},
+		{name: "stack", first: ml.StackBase, last: ml.StackLimit - 1},
+	}
+	for i, reg := range ml.Registers {
+		regions = append(regions, memoryRegion{name: fmt.Sprintf("register %d", i), first: reg, last: reg})
+	}
+
+	for i, a := range regions {
+		if a.first > a.last || a.first < 0 || a.last >= screenBase {
+			return fmt.Errorf("invalid %s RAM[%d..%d]", a.name, a.first, a.last)
+		}
+		for _, b := range regions[i+1:] {
+			if a.first <= b.last && b.first <= a.last {
+				return fmt.Errorf("%s RAM[%d..%d] overlaps %s RAM[%d..%d]", a.name, a.first, a.last, b.name, b.first, b.last)
+			}
+		}
+	}
+	return nil
+}
+
+// Address of the first word of screen memory
+const screenBase = 16384
+
+// A static variable of a vm file along with the address it is allocated at
+type staticVar struct {
+	fname string
+	index int
+	addr  int
+}
+
+// Allocates the static variables of a program in the static region, one vm file after the other
+func (ml MemoryLayout) allocateStatics(vmFiles []vmFile) []staticVar {
+	vars := []staticVar{}
+	addr := ml.StaticStart
+	for _, vmFile := range vmFiles {
+		indices := map[int]bool{}
+		for _, command := range vmFile.commands {
+			if segment, index, ok := segmentOperand(command); ok && segment == "static" {
+				indices[index] = true
+			}
+		}
+
+		for _, index := range slices.Sorted(maps.Keys(indices)) {
+			if addr > ml.StaticLimit {
+				log.Fatalf("vmtranslator.allocateStatics: static variables exceed the static segment (RAM[%d..%d])", ml.StaticStart, ml.StaticLimit)
+			}
+			vars = append(vars, staticVar{fname: vmFile.fname, index: index, addr: addr})
+			addr += 1
+		}
+	}
+	return vars
+}
+
+// Returns the addresses of static variables keyed by their Hack symbol, File.index
+func staticAddrs(vars []staticVar) map[string]int {
+	addrs := map[string]int{}
+	for _, v := range vars {
+		addrs[fmt.Sprintf("%s.%d", v.fname, v.index)] = v.addr
+	}
+	return addrs
+}
@@ -0,0 +1,76 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"jackvmt/vmast"
+	"testing"
+)
+
+func TestAllocateStatics(t *testing.T) {
+	vmFiles := []vmFile{
+		{fname: "Sys", commands: []vmast.Command{
+			vmast.Push{Segment: "static", Index: 1},
+			vmast.Pop{Segment: "static", Index: 0},
+		}},
+		{fname: "Main", commands: []vmast.Command{
+			vmast.Pop{Segment: "static", Index: 3},
+			vmast.Push{Segment: "static", Index: 3},
+		}},
+	}
+
+	layout := CourseLayout
+	layout.StaticStart, layout.StaticLimit = 100, 102
+	vars := layout.allocateStatics(vmFiles)
+
+	expected := []staticVar{
+		{fname: "Sys", index: 0, addr: 100},
+		{fname: "Sys", index: 1, addr: 101},
+		{fname: "Main", index: 3, addr: 102},
+	}
+	if len(vars) != len(expected) {
+		t.Fatalf("Allocated %v, expected %v", vars, expected)
+	}
+	for i := range expected {
+		if vars[i] != expected[i] {
+			t.Errorf("Static %d allocated as %v, expected %v", i, vars[i], expected[i])
+		}
+	}
+}
+
+// The course test programs do not check static variables, so they are unaffected by where statics
+// are placed
+func TestTranslateWithMemoryLayout(t *testing.T) {
+	layout := CourseLayout
+	layout.StackLimit = 1024
+	layout.StaticStart, layout.StaticLimit = 1024, 1100
+	layout.Registers = [3]int{20, 21, 22}
+	for _, tc := range courseTestPrograms {
+		t.Run(tc.name, func(t *testing.T) {
+			runWatTestProgram(t, tc.name, tc.programDir, Options{Target: TargetWat, Layout: &layout})
+		})
+	}
+}
+
+// Zero is an address like any other, so a field left at zero is checked rather than defaulted
+func TestValidateMemoryLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(*MemoryLayout)
+		expected string
+	}{
+		{name: "course", change: func(*MemoryLayout) {}},
+		{name: "zero static start", change: func(ml *MemoryLayout) { ml.StaticStart = 0 }, expected: "segment pointers RAM[0..4] overlaps static segment RAM[0..255]"},
+		{name: "zero stack limit", change: func(ml *MemoryLayout) { ml.StackLimit = 0 }, expected: "invalid stack RAM[256..-1]"},
+		{name: "zero registers", change: func(ml *MemoryLayout) { ml.Registers = [3]int{} }, expected: "segment pointers RAM[0..4] overlaps register 0 RAM[0..0]"},
+		{name: "screen", change: func(ml *MemoryLayout) { ml.StackLimit = 16385 }, expected: "invalid stack RAM[256..16384]"},
+	}
+
+	for _, tc := range tests {
+		layout := CourseLayout
+		tc.change(&layout)
+		err := layout.validate()
+		if got := fmt.Sprint(err); (err == nil) != (tc.expected == "") || (err != nil && got != tc.expected) {
+			t.Errorf("Validating the %s layout reported %v, expected %q", tc.name, err, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package vmtranslator
+
+import (
+	"io"
+	"jackvmt/vmast"
+	"log"
+	"math/bits"
+	"slices"
+)
+
+// Temp register the optimizer uses to double a value, the Jack compiler only ever uses temp 0
+const optimizerTemp = 7
+
+// Writes the optimized commands of a vm file to out as vm code. programFilePaths are the vm files of
+// the whole program: multiplies are only rewritten with the optimizer's temp register when none of
+// them uses it, so without them they are left alone.
+func Optimize(vmFilePath string, programFilePaths []string, out io.Writer) {
+	reduceMultiplies := len(programFilePaths) > 0
+	for _, programFilePath := range programFilePaths {
+		if usesOptimizerTemp(parseVmFile(programFilePath).commands) {
+			reduceMultiplies = false
+		}
+	}
+	vmFile := optimizeVmFile(parseVmFile(vmFilePath), reduceMultiplies)
+	if err := vmast.Print(out, vmFile.commands); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Optimizes every vm file of a program. Temp registers are shared by every function, so a program
+// keeping its own value in the optimizer's temp register anywhere has no multiplies rewritten.
+func optimizeProgram(vmFiles []vmFile) []vmFile {
+	reduceMultiplies := true
+	for _, vmFile := range vmFiles {
+		if usesOptimizerTemp(vmFile.commands) {
+			reduceMultiplies = false
+		}
+	}
+
+	optimized := make([]vmFile, len(vmFiles))
+	for i, vmFile := range vmFiles {
+		optimized[i] = optimizeVmFile(vmFile, reduceMultiplies)
+	}
+	return optimized
+}
+
+// Runs the optimization passes over each function of a vm file until none of them changes anything.
+// Multiplies are rewritten with the optimizer's temp register only when reduceMultiplies is set.
+func optimizeVmFile(file vmFile, reduceMultiplies bool) vmFile {
+	passes := []func([]vmast.Command) ([]vmast.Command, bool){foldConstants}
+	if reduceMultiplies {
+		passes = append(passes, reducePowersOfTwo)
+	}
+	passes = append(passes, removePushPops, threadJumps, removeUnreachable, removeUnusedLabels)
+
+	optimized := []vmast.Command{}
+	for _, scope := range labelScopes(file.commands) {
+		for changed := true; changed; {
+			changed = false
+			for _, pass := range passes {
+				var passChanged bool
+				scope, passChanged = pass(scope)
+				changed = changed || passChanged
+			}
+		}
+		optimized = append(optimized, scope...)
+	}
+
+	return vmFile{fname: file.fname, commands: optimized}
+}
+
+// Splits commands into the ranges labels are scoped to: the commands before the first function,
+// then each function
+func labelScopes(commands []vmast.Command) [][]vmast.Command {
+	scopes := [][]vmast.Command{}
+	start := 0
+	for i, command := range commands {
+		if isFunction(command) && i > start {
+			scopes = append(scopes, slices.Clone(commands[start:i]))
+			start = i
+		}
+	}
+	if start < len(commands) {
+		scopes = append(scopes, slices.Clone(commands[start:]))
+	}
+	return scopes
+}
+
+// Returns the value pushed by a constant, along with the number of commands it takes. -1 and other
+// values whose complement is a constant are pushed by the Jack compiler as push constant; not.
+func constantAt(commands []vmast.Command, i int) (int16, int, bool) {
+	if i < 0 || i >= len(commands) {
+		return 0, 0, false
+	}
+	push, ok := commands[i].(vmast.Push)
+	if !ok || push.Segment != "constant" {
+		return 0, 0, false
+	}
+	value := int16(push.Index)
+	if i+1 < len(commands) {
+		switch {
+		case isArithmetic(commands[i+1], "not"):
+			return ^value, 2, true
+		case isArithmetic(commands[i+1], "neg"):
+			return -value, 2, true
+		}
+	}
+	return value, 1, true
+}
+
+// Returns the commands pushing value. Negative values are not valid constants and are pushed as the
+// complement of one.
+func pushConstant(value int16) []vmast.Command {
+	if value >= 0 {
+		return []vmast.Command{vmast.Push{Segment: "constant", Index: int(value)}}
+	}
+	return []vmast.Command{
+		vmast.Push{Segment: "constant", Index: int(^value)},
+		vmast.Arithmetic{Op: "not"},
+	}
+}
+
+func isCall(command vmast.Command, fnName string, nArgs int) bool {
+	call, ok := command.(vmast.Call)
+	return ok && call.Name == fnName && call.NArgs == nArgs
+}
+
+// Replaces operations on constants with the constant they compute, including multiplies and
+// divides through the OS Math class
+func foldConstants(commands []vmast.Command) ([]vmast.Command, bool) {
+	changed := false
+	for i := 0; i < len(commands); i++ {
+		a, aLen, ok := constantAt(commands, i)
+		if !ok {
+			continue
+		}
+
+		// A unary operation on a constant, the first one being part of the constant itself
+		if next := i + aLen; next < len(commands) && isArithmetic(commands[next], "neg", "not") {
+			result := -a
+			if isArithmetic(commands[next], "not") {
+				result = ^a
+			}
+			commands = slices.Replace(commands, i, next+1, pushConstant(result)...)
+			changed = true
+			i--
+			continue
+		}
+
+		b, bLen, ok := constantAt(commands, i+aLen)
+		if !ok {
+			continue
+		}
+		opIdx := i + aLen + bLen
+		if opIdx >= len(commands) {
+			continue
+		}
+		op := commands[opIdx]
+
+		var result int16
+		switch {
+		case isArithmetic(op, "add"):
+			result = a + b
+		case isArithmetic(op, "sub"):
+			result = a - b
+		case isArithmetic(op, "and"):
+			result = a & b
+		case isArithmetic(op, "or"):
+			result = a | b
+		case isArithmetic(op, "eq"):
+			result = vmBool(a == b)
+		case isArithmetic(op, "gt"):
+			result = vmBool(a > b)
+		case isArithmetic(op, "lt"):
+			result = vmBool(a < b)
+		case isCall(op, "Math.multiply", 2):
+			result = a * b
+		case isCall(op, "Math.divide", 2) && b != 0:
+			result = a / b
+		default:
+			continue
+		}
+		commands = slices.Replace(commands, i, opIdx+1, pushConstant(result)...)
+		changed = true
+		i--
+	}
+	return commands, changed
+}
+
+func vmBool(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+// Replaces multiplies by a power of two with a chain of additions doubling the value, and removes
+// multiplies and divides by one. Dividing by a larger power of two is left to Math.divide as
+// the vm has no right shift to replace it with.
+func reducePowersOfTwo(commands []vmast.Command) ([]vmast.Command, bool) {
+	changed := false
+	for i := 0; i < len(commands); i++ {
+		value, valueLen, ok := constantAt(commands, i)
+		callIdx := i + valueLen
+		if !ok || value <= 0 || value&(value-1) != 0 || callIdx >= len(commands) {
+			continue
+		}
+
+		switch {
+		case isCall(commands[callIdx], "Math.multiply", 2):
+			doubling := []vmast.Command{}
+			for range bits.TrailingZeros16(uint16(value)) {
+				doubling = append(doubling,
+					vmast.Pop{Segment: "temp", Index: optimizerTemp},
+					vmast.Push{Segment: "temp", Index: optimizerTemp},
+					vmast.Push{Segment: "temp", Index: optimizerTemp},
+					vmast.Arithmetic{Op: "add"},
+				)
+			}
+			commands = slices.Replace(commands, i, callIdx+1, doubling...)
+		case isCall(commands[callIdx], "Math.divide", 2) && value == 1:
+			commands = slices.Delete(commands, i, callIdx+1)
+		default:
+			continue
+		}
+		changed = true
+		i--
+	}
+	return commands, changed
+}
+
+// Reports whether commands use the temp register multiplies are rewritten with
+func usesOptimizerTemp(commands []vmast.Command) bool {
+	for _, command := range commands {
+		if segment, index, ok := segmentOperand(command); ok && segment == "temp" && index == optimizerTemp {
+			return true
+		}
+	}
+	return false
+}
+
+// Removes a push immediately popped back to where it was pushed from
+func removePushPops(commands []vmast.Command) ([]vmast.Command, bool) {
+	changed := false
+	for i := 0; i+1 < len(commands); i++ {
+		push, isPush := commands[i].(vmast.Push)
+		pop, isPop := commands[i+1].(vmast.Pop)
+		if isPush && isPop && push.Segment == pop.Segment && push.Index == pop.Index {
+			commands = slices.Delete(commands, i, i+2)
+			changed = true
+			i = max(i-2, -1)
+		}
+	}
+	return commands, changed
+}
+
+// Returns the label a goto or if-goto jumps to
+func jumpTarget(command vmast.Command) (string, bool) {
+	switch c := command.(type) {
+	case vmast.Goto:
+		return c.Label, true
+	case vmast.IfGoto:
+		return c.Label, true
+	}
+	return "", false
+}
+
+// Makes jumps to a label that is followed by a goto jump straight to the goto's label, and removes
+// gotos to the label that immediately follows them
+func threadJumps(commands []vmast.Command) ([]vmast.Command, bool) {
+	// The label each label leads to when it is followed by a goto
+	forwards := map[string]string{}
+	for i, command := range commands {
+		label, ok := command.(vmast.Label)
+		if !ok {
+			continue
+		}
+		j := i + 1
+		for j < len(commands) && isLabel(commands[j]) {
+			j++
+		}
+		if j < len(commands) {
+			if jump, ok := commands[j].(vmast.Goto); ok {
+				forwards[label.Name] = jump.Label
+			}
+		}
+	}
+
+	changed := false
+	for i, command := range commands {
+		label, ok := jumpTarget(command)
+		if !ok {
+			continue
+		}
+		// Jumps into a loop of gotos are left alone
+		target := label
+		seen := map[string]bool{target: true}
+		for next, ok := forwards[target]; ok; next, ok = forwards[target] {
+			if seen[next] {
+				target = label
+				break
+			}
+			target = next
+			seen[target] = true
+		}
+		if target == label {
+			continue
+		}
+		switch c := command.(type) {
+		case vmast.Goto:
+			c.Label = target
+			commands[i] = c
+		case vmast.IfGoto:
+			c.Label = target
+			commands[i] = c
+		}
+		changed = true
+	}
+
+	for i := 0; i < len(commands); i++ {
+		jump, ok := commands[i].(vmast.Goto)
+		if !ok {
+			continue
+		}
+		for j := i + 1; j < len(commands) && isLabel(commands[j]); j++ {
+			if commands[j].(vmast.Label).Name == jump.Label {
+				commands = slices.Delete(commands, i, i+1)
+				changed = true
+				i--
+				break
+			}
+		}
+	}
+	return commands, changed
+}
+
+func isLabel(command vmast.Command) bool {
+	_, ok := command.(vmast.Label)
+	return ok
+}
+
+func isFunction(command vmast.Command) bool {
+	_, ok := command.(vmast.Function)
+	return ok
+}
+
+// Removes the commands following a goto or return that no label leads to
+func removeUnreachable(commands []vmast.Command) ([]vmast.Command, bool) {
+	changed := false
+	for i := 0; i < len(commands); i++ {
+		switch commands[i].(type) {
+		case vmast.Goto, vmast.Return:
+			end := i + 1
+			for end < len(commands) && !isLabel(commands[end]) && !isFunction(commands[end]) {
+				end++
+			}
+			if end > i+1 {
+				commands = slices.Delete(commands, i+1, end)
+				changed = true
+			}
+		}
+	}
+	return commands, changed
+}
+
+// Removes labels no goto or if-goto jumps to, letting unreachable code following them be removed
+func removeUnusedLabels(commands []vmast.Command) ([]vmast.Command, bool) {
+	used := map[string]bool{}
+	for _, command := range commands {
+		if label, ok := jumpTarget(command); ok {
+			used[label] = true
+		}
+	}
+
+	changed := false
+	commands = slices.DeleteFunc(commands, func(command vmast.Command) bool {
+		if label, ok := command.(vmast.Label); ok && !used[label.Name] {
+			changed = true
+			return true
+		}
+		return false
+	})
+	return commands, changed
+}
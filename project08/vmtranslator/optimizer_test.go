@@ -0,0 +1,135 @@
+package vmtranslator
+
+import (
+	"jackvmt/vmast"
+	"strings"
+	"testing"
+)
+
+func parseVmCommands(t *testing.T, src string) []vmast.Command {
+	t.Helper()
+
+	commands := []vmast.Command{}
+	for command, err := range vmast.Commands(strings.NewReader(src)) {
+		if err != nil {
+			t.Fatalf("Failed to parse vm code: %v", err)
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+func TestOptimizeVmFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "fold arithmetic",
+			src:      "push constant 2\npush constant 3\nadd\npush constant 4\nsub",
+			expected: "push constant 1",
+		},
+		{
+			name:     "fold multiply",
+			src:      "push constant 2\npush constant 3\ncall Math.multiply 2",
+			expected: "push constant 6",
+		},
+		{
+			name:     "fold negative result",
+			src:      "push constant 2\npush constant 7\nsub",
+			expected: "push constant 4\nnot",
+		},
+		{
+			name:     "fold true",
+			src:      "push constant 0\nnot\nnot",
+			expected: "push constant 0",
+		},
+		{
+			name:     "fold comparison",
+			src:      "push constant 1\npush constant 1\neq",
+			expected: "push constant 0\nnot",
+		},
+		{
+			name:     "multiply by a power of two",
+			src:      "push local 0\npush constant 4\ncall Math.multiply 2",
+			expected: "push local 0\npop temp 7\npush temp 7\npush temp 7\nadd\npop temp 7\npush temp 7\npush temp 7\nadd",
+		},
+		{
+			name:     "multiply with temp 7 live",
+			src:      "push constant 5\npop temp 7\npush local 0\npush constant 2\ncall Math.multiply 2\npush temp 7\nadd",
+			expected: "push constant 5\npop temp 7\npush local 0\npush constant 2\ncall Math.multiply 2\npush temp 7\nadd",
+		},
+		{
+			name:     "divide by one",
+			src:      "push local 0\npush constant 1\ncall Math.divide 2",
+			expected: "push local 0",
+		},
+		{
+			name:     "divide by a larger power of two",
+			src:      "push local 0\npush constant 8\ncall Math.divide 2",
+			expected: "push local 0\npush constant 8\ncall Math.divide 2",
+		},
+		{
+			name:     "push pop",
+			src:      "push local 1\npop local 1\npush local 1\npop local 2",
+			expected: "push local 1\npop local 2",
+		},
+		{
+			name:     "thread jumps",
+			src:      "function Main.f 0\npush argument 0\nif-goto A\ngoto A\nlabel A\ngoto B\nlabel B\nlabel C\npush constant 0\nreturn",
+			expected: "function Main.f 0\npush argument 0\nif-goto B\nlabel B\npush constant 0\nreturn",
+		},
+		{
+			name:     "unreachable code",
+			src:      "function Main.f 0\ngoto END\npush constant 1\npop local 0\nlabel UNUSED\npush constant 2\nlabel END\npush constant 0\nreturn\npush constant 3\nfunction Main.g 0\npush constant 0\nreturn",
+			expected: "function Main.f 0\npush constant 0\nreturn\nfunction Main.g 0\npush constant 0\nreturn",
+		},
+		{
+			name:     "halting loop",
+			src:      "function Sys.init 0\nlabel END\ngoto END",
+			expected: "function Sys.init 0\nlabel END\ngoto END",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			optimized := optimizeProgram([]vmFile{{fname: "Main", commands: parseVmCommands(t, tc.src)}})[0]
+
+			lines := []string{}
+			for _, command := range optimized.commands {
+				lines = append(lines, command.String())
+			}
+			if got := strings.Join(lines, "\n"); got != tc.expected {
+				t.Errorf("Optimized to:\n%s\n\nExpected:\n%s", got, tc.expected)
+			}
+		})
+	}
+}
+
+// A caller in another file keeping a value in temp 7 across a call leaves the multiplies of the
+// function it calls alone
+func TestOptimizeProgramTemp(t *testing.T) {
+	vmFiles := []vmFile{
+		{fname: "A", commands: parseVmCommands(t, "function A.main 0\npush constant 5\npop temp 7\npush constant 3\ncall B.f 1\npop temp 0\npush temp 7\nreturn")},
+		{fname: "B", commands: parseVmCommands(t, "function B.f 0\npush argument 0\npush constant 4\ncall Math.multiply 2\nreturn")},
+	}
+	optimized := optimizeProgram(vmFiles)
+
+	lines := []string{}
+	for _, command := range optimized[1].commands {
+		lines = append(lines, command.String())
+	}
+	expected := "function B.f 0\npush argument 0\npush constant 4\ncall Math.multiply 2\nreturn"
+	if got := strings.Join(lines, "\n"); got != expected {
+		t.Errorf("Optimized to:\n%s\n\nExpected:\n%s", got, expected)
+	}
+}
+
+func TestOptimizedCoursePrograms(t *testing.T) {
+	for _, tc := range courseTestPrograms {
+		t.Run(tc.name, func(t *testing.T) {
+			runWatTestProgram(t, tc.name, tc.programDir, Options{Target: TargetWat, Optimize: true})
+		})
+	}
+}
@@ -1,99 +1,63 @@
 package vmtranslator
 
 import (
-	"bufio"
+	"jackvmt/vmast"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"unicode"
 )
 
-const (
-	c_arithmetic = iota
-	c_push
-	c_pop
-	c_label
-	c_goto
-	c_if
-	c_function
-	c_call
-	c_return
-)
-
-type parser struct {
-	hasMoreLines bool
-	currLine     string
-	scanner      *bufio.Scanner
-}
-
-func newParser(file *os.File) parser {
-	scanner := bufio.NewScanner(file)
-	return parser{
-		hasMoreLines: true,
-		scanner:      scanner,
+// Splits a line of vm code into the fields of its command, separated by any amount of whitespace,
+// and its trailing comment if it has one
+func tokenizeVmLine(line string) ([]string, string) {
+	code, comment, hasComment := strings.Cut(line, "//")
+	if !hasComment {
+		return strings.Fields(code), ""
 	}
+	return strings.Fields(code), "//" + strings.TrimRightFunc(comment, unicode.IsSpace)
 }
 
-func (p *parser) Advance() {
-	for p.scanner.Scan() {
-		line := strings.TrimSpace(p.scanner.Text())
-		if idx := strings.Index(line, "//"); idx != -1 {
-			line = strings.TrimSpace(line[:idx])
-		}
-		if len(line) == 0 {
-			continue
-		}
+// The commands of a vm file, named by the file name without its .vm extension
+type vmFile struct {
+	fname    string
+	commands []vmast.Command
+}
 
-		p.currLine = line
-		return
+func parseVmFile(vmFilePath string) vmFile {
+	f, err := os.Open(vmFilePath)
+	if err != nil {
+		log.Fatalf("vmtranslator.parseVmFile: %e\n", err)
 	}
+	defer f.Close()
 
-	p.hasMoreLines = false
-	if err := p.scanner.Err(); err != nil {
-		log.Fatal(err)
+	fname, _ := strings.CutSuffix(filepath.Base(vmFilePath), ".vm")
+	vmFile := vmFile{fname: fname}
+	for command, err := range vmast.Commands(f) {
+		if err != nil {
+			log.Fatalf("vmtranslator.parseVmFile: %s:%v\n", vmFilePath, err)
+		}
+		vmFile.commands = append(vmFile.commands, command)
 	}
-}
 
-func (p *parser) commandType() int {
-	switch cmd := strings.Split(p.currLine, " ")[0]; cmd {
-	case "add", "sub", "neg", "eq", "gt", "lt", "and", "or", "not":
-		return c_arithmetic
-	case "push":
-		return c_push
-	case "pop":
-		return c_pop
-	case "label":
-		return c_label
-	case "goto":
-		return c_goto
-	case "if-goto":
-		return c_if
-	case "function":
-		return c_function
-	case "call":
-		return c_call
-	case "return":
-		return c_return
-	default:
-		log.Fatal("Invalid command")
-		return -1
-	}
+	return vmFile
 }
 
-func (p *parser) arg1() string {
-	parts := strings.Split(p.currLine, " ")
-	if p.commandType() == c_arithmetic {
-		return parts[0]
-	}
-	if len(parts) < 2 {
-		return ""
+// Returns the segment and index a push or pop command accesses
+func segmentOperand(command vmast.Command) (string, int, bool) {
+	switch c := command.(type) {
+	case vmast.Push:
+		return c.Segment, c.Index, true
+	case vmast.Pop:
+		return c.Segment, c.Index, true
 	}
-	return parts[1]
+	return "", 0, false
 }
 
-func (p *parser) arg2() string {
-	parts := strings.Split(p.currLine, " ")
-	if len(parts) < 3 {
-		return ""
-	}
-	return parts[2]
+// Reports whether command is one of the arithmetic commands ops
+func isArithmetic(command vmast.Command, ops ...string) bool {
+	c, ok := command.(vmast.Arithmetic)
+	return ok && slices.Contains(ops, c.Op)
 }
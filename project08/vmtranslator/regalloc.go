@@ -0,0 +1,219 @@
+package vmtranslator
+
+import (
+	"cmp"
+	"fmt"
+	"jackvmt/vmast"
+	"maps"
+	"slices"
+)
+
+const (
+	// Most cells of the static segment given to leaf functions as registers
+	registerPoolSize = 8
+	// Segment of the cells a leaf function's locals and arguments are moved to. Its index is the
+	// cell's RAM address.
+	registerSegment = "ram"
+)
+
+// Not a vm command: a push fused with the binary arithmetic command after it
+type operate struct {
+	vmast.Node
+	op      string
+	operand vmast.Push
+}
+
+// Not a vm command: a push fused with the pop after it
+type move struct {
+	vmast.Node
+	src vmast.Push
+	dst vmast.Pop
+}
+
+func (c operate) String() string { return c.operand.String() + "\n" + c.op }
+func (c move) String() string    { return c.src.String() + "\n" + c.dst.String() }
+
+// Returns the cells of the static segment left after the program's static variables, which leaf
+// functions use as registers
+func (ml MemoryLayout) registerPool(statics []staticVar) []int {
+	pool := []int{}
+	for addr := ml.StaticStart + len(statics); addr <= ml.StaticLimit && len(pool) < registerPoolSize; addr++ {
+		pool = append(pool, addr)
+	}
+	return pool
+}
+
+// Moves the most used locals and arguments of each leaf function into the register pool and fuses
+// pushes with the command that consumes them. A leaf function runs to completion without any other
+// function running, so every leaf function can use the same cells.
+func allocateRegisters(file vmFile, pool []int) vmFile {
+	commands := []vmast.Command{}
+	for _, scope := range labelScopes(file.commands) {
+		if !isFunction(scope[0]) || slices.ContainsFunc(scope, isAnyCall) {
+			commands = append(commands, scope...)
+			continue
+		}
+		commands = append(commands, fuseOperands(assignRegisters(scope, pool))...)
+	}
+	return vmFile{fname: file.fname, commands: commands}
+}
+
+func isAnyCall(command vmast.Command) bool {
+	switch command.(type) {
+	case vmast.Call, tailCall:
+		return true
+	}
+	return false
+}
+
+// Rewrites the most used locals and arguments of a leaf function to registers, loading them on entry
+func assignRegisters(function []vmast.Command, pool []int) []vmast.Command {
+	type variable struct {
+		segment string
+		index   int
+	}
+	uses := map[variable]int{}
+	for _, command := range function[1:] {
+		if segment, index, ok := segmentOperand(command); ok && (segment == "local" || segment == "argument") {
+			uses[variable{segment, index}]++
+		}
+	}
+
+	// A variable used once costs more to load on entry than it saves
+	vars := slices.SortedFunc(maps.Keys(uses), func(a, b variable) int {
+		return cmp.Or(uses[b]-uses[a], cmp.Compare(a.segment, b.segment), cmp.Compare(a.index, b.index))
+	})
+	registers := map[variable]int{}
+	entry := []vmast.Command{function[0]}
+	for _, v := range vars {
+		if uses[v] < 2 || len(registers) == len(pool) {
+			break
+		}
+		reg := pool[len(registers)]
+		registers[v] = reg
+
+		load := vmast.Push{Segment: "constant", Index: 0}
+		if v.segment == "argument" {
+			load = vmast.Push{Segment: "argument", Index: v.index}
+		}
+		entry = append(entry, load, vmast.Pop{Segment: registerSegment, Index: reg})
+	}
+
+	commands := entry
+	for _, command := range function[1:] {
+		switch c := command.(type) {
+		case vmast.Push:
+			if reg, ok := registers[variable{c.Segment, c.Index}]; ok {
+				c.Segment, c.Index = registerSegment, reg
+				command = c
+			}
+		case vmast.Pop:
+			if reg, ok := registers[variable{c.Segment, c.Index}]; ok {
+				c.Segment, c.Index = registerSegment, reg
+				command = c
+			}
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// Fuses a push with the binary arithmetic command or the pop to a fixed address after it, so the
+// pushed value is kept in D rather than on the stack
+func fuseOperands(commands []vmast.Command) []vmast.Command {
+	fused := []vmast.Command{}
+	for i := 0; i < len(commands); i++ {
+		push, ok := commands[i].(vmast.Push)
+		if !ok || i+1 == len(commands) {
+			fused = append(fused, commands[i])
+			continue
+		}
+		var command vmast.Command = push
+		switch next := commands[i+1].(type) {
+		case vmast.Arithmetic:
+			if slices.Contains([]string{"add", "sub", "and", "or"}, next.Op) {
+				command = operate{Node: push.Node, op: next.Op, operand: push}
+				i++
+			}
+		case vmast.Pop:
+			if slices.Contains([]string{registerSegment, "static", "temp", "pointer"}, next.Segment) {
+				command = move{Node: push.Node, src: push, dst: next}
+				i++
+			}
+		}
+		fused = append(fused, command)
+	}
+	return fused
+}
+
+// Applies a binary arithmetic command to the top of the stack and an operand loaded straight into D
+func (cw *codeWriter) writeOperate(command string, operand vmast.Push) {
+	opMap := map[string]string{
+		"add": "+",
+		"sub": "-",
+		"and": "&",
+		"or":  "|",
+	}
+	op, _ := opMap[command]
+
+	cw.writeLoadOperand(operand)
+	cw.strBuilder.WriteString("@SP\n")
+	cw.strBuilder.WriteString("A=M-1\n")
+	fmt.Fprintf(cw.strBuilder, "M=M%sD\n", op)
+}
+
+// Copies an operand to a segment with a fixed address without going through the stack
+func (cw *codeWriter) writeMove(src vmast.Push, dst vmast.Pop) {
+	cw.writeLoadOperand(src)
+	fmt.Fprintf(cw.strBuilder, "@%d\n", cw.fixedAddr(dst.Segment, dst.Index))
+	cw.strBuilder.WriteString("M=D\n")
+}
+
+// Loads the value of a pushed operand into D
+func (cw *codeWriter) writeLoadOperand(operand vmast.Push) {
+	switch operand.Segment {
+	case "constant":
+		fmt.Fprintf(cw.strBuilder, "@%d\n", operand.Index)
+		cw.strBuilder.WriteString("D=A\n")
+	case "local", "argument", "this", "that":
+		fmt.Fprintf(cw.strBuilder, "@%s\n", cw.segmentMappings[operand.Segment])
+		cw.strBuilder.WriteString("D=M\n")
+		fmt.Fprintf(cw.strBuilder, "@%d\n", operand.Index)
+		cw.strBuilder.WriteString("A=D+A\n")
+		cw.strBuilder.WriteString("D=M\n")
+	default:
+		fmt.Fprintf(cw.strBuilder, "@%d\n", cw.fixedAddr(operand.Segment, operand.Index))
+		cw.strBuilder.WriteString("D=M\n")
+	}
+}
+
+// Returns the RAM address of a segment whose cells do not move with the frame
+func (cw *codeWriter) fixedAddr(segment string, index int) int {
+	switch segment {
+	case "static":
+		return cw.staticAddr(index)
+	case "temp":
+		return cw.layout.TempBase + index
+	case "pointer":
+		return pointerBase + index
+	}
+	return index
+}
+
+func (cw *codeWriter) writePushRegister(addr int) {
+	fmt.Fprintf(cw.strBuilder, "@%d\n", addr)
+	cw.strBuilder.WriteString("D=M\n")
+	cw.strBuilder.WriteString("@SP\n")
+	cw.strBuilder.WriteString("A=M\n")
+	cw.strBuilder.WriteString("M=D\n")
+	cw.strBuilder.WriteString("@SP\n")
+	cw.strBuilder.WriteString("M=M+1\n")
+}
+
+func (cw *codeWriter) writePopRegister(addr int) {
+	cw.strBuilder.WriteString("@SP\n")
+	cw.strBuilder.WriteString("AM=M-1\n")
+	cw.strBuilder.WriteString("D=M\n")
+	fmt.Fprintf(cw.strBuilder, "@%d\n", addr)
+	cw.strBuilder.WriteString("M=D\n")
+}
@@ -0,0 +1,67 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"jackvmt/vmast"
+	"strings"
+	"testing"
+)
+
+func TestAllocateRegisters(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "locals and arguments",
+			src:      "function Main.f 1\npush argument 0\npop local 0\npush local 0\npush argument 0\nadd\npush local 0\nadd\nreturn",
+			expected: "function Main.f 1\npush constant 0\npop ram 20\npush argument 0\npop ram 21\npush ram 21\npop ram 20\npush ram 20\npush ram 21\nadd\npush ram 20\nadd\nreturn",
+		},
+		{
+			name:     "single use",
+			src:      "function Main.f 0\npush argument 0\npush constant 1\nadd\nreturn",
+			expected: "function Main.f 0\npush argument 0\npush constant 1\nadd\nreturn",
+		},
+		{
+			name:     "not a leaf",
+			src:      "function Main.f 0\npush argument 0\npush argument 0\ncall Main.g 1\nadd\nreturn",
+			expected: "function Main.f 0\npush argument 0\npush argument 0\ncall Main.g 1\nadd\nreturn",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			allocated := allocateRegisters(vmFile{fname: "Main", commands: parseVmCommands(t, tc.src)}, []int{20, 21})
+
+			// Fused commands print as the commands they replace
+			lines := []string{}
+			for _, command := range allocated.commands {
+				lines = append(lines, command.String())
+			}
+			if got := strings.Join(lines, "\n"); got != tc.expected {
+				t.Errorf("Allocated to:\n%s\n\nExpected:\n%s", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFuseOperands(t *testing.T) {
+	commands := fuseOperands(parseVmCommands(t, "push constant 1\npush static 0\nsub\npush local 0\npop temp 2\npush this 1\nnot"))
+	expected := []vmast.Command{
+		vmast.Push{Segment: "constant", Index: 1},
+		operate{op: "sub", operand: vmast.Push{Segment: "static", Index: 0}},
+		move{src: vmast.Push{Segment: "local", Index: 0}, dst: vmast.Pop{Segment: "temp", Index: 2}},
+		vmast.Push{Segment: "this", Index: 1},
+		vmast.Arithmetic{Op: "not"},
+	}
+	if len(commands) != len(expected) {
+		t.Fatalf("Fused to %v, expected %v", commands, expected)
+	}
+	for i := range expected {
+		// Positions are left out of the comparison
+		if fmt.Sprintf("%T %v", commands[i], commands[i]) != fmt.Sprintf("%T %v", expected[i], expected[i]) {
+			t.Errorf("Command %d fused to %v, expected %v", i, commands[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"io"
+	"jackvmt/vmast"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const romSize = 32768
+
+// Counts of the assembly instructions written for a program, by vm function and by vm command
+type romStats struct {
+	// Functions in the order they are written to the output
+	functions []functionStats
+	commands  map[string]int
+}
+
+type functionStats struct {
+	name         string
+	instructions int
+}
+
+func newRomStats() romStats {
+	return romStats{
+		functions: []functionStats{},
+		commands:  map[string]int{},
+	}
+}
+
+// Records the instructions of asm, written for a command of the given function
+func (rs *romStats) add(fnName string, command string, asm string) {
+	n := countInstructions(asm)
+	if last := len(rs.functions) - 1; last >= 0 && rs.functions[last].name == fnName {
+		rs.functions[last].instructions += n
+	} else {
+		rs.functions = append(rs.functions, functionStats{name: fnName, instructions: n})
+	}
+	rs.commands[command] += n
+}
+
+// Appends the stats of a vm file translated after the ones already recorded
+func (rs *romStats) merge(other romStats) {
+	for _, fn := range other.functions {
+		if last := len(rs.functions) - 1; last >= 0 && rs.functions[last].name == fn.name {
+			rs.functions[last].instructions += fn.instructions
+		} else {
+			rs.functions = append(rs.functions, fn)
+		}
+	}
+	for command, n := range other.commands {
+		rs.commands[command] += n
+	}
+}
+
+// Labels take no room in ROM, every other line of asm is an instruction
+func countInstructions(asm string) int {
+	n := 0
+	for line := range strings.SplitSeq(asm, "\n") {
+		if line != "" && !strings.HasPrefix(line, "(") {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the name a vm command is counted under, arithmetic commands being counted by operation
+func commandName(command vmast.Command) string {
+	switch c := command.(type) {
+	case vmast.Arithmetic:
+		return c.Op
+	case vmast.Push:
+		return "push"
+	case vmast.Pop:
+		return "pop"
+	case vmast.Label:
+		return "label"
+	case vmast.Goto:
+		return "goto"
+	case vmast.IfGoto:
+		return "if-goto"
+	case vmast.Function:
+		return "function"
+	case vmast.Call:
+		return "call"
+	case vmast.Return:
+		return "return"
+	case tailCall:
+		return "tail call"
+	case operate:
+		return "push " + c.op
+	case move:
+		return "push pop"
+	}
+	return ""
+}
+
+// Writes the ROM usage of each function along with the addresses it is placed at, the usage of each
+// vm command, and the functions that do not fit in ROM
+func (rs romStats) writeReport(out io.Writer) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%-40s %12s  %s\n", "function", "instructions", "rom")
+	total := 0
+	overflowing := []string{}
+	for _, fn := range rs.functions {
+		fmt.Fprintf(&b, "%-40s %12d  %d-%d\n", fn.name, fn.instructions, total, total+fn.instructions-1)
+		if total+fn.instructions > romSize {
+			overflowing = append(overflowing, fn.name)
+		}
+		total += fn.instructions
+	}
+
+	fmt.Fprintf(&b, "\n%-40s %12s\n", "command", "instructions")
+	commands := slices.SortedFunc(maps.Keys(rs.commands), func(a, b string) int {
+		if rs.commands[a] != rs.commands[b] {
+			return rs.commands[b] - rs.commands[a]
+		}
+		return strings.Compare(a, b)
+	})
+	for _, command := range commands {
+		fmt.Fprintf(&b, "%-40s %12d\n", command, rs.commands[command])
+	}
+
+	fmt.Fprintf(&b, "\ntotal: %d of %d words (%.1f%%)\n", total, romSize, float64(total)*100/romSize)
+	if len(overflowing) > 0 {
+		fmt.Fprintf(&b, "over the ROM limit: %s\n", strings.Join(overflowing, ", "))
+	}
+
+	if _, err := io.WriteString(out, b.String()); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,47 @@
+package vmtranslator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRomReportTotal(t *testing.T) {
+	programDir := copyVmProgram(t, "../vm/FunctionCalls/FibonacciElement")
+
+	var report bytes.Buffer
+	Translate(programDir, Options{Report: &report})
+
+	asmFilePath := filepath.Join(programDir, "FibonacciElement.asm")
+	content, err := os.ReadFile(asmFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read generated output file %s: %v", asmFilePath, err)
+	}
+
+	expected := fmt.Sprintf("total: %d of %d words", countInstructions(string(content)), romSize)
+	if !strings.Contains(report.String(), expected) {
+		t.Errorf("Expected %q in report:\n%s", expected, report.String())
+	}
+	for _, fnName := range []string{"Bootstrap", "Sys.init", "Main.fibonacci"} {
+		if !strings.Contains(report.String(), fnName) {
+			t.Errorf("Expected function %s in report:\n%s", fnName, report.String())
+		}
+	}
+}
+
+func TestRomReportOverLimit(t *testing.T) {
+	rs := newRomStats()
+	rs.add("Main.small", "push", strings.Repeat("@SP\n", 100))
+	rs.add("Main.large", "call", strings.Repeat("@SP\n", romSize-50))
+	rs.add("Main.after", "push", "(Main.after)\n@SP\n")
+
+	var report bytes.Buffer
+	rs.writeReport(&report)
+
+	if !strings.Contains(report.String(), "over the ROM limit: Main.large, Main.after\n") {
+		t.Errorf("Expected Main.large and Main.after over the ROM limit:\n%s", report.String())
+	}
+}
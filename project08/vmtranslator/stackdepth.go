@@ -0,0 +1,224 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"io"
+	"jackvmt/vmast"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Words pushed by a call command to save the caller's frame
+const callFrameSize = 5
+
+// Stack usage of a vm function, counted in words above its LCL pointer
+type stackUsage struct {
+	nVars int
+	// Most words the function itself uses, including its local variables
+	localMax int
+	// Most words used while the function runs, including the frames of the functions it calls
+	worstCase int
+	// Set when the function is part of a call cycle. The recursive calls are then left out of the
+	// worst case, which becomes the depth of a single level of recursion.
+	recursive bool
+	// Set when a label is reached with different stack depths, in which case the largest one is used
+	unbalanced   bool
+	calls        []callSite
+	unknownCalls []string
+	visited      bool
+}
+
+// A call command along with the stack depth of the caller when the call is made, arguments included
+type callSite struct {
+	fnName string
+	depth  int
+}
+
+type stackAnalysis map[string]*stackUsage
+
+// Computes the stack usage of every function of a program
+func analyzeStack(vmFiles []vmFile) stackAnalysis {
+	sa := stackAnalysis{}
+	for _, vmFile := range vmFiles {
+		for fnName, body := range functionBodies(vmFile.commands) {
+			usage := &stackUsage{nVars: body[0].(vmast.Function).NVars}
+			usage.analyzeBody(body[1:])
+			sa[fnName] = usage
+		}
+	}
+
+	for _, fnName := range slices.Sorted(maps.Keys(sa)) {
+		sa.computeWorstCase(fnName, map[string]bool{})
+	}
+	return sa
+}
+
+// Splits the commands of a vm file by function, each body starting with its function command
+func functionBodies(commands []vmast.Command) map[string][]vmast.Command {
+	bodies := map[string][]vmast.Command{}
+	start := -1
+	for i, command := range commands {
+		if !isFunction(command) {
+			continue
+		}
+		if start != -1 {
+			bodies[commands[start].(vmast.Function).Name] = commands[start:i]
+		}
+		start = i
+	}
+	if start != -1 {
+		bodies[commands[start].(vmast.Function).Name] = commands[start:]
+	}
+	return bodies
+}
+
+// Follows every path through the function body, tracking the depth of the stack after each command
+func (usage *stackUsage) analyzeBody(body []vmast.Command) {
+	labels := map[string]int{}
+	for i, command := range body {
+		if label, ok := command.(vmast.Label); ok {
+			labels[label.Name] = i
+		}
+	}
+
+	depths := make([]int, len(body))
+	for i := range depths {
+		depths[i] = -1
+	}
+	usage.localMax = usage.nVars
+	calls := map[int]callSite{}
+
+	worklist := []int{}
+	enqueue := func(i int, depth int) {
+		if i >= len(body) {
+			return
+		}
+		if depths[i] != -1 {
+			if depths[i] != depth {
+				usage.unbalanced = true
+			}
+			// A loop that keeps growing the stack would otherwise never be done with
+			if depth <= depths[i] || depth > screenBase {
+				return
+			}
+		}
+		depths[i] = depth
+		worklist = append(worklist, i)
+	}
+	enqueue(0, usage.nVars)
+
+	for len(worklist) > 0 {
+		i := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		depth := depths[i]
+		command := body[i]
+
+		switch c := command.(type) {
+		case vmast.Push:
+			enqueue(i+1, depth+1)
+			usage.localMax = max(usage.localMax, depth+1)
+		case vmast.Pop:
+			enqueue(i+1, depth-1)
+		case vmast.Arithmetic:
+			if c.Op == "neg" || c.Op == "not" {
+				enqueue(i+1, depth)
+			} else {
+				enqueue(i+1, depth-1)
+			}
+		case vmast.Label:
+			enqueue(i+1, depth)
+		case vmast.Goto:
+			if target, ok := labels[c.Label]; ok {
+				enqueue(target, depth)
+			}
+		case vmast.IfGoto:
+			if target, ok := labels[c.Label]; ok {
+				enqueue(target, depth-1)
+			}
+			enqueue(i+1, depth-1)
+		case vmast.Call:
+			if site, ok := calls[i]; !ok || depth > site.depth {
+				calls[i] = callSite{fnName: c.Name, depth: depth}
+			}
+			// The return value takes the place of the arguments
+			enqueue(i+1, depth-c.NArgs+1)
+			usage.localMax = max(usage.localMax, depth-c.NArgs+1)
+		case vmast.Return:
+		}
+	}
+
+	for _, i := range slices.Sorted(maps.Keys(calls)) {
+		usage.calls = append(usage.calls, calls[i])
+	}
+}
+
+// Computes the worst case stack usage of a function by walking the call graph. Functions on the
+// current path are recursive calls, they are flagged and not followed.
+func (sa stackAnalysis) computeWorstCase(fnName string, onPath map[string]bool) int {
+	usage := sa[fnName]
+	if usage.visited {
+		return usage.worstCase
+	}
+
+	onPath[fnName] = true
+	worstCase := usage.localMax
+	for _, site := range usage.calls {
+		callee, ok := sa[site.fnName]
+		if !ok {
+			if !slices.Contains(usage.unknownCalls, site.fnName) {
+				usage.unknownCalls = append(usage.unknownCalls, site.fnName)
+			}
+			worstCase = max(worstCase, site.depth+callFrameSize)
+			continue
+		}
+		if onPath[site.fnName] {
+			usage.recursive = true
+			callee.recursive = true
+			worstCase = max(worstCase, site.depth+callFrameSize)
+			continue
+		}
+		worstCase = max(worstCase, site.depth+callFrameSize+sa.computeWorstCase(site.fnName, onPath))
+	}
+	delete(onPath, fnName)
+
+	usage.worstCase = worstCase
+	usage.visited = true
+	return worstCase
+}
+
+// Writes the stack usage of every function, and the deepest the stack can get when the program is
+// started through the bootstrap code
+func (sa stackAnalysis) writeReport(out io.Writer, boot bootstrap, layout MemoryLayout) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%-40s %6s %6s %10s\n", "function", "nVars", "own", "worst-case")
+	for _, fnName := range slices.Sorted(maps.Keys(sa)) {
+		usage := sa[fnName]
+		notes := []string{}
+		if usage.recursive {
+			notes = append(notes, "recursive")
+		}
+		if usage.unbalanced {
+			notes = append(notes, "unbalanced")
+		}
+		if len(usage.unknownCalls) > 0 {
+			notes = append(notes, "calls unknown "+strings.Join(usage.unknownCalls, ", "))
+		}
+		line := fmt.Sprintf("%-40s %6d %6d %10d  %s", fnName, usage.nVars, usage.localMax, usage.worstCase, strings.Join(notes, "; "))
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+
+	if usage, ok := sa[boot.entry]; ok && boot.enabled {
+		maxSp := layout.StackBase + callFrameSize + usage.worstCase
+		fmt.Fprintf(&b, "\nmax SP from %s: %d (heap starts at %d)\n", boot.entry, maxSp, layout.StackLimit)
+		if maxSp > layout.StackLimit {
+			fmt.Fprintf(&b, "warning: the stack can overflow into the heap\n")
+		}
+	}
+
+	if _, err := io.WriteString(out, b.String()); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package vmtranslator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeStack(t *testing.T) {
+	program := strings.Join([]string{
+		"function Sys.init 0",
+		"push constant 1",
+		"push constant 2",
+		"call Main.add 2",
+		"call Main.loop 1",
+		"call Main.fact 1",
+		"label END",
+		"goto END",
+		"function Main.add 1",
+		"push argument 0",
+		"push argument 1",
+		"add",
+		"return",
+		"function Main.loop 0",
+		"label LOOP",
+		"push argument 0",
+		"push constant 1",
+		"sub",
+		"pop argument 0",
+		"push argument 0",
+		"if-goto LOOP",
+		"push constant 0",
+		"return",
+		"function Main.fact 0",
+		"push argument 0",
+		"push argument 0",
+		"push constant 1",
+		"sub",
+		"call Main.fact 1",
+		"call Math.multiply 2",
+		"return",
+	}, "\n")
+	vmFilePath := filepath.Join(t.TempDir(), "Main.vm")
+	if err := os.WriteFile(vmFilePath, []byte(program), 0644); err != nil {
+		t.Fatalf("Failed to create vm file %s: %v", vmFilePath, err)
+	}
+
+	sa := analyzeStack([]vmFile{parseVmFile(vmFilePath)})
+
+	tests := []struct {
+		fnName    string
+		localMax  int
+		worstCase int
+		recursive bool
+		unknown   int
+	}{
+		{fnName: "Main.add", localMax: 3, worstCase: 3},
+		{fnName: "Main.loop", localMax: 2, worstCase: 2},
+		{fnName: "Main.fact", localMax: 3, worstCase: 7, recursive: true, unknown: 1},
+		{fnName: "Sys.init", localMax: 2, worstCase: 13},
+	}
+	for _, tc := range tests {
+		usage, ok := sa[tc.fnName]
+		if !ok {
+			t.Fatalf("Missing stack usage of %s", tc.fnName)
+		}
+		if usage.localMax != tc.localMax || usage.worstCase != tc.worstCase {
+			t.Errorf("%s: own %d, worst case %d, expected %d and %d", tc.fnName, usage.localMax, usage.worstCase, tc.localMax, tc.worstCase)
+		}
+		if usage.recursive != tc.recursive {
+			t.Errorf("%s: recursive %t, expected %t", tc.fnName, usage.recursive, tc.recursive)
+		}
+		if len(usage.unknownCalls) != tc.unknown {
+			t.Errorf("%s: calls unknown %v, expected %d", tc.fnName, usage.unknownCalls, tc.unknown)
+		}
+		if usage.unbalanced {
+			t.Errorf("%s: unexpectedly unbalanced", tc.fnName)
+		}
+	}
+}
+
+// Unbounded recursion traps before the frame of a call reaches the heap
+func TestStackCheckTraps(t *testing.T) {
+	programDir := t.TempDir()
+	files := map[string]string{
+		"Sys.vm": "function Sys.init 0\npush constant 0\ncall Main.deep 1\nlabel END\ngoto END\n",
+		"Main.vm": strings.Join([]string{
+			"function Main.deep 0",
+			"push argument 0",
+			"push constant 1",
+			"add",
+			"call Main.deep 1",
+			"return",
+		}, "\n"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(programDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create vm file %s: %v", name, err)
+		}
+	}
+	asmFilePath := filepath.Join(programDir, filepath.Base(programDir)+".asm")
+
+	m := loadTranslatedHackProgram(t, programDir, asmFilePath, Options{StackCheck: true})
+	for addr := CourseLayout.StackLimit; addr < CourseLayout.StackLimit+callFrameSize+1; addr++ {
+		m.ram[addr] = -1
+	}
+	if err := m.run(10_000_000); err != nil {
+		t.Fatalf("Failed to run %s: %v", asmFilePath, err)
+	}
+	if label := m.haltLabel(); label != stackOverflowLabel {
+		t.Errorf("Halted at %s, expected %s", label, stackOverflowLabel)
+	}
+	for addr := CourseLayout.StackLimit; addr < CourseLayout.StackLimit+callFrameSize+1; addr++ {
+		if m.ram[addr] != -1 {
+			t.Errorf("RAM[%d] = %d, expected the heap to be untouched", addr, m.ram[addr])
+		}
+	}
+}
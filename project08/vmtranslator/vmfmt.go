@@ -0,0 +1,92 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"strings"
+)
+
+const vmIndent = "    "
+
+// A line of vm code split into the fields of its command and its trailing comment
+type vmLine struct {
+	fields  []string
+	comment string
+}
+
+// Format normalizes the whitespace of vm code: the fields of a command are separated by a single
+// space, commands of a function are indented under it, comments are kept and runs of blank lines
+// are collapsed into one.
+func Format(src []byte) []byte {
+	lines := []vmLine{}
+	for line := range strings.SplitSeq(string(src), "\n") {
+		fields, comment := tokenizeVmLine(line)
+		lines = append(lines, vmLine{fields: fields, comment: comment})
+	}
+
+	// Comment lines are indented like the code they precede, so a comment heading a function stays
+	// in line with it
+	indents := make([]string, len(lines))
+	inFunction := false
+	for i, line := range lines {
+		if len(line.fields) == 0 {
+			continue
+		}
+		if line.fields[0] == "function" {
+			inFunction = true
+		} else if inFunction {
+			indents[i] = vmIndent
+		}
+	}
+	nextIndent := ""
+	if inFunction {
+		nextIndent = vmIndent
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if len(lines[i].fields) > 0 {
+			nextIndent = indents[i]
+		} else {
+			indents[i] = nextIndent
+		}
+	}
+
+	var b strings.Builder
+	pendingBlank := false
+	for i, line := range lines {
+		if len(line.fields) == 0 && line.comment == "" {
+			pendingBlank = b.Len() > 0
+			continue
+		}
+		if pendingBlank {
+			b.WriteString("\n")
+			pendingBlank = false
+		}
+
+		b.WriteString(indents[i])
+		b.WriteString(strings.Join(line.fields, " "))
+		if len(line.fields) > 0 && line.comment != "" {
+			b.WriteString(" ")
+		}
+		b.WriteString(line.comment)
+		b.WriteString("\n")
+	}
+
+	return []byte(b.String())
+}
+
+// Compare reports the first command that differs between two vm files. Whitespace, comments and
+// leading zeros of numbers are not differences.
+func Compare(vmFilePathA string, vmFilePathB string) error {
+	a, b := parseVmFile(vmFilePathA), parseVmFile(vmFilePathB)
+	for i := range max(len(a.commands), len(b.commands)) {
+		if i >= len(a.commands) {
+			return fmt.Errorf("command %d: %s has no command, %s has %q", i+1, vmFilePathA, vmFilePathB, b.commands[i].String())
+		}
+		if i >= len(b.commands) {
+			return fmt.Errorf("command %d: %s has %q, %s has no command", i+1, vmFilePathA, a.commands[i].String(), vmFilePathB)
+		}
+		if ca, cb := a.commands[i].String(), b.commands[i].String(); ca != cb {
+			return fmt.Errorf("command %d: %s has %q, %s has %q", i+1, vmFilePathA, ca, vmFilePathB, cb)
+		}
+	}
+	return nil
+}
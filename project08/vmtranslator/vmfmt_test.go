@@ -0,0 +1,73 @@
+package vmtranslator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "whitespace",
+			src:      "push\tconstant   7 \r\n  add\r\n",
+			expected: "push constant 7\nadd\n",
+		},
+		{
+			name:     "function body",
+			src:      "// Adds one\nfunction Main.inc 0\npush argument 0 // n\n\n\n  // plus one\npush constant 1\nadd\nreturn\n",
+			expected: "// Adds one\nfunction Main.inc 0\n    push argument 0 // n\n\n    // plus one\n    push constant 1\n    add\n    return\n",
+		},
+		{
+			name:     "blank lines at the edges",
+			src:      "\n\nlabel LOOP\ngoto LOOP\n\n\n",
+			expected: "label LOOP\ngoto LOOP\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(Format([]byte(tc.src))); got != tc.expected {
+				t.Errorf("Formatted to %q, expected %q", got, tc.expected)
+			}
+			if got := string(Format([]byte(tc.expected))); got != tc.expected {
+				t.Errorf("Formatting is not idempotent: %q formatted to %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"A.vm": "function Main.f 0\npush constant 7\nreturn\n",
+		"B.vm": "// same commands\nfunction  Main.f\t0\n    push constant 007 // seven\n    return",
+		"C.vm": "function Main.f 0\npush constant 8\nreturn\n",
+		"D.vm": "function Main.f 0\npush constant 7\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create vm file %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{a: "A.vm", b: "B.vm", equal: true},
+		{a: "A.vm", b: "C.vm", equal: false},
+		{a: "A.vm", b: "D.vm", equal: false},
+		{a: "D.vm", b: "A.vm", equal: false},
+	}
+	for _, tc := range tests {
+		err := Compare(filepath.Join(dir, tc.a), filepath.Join(dir, tc.b))
+		if (err == nil) != tc.equal {
+			t.Errorf("Compare(%s, %s) = %v, expected equal %t", tc.a, tc.b, err, tc.equal)
+		}
+	}
+}
@@ -1,93 +1,339 @@
 package vmtranslator
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"jackvmt/vmast"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 )
 
+const (
+	TargetHack = "hack"
+	TargetC    = "c"
+	TargetWat  = "wat"
+)
+
+// Options configures a translation. The zero value translates a program to Hack assembly.
+type Options struct {
+	Target string
+	// Receives a report of the stack usage of each function when set
+	StackReport io.Writer
+	// Guards function entries against the stack growing into the heap. Hack target only.
+	StackCheck bool
+	// Makes a call immediately followed by return reuse the current frame. Hack target only.
+	TailCalls bool
+	// Keeps the most used locals and arguments of leaf functions in spare static cells and evaluates
+	// pushes feeding arithmetic or a pop without the stack. Hack target only.
+	AllocateRegisters bool
+	// Receives a report of the ROM used by each function and vm command when set. Hack target only.
+	Report io.Writer
+	// Runs the vm optimizer over each vm file before it is translated
+	Optimize bool
+	// Replaces calls to leaf functions of at most this many commands with their body, 0 to not inline
+	Inline int
+	// Places the stack, segments and static variables in RAM, the course's layout when nil
+	Layout *MemoryLayout
+	// Whether the bootstrap code is written: auto (the default), force or none
+	Bootstrap string
+	// Function the bootstrap code calls, Sys.init by default
+	Entry string
+	// What happens once the entry function returns: halt (the default), reset or trap
+	OnReturn string
+	// Function called when the entry function returns and OnReturn is trap, Sys.halt by default
+	Trap string
+}
+
 type vmTranslator struct {
-	vmFilePaths []string
-	asmFile     *os.File
-	codeWriter  codeWriter
-	shouldInit  bool
+	vmFiles []vmFile
+	outFile *os.File
+	boot    bootstrap
+	opts    Options
+	layout  MemoryLayout
+	statics []staticVar
+}
+
+// Implemented by each backend to translate the commands of a single vm file
+type commandWriter interface {
+	setCurrFname(vmFileFname string)
+	write(command vmast.Command)
+}
+
+func Translate(programPath string, opts Options) {
+	vmt := newVmTranslator(programPath, opts)
+	defer vmt.outFile.Close()
+
+	if opts.StackReport != nil {
+		analyzeStack(vmt.vmFiles).writeReport(opts.StackReport, vmt.boot, vmt.layout)
+	}
+
+	switch opts.Target {
+	case TargetHack, "":
+		vmt.translateToHack()
+	case TargetC:
+		vmt.translateToC()
+	case TargetWat:
+		vmt.translateToWat()
+	}
 }
 
-func Translate(programPath string) {
-	vmt := newVmTranslator(programPath)
-	defer vmt.asmFile.Close()
+func (vmt *vmTranslator) translateToHack() {
+	// Each writer records into its own stats, which are merged in output order
+	var stats []romStats
+	if vmt.opts.Report != nil {
+		stats = make([]romStats, len(vmt.vmFiles)+1)
+		for i := range stats {
+			stats[i] = newRomStats()
+		}
+	}
+	statics := staticAddrs(vmt.statics)
+	newWriter := func(out io.Writer, statsIdx int) codeWriter {
+		cw := newCodeWriter(out, vmt.layout)
+		cw.statics = statics
+		if stats != nil {
+			cw.stats = &stats[statsIdx]
+		}
+		return cw
+	}
+
+	if vmt.boot.enabled {
+		cw := newWriter(vmt.outFile, 0)
+		cw.setCurrFname("Bootstrap")
+		cw.writeInit(vmt.boot)
+	}
+
+	var sa stackAnalysis
+	if vmt.opts.StackCheck {
+		sa = analyzeStack(vmt.vmFiles)
+	}
+	if vmt.opts.TailCalls {
+		for i := range vmt.vmFiles {
+			vmt.vmFiles[i] = markTailCalls(vmt.vmFiles[i])
+		}
+	}
+	if vmt.opts.AllocateRegisters {
+		pool := vmt.layout.registerPool(vmt.statics)
+		for i := range vmt.vmFiles {
+			vmt.vmFiles[i] = allocateRegisters(vmt.vmFiles[i], pool)
+		}
+	}
+	vmt.translateVmFiles(func(i int, out io.Writer) commandWriter {
+		cw := newWriter(out, i+1)
+		if sa != nil {
+			cw.setStackCheck(sa)
+		}
+		return &cw
+	}).writeTo(vmt.outFile)
+
+	var rs romStats
+	if stats != nil {
+		rs = stats[0]
+		for _, fileStats := range stats[1:] {
+			rs.merge(fileStats)
+		}
+	}
+
+	if sa != nil {
+		cw := newCodeWriter(vmt.outFile, vmt.layout)
+		if stats != nil {
+			cw.stats = &rs
+		}
+		cw.writeStackOverflow()
+	}
 
-	if vmt.shouldInit {
-		vmt.codeWriter.strBuilder.Reset()
-		vmt.codeWriter.writeInit()
+	// The bootstrap code handles entering an infinite loop once the entry function returns. If it
+	// is not present however, add an end of program loop manually.
+	if !vmt.boot.enabled {
+		fname, _ := strings.CutSuffix(filepath.Base(vmt.outFile.Name()), ".asm")
+		endLoop := fmt.Sprintf("(%s.END_LOOP)\n@%s.END_LOOP\n0;JEQ\n", fname, fname)
+		if _, err := io.WriteString(vmt.outFile, endLoop); err != nil {
+			log.Fatal(err)
+		}
+		if stats != nil {
+			rs.add(fname+".END_LOOP", "end loop", endLoop)
+		}
 	}
 
-	for _, fPath := range vmt.vmFilePaths {
-		vmt.translateVmFile(fPath)
+	if stats != nil {
+		rs.writeReport(vmt.opts.Report)
 	}
+}
 
-	// The Sys.init function handles entering an infinite loop after execution on behalf of
-	// our program. If it is not present however, add an end of program loop manually.
-	if !vmt.shouldInit {
-		fname, _ := strings.CutSuffix(filepath.Base(vmt.asmFile.Name()), ".asm")
-		fmt.Fprintf(vmt.asmFile, "(%s.END_LOOP)\n@%s.END_LOOP\n0;JEQ\n", fname, fname)
+func (vmt *vmTranslator) translateToC() {
+	cWriters := make([]cWriter, len(vmt.vmFiles))
+	fileBufs := vmt.translateVmFiles(func(i int, out io.Writer) commandWriter {
+		cWriters[i] = newCWriter(out, vmt.layout)
+		return &cWriters[i]
+	})
+
+	fileBodies := []string{}
+	for i := range cWriters {
+		cWriters[i].close()
+		fileBodies = append(fileBodies, fileBufs[i].String())
 	}
+	writeCProgram(vmt.outFile, cWriters, fileBodies, vmt.statics, vmt.boot, vmt.layout)
 }
 
-func (vmt *vmTranslator) translateVmFile(vmFilePath string) {
-	f, err := os.Open(vmFilePath)
-	if err != nil {
-		log.Fatalf("vmtranslator.translateVmFile: %e\n", err)
+func (vmt *vmTranslator) translateToWat() {
+	watWriters := make([]watWriter, len(vmt.vmFiles))
+	fileBufs := vmt.translateVmFiles(func(i int, out io.Writer) commandWriter {
+		watWriters[i] = newWatWriter(out, vmt.layout)
+		return &watWriters[i]
+	})
+
+	fileBodies := []string{}
+	for i := range watWriters {
+		watWriters[i].close()
+		fileBodies = append(fileBodies, fileBufs[i].String())
+	}
+	writeWatProgram(vmt.outFile, watWriters, fileBodies, vmt.statics, vmt.boot, vmt.layout)
+}
+
+type translatedFiles []bytes.Buffer
+
+// Translates each vm file concurrently into its own buffer, using the writer returned by newWriter
+// for the file. The buffers are returned in the order of vmFiles so the output of a translation
+// does not depend on goroutine scheduling.
+func (vmt *vmTranslator) translateVmFiles(newWriter func(i int, out io.Writer) commandWriter) translatedFiles {
+	bufs := make(translatedFiles, len(vmt.vmFiles))
+	var wg sync.WaitGroup
+	for i, vmFile := range vmt.vmFiles {
+		writer := newWriter(i, &bufs[i])
+		wg.Go(func() {
+			translateVmFile(vmFile, writer)
+		})
+	}
+	wg.Wait()
+
+	return bufs
+}
+
+func (tf translatedFiles) writeTo(out io.Writer) {
+	for i := range tf {
+		if _, err := tf[i].WriteTo(out); err != nil {
+			log.Fatal(err)
+		}
 	}
-	defer f.Close()
+}
 
-	// Sets the filename attr on our codewrite for use in creating unique symbols
-	vmFname, _ := strings.CutSuffix(filepath.Base(vmFilePath), ".vm")
-	vmt.codeWriter.setCurrFname(vmFname)
+func translateVmFile(vmFile vmFile, writer commandWriter) {
+	// Sets the filename attr on our writer for use in creating unique symbols
+	writer.setCurrFname(vmFile.fname)
 
-	parser := newParser(f)
-	parser.Advance()
-	for parser.hasMoreLines {
-		vmt.codeWriter.write(parser.commandType(), parser.arg1(), parser.arg2())
-		parser.Advance()
+	for _, command := range vmFile.commands {
+		writer.write(command)
 	}
 }
 
-func newVmTranslator(programPath string) vmTranslator {
-	var asmFilePath string
+// Parses the vm files of a program concurrently, keeping them in the order of vmFilePaths
+func loadVmFiles(vmFilePaths []string) []vmFile {
+	vmFiles := make([]vmFile, len(vmFilePaths))
+	var wg sync.WaitGroup
+	for i, vmFilePath := range vmFilePaths {
+		wg.Go(func() {
+			if strings.HasSuffix(vmFilePath, ".vmb") {
+				vmFiles[i] = parseVmbFile(vmFilePath)
+			} else {
+				vmFiles[i] = parseVmFile(vmFilePath)
+			}
+		})
+	}
+	wg.Wait()
+
+	return vmFiles
+}
+
+func newVmTranslator(programPath string, opts Options) vmTranslator {
+	var outFilePath string
 	var vmFilePaths []string
-	shouldInit := false
+	hasSysVm := false
+
+	outExt := ".asm"
+	switch opts.Target {
+	case TargetHack, "":
+	case TargetC:
+		outExt = ".c"
+	case TargetWat:
+		outExt = ".wat"
+	default:
+		log.Fatalf("vmtranslator.newVmTranslator: unknown target %s\n", opts.Target)
+	}
+	if opts.StackCheck && outExt != ".asm" {
+		log.Fatalf("vmtranslator.newVmTranslator: the stack check is not supported by the %s target\n", opts.Target)
+	}
+	if opts.AllocateRegisters && outExt != ".asm" {
+		log.Fatalf("vmtranslator.newVmTranslator: register allocation is not supported by the %s target\n", opts.Target)
+	}
+	if opts.TailCalls && outExt != ".asm" {
+		log.Fatalf("vmtranslator.newVmTranslator: tail calls are not supported by the %s target\n", opts.Target)
+	}
+	if opts.Report != nil && outExt != ".asm" {
+		log.Fatalf("vmtranslator.newVmTranslator: the ROM report is not supported by the %s target\n", opts.Target)
+	}
 
-	if strings.HasSuffix(programPath, ".vm") {
+	if isVmFilePath(programPath) {
 		vmFilePaths = append(vmFilePaths, programPath)
-		asmFilePath = strings.Replace(programPath, ".vm", ".asm", 1)
+		outFilePath = strings.TrimSuffix(programPath, filepath.Ext(programPath)) + outExt
 	} else {
 		vmFilePaths = getVmPathsFromDir(programPath)
 		for _, vmFilePath := range vmFilePaths {
-			if filepath.Base(vmFilePath) == "Sys.vm" {
-				shouldInit = true
+			if isSysVm(vmFilePath) {
+				hasSysVm = true
 			}
 		}
 
-		asmFilePath = programPath + fmt.Sprintf("/%s.asm", filepath.Base(programPath))
+		outFilePath = programPath + fmt.Sprintf("/%s%s", filepath.Base(programPath), outExt)
+	}
+
+	layout := CourseLayout
+	if opts.Layout != nil {
+		layout = *opts.Layout
+	}
+	if err := layout.validate(); err != nil {
+		log.Fatalf("vmtranslator.Translate: invalid memory layout: %v", err)
+	}
+
+	vmFiles := loadVmFiles(vmFilePaths)
+	if opts.Inline > 0 {
+		vmFiles = inlineFunctions(vmFiles, opts.Inline)
 	}
+	if opts.Optimize {
+		vmFiles = optimizeProgram(vmFiles)
+	}
+	statics := layout.allocateStatics(vmFiles)
 
-	asmFile, err := os.Create(asmFilePath)
+	outFile, err := os.Create(outFilePath)
 	if err != nil {
 		log.Fatalf("vmtranslator.newVmTranslator: %e\n", err)
 	}
 
-	codeWriter := newCodeWriter(asmFile)
 	return vmTranslator{
-		vmFilePaths: vmFilePaths,
-		asmFile:     asmFile,
-		codeWriter:  codeWriter,
-		shouldInit:  shouldInit,
+		vmFiles: vmFiles,
+		layout:  layout,
+		statics: statics,
+		outFile: outFile,
+		boot:    newBootstrap(opts, vmFiles, hasSysVm),
+		opts:    opts,
 	}
 }
 
+// Vm files are either vm code (.vm) or bytecode (.vmb)
+func isVmFilePath(path string) bool {
+	return strings.HasSuffix(path, ".vm") || strings.HasSuffix(path, ".vmb")
+}
+
+func isSysVm(vmFilePath string) bool {
+	base := filepath.Base(vmFilePath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) == "Sys"
+}
+
+// Returns the paths of the vm files in a directory in translation order: Sys.vm first, followed by
+// the remaining files sorted by name
 func getVmPathsFromDir(dirPath string) []string {
 	dirEntries, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -95,8 +341,15 @@ func getVmPathsFromDir(dirPath string) []string {
 	}
 
 	vmFilePaths := []string{}
+	fnames := map[string]bool{}
 	for _, entry := range dirEntries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".vm") {
+		if !entry.IsDir() && isVmFilePath(entry.Name()) {
+			// A class given both as vm code and bytecode would be translated twice
+			fname := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			if fnames[fname] {
+				log.Fatalf("vmtranslator.getVmPathsFromDir: %s is both a .vm and a .vmb file", fname)
+			}
+			fnames[fname] = true
 			vmFilePaths = append(vmFilePaths, fmt.Sprintf("%s/%s", dirPath, entry.Name()))
 		}
 	}
@@ -104,5 +357,16 @@ func getVmPathsFromDir(dirPath string) []string {
 		log.Fatal("vmtranslator.getVmPathsFromDir: input directory contains no vm file for translation")
 	}
 
+	slices.SortFunc(vmFilePaths, func(a, b string) int {
+		aIsSys, bIsSys := isSysVm(a), isSysVm(b)
+		if aIsSys != bIsSys {
+			if aIsSys {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
 	return vmFilePaths
 }
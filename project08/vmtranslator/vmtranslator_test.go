@@ -0,0 +1,289 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Copies the vm files of a test program into a temporary directory so translating it does not
+// overwrite the reference .asm files checked into the repo
+func copyVmProgram(t *testing.T, srcDir string) string {
+	t.Helper()
+
+	dstDir := filepath.Join(t.TempDir(), filepath.Base(srcDir))
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		t.Fatalf("Failed to create program directory %s: %v", dstDir, err)
+	}
+
+	vmFilePaths, err := filepath.Glob(filepath.Join(srcDir, "*.vm"))
+	if err != nil {
+		t.Fatalf("Failed to list vm files in %s: %v", srcDir, err)
+	}
+	for _, vmFilePath := range vmFilePaths {
+		content, err := os.ReadFile(vmFilePath)
+		if err != nil {
+			t.Fatalf("Failed to read vm file %s: %v", vmFilePath, err)
+		}
+		if err := os.WriteFile(filepath.Join(dstDir, filepath.Base(vmFilePath)), content, 0644); err != nil {
+			t.Fatalf("Failed to copy vm file %s: %v", vmFilePath, err)
+		}
+	}
+
+	return dstDir
+}
+
+func TestTranslateDeterministic(t *testing.T) {
+	programDir := copyVmProgram(t, "../vm/FunctionCalls/StaticsTest")
+	asmFilePath := filepath.Join(programDir, "StaticsTest.asm")
+
+	var firstContent string
+	for run := range 20 {
+		Translate(programDir, Options{})
+
+		content, err := os.ReadFile(asmFilePath)
+		if err != nil {
+			t.Fatalf("Failed to read generated output file %s: %v", asmFilePath, err)
+		}
+		if run == 0 {
+			firstContent = string(content)
+			continue
+		}
+		if string(content) != firstContent {
+			t.Fatalf("Output of run %d differs from the first run:\n%s\n\nFirst run:\n%s", run, content, firstContent)
+		}
+	}
+
+	// Sys.vm is translated first, followed by the remaining files in sorted order
+	sysIdx := strings.Index(firstContent, "(Sys.init)")
+	class1Idx := strings.Index(firstContent, "(Class1.set)")
+	class2Idx := strings.Index(firstContent, "(Class2.set)")
+	if sysIdx == -1 || class1Idx == -1 || class2Idx == -1 {
+		t.Fatalf("Generated output is missing a function label:\n%s", firstContent)
+	}
+	if !(sysIdx < class1Idx && class1Idx < class2Idx) {
+		t.Errorf("Functions written out of order: Sys.init at %d, Class1.set at %d, Class2.set at %d", sysIdx, class1Idx, class2Idx)
+	}
+}
+
+func TestTranslateLabelNamespaces(t *testing.T) {
+	programDir := t.TempDir()
+	files := map[string]string{
+		"Sys.vm": "function Sys.init 0\ncall A.f 0\ncall B.f 0\nlabel END\ngoto END\n",
+		"A.vm":   "function A.f 0\nlabel LOOP\npush constant 1\npush constant 1\neq\nreturn\n",
+		"B.vm":   "function B.f 0\nlabel LOOP\npush constant 1\npush constant 1\neq\nreturn\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(programDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create vm file %s: %v", name, err)
+		}
+	}
+
+	Translate(programDir, Options{})
+
+	asmFilePath := filepath.Join(programDir, filepath.Base(programDir)+".asm")
+	content, err := os.ReadFile(asmFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read generated output file %s: %v", asmFilePath, err)
+	}
+
+	labels := map[string]bool{}
+	for line := range strings.SplitSeq(string(content), "\n") {
+		if strings.HasPrefix(line, "(") {
+			if labels[line] {
+				t.Errorf("Label %s is defined more than once", line)
+			}
+			labels[line] = true
+		}
+	}
+	for _, label := range []string{"(A.f$LOOP)", "(B.f$LOOP)", "(Sys.init$END)"} {
+		if !labels[label] {
+			t.Errorf("Expected label %s in generated output", label)
+		}
+	}
+}
+
+var ramRefRegex = regexp.MustCompile(`RAM\[(\d+)\]`)
+var ramSetRegex = regexp.MustCompile(`set\s+RAM\[(\d+)\]\s+(-?\d+)`)
+
+// Reads the RAM a course test script initializes before running a program and the RAM values it
+// expects once the program has run. The expected addresses come from the output-list commands of
+// the .tst file and the values from the rows of the .cmp file.
+func readTestScript(t *testing.T, tstFilePath string, cmpFilePath string) (map[int]int, map[int]int) {
+	t.Helper()
+
+	tst, err := os.ReadFile(tstFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read test script %s: %v", tstFilePath, err)
+	}
+	initial := map[int]int{}
+	addrs := []int{}
+	for _, stmt := range strings.FieldsFunc(stripTstComments(string(tst)), func(r rune) bool { return r == ',' || r == ';' }) {
+		if match := ramSetRegex.FindStringSubmatch(stmt); match != nil {
+			addr, _ := strconv.Atoi(match[1])
+			value, _ := strconv.Atoi(match[2])
+			initial[addr] = value
+		}
+		if idx := strings.Index(stmt, "output-list"); idx != -1 {
+			for _, match := range ramRefRegex.FindAllStringSubmatch(stmt[idx:], -1) {
+				addr, _ := strconv.Atoi(match[1])
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+
+	cmp, err := os.ReadFile(cmpFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read compare file %s: %v", cmpFilePath, err)
+	}
+	values := []int{}
+	for line := range strings.SplitSeq(string(cmp), "\n") {
+		if strings.Contains(line, "RAM") {
+			continue
+		}
+		for field := range strings.SplitSeq(line, "|") {
+			if field = strings.TrimSpace(field); field != "" {
+				value, err := strconv.Atoi(field)
+				if err != nil {
+					t.Fatalf("Invalid value %q in compare file %s", field, cmpFilePath)
+				}
+				values = append(values, value)
+			}
+		}
+	}
+
+	if len(addrs) != len(values) {
+		t.Fatalf("Test script %s outputs %d values but %s holds %d", tstFilePath, len(addrs), cmpFilePath, len(values))
+	}
+	expected := map[int]int{}
+	for i, addr := range addrs {
+		expected[addr] = values[i]
+	}
+	return initial, expected
+}
+
+func stripTstComments(stmt string) string {
+	lines := []string{}
+	for line := range strings.SplitSeq(stmt, "\n") {
+		if idx := strings.Index(line, "//"); idx != -1 {
+			line = line[:idx]
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Course test programs along with the name of their test script. Programs without a Sys.vm expect
+// the test script to set up the stack and segments before they run.
+var courseTestPrograms = []struct {
+	name       string
+	programDir string
+}{
+	{name: "SimpleAdd", programDir: "../../project07/vm/StackArithmetic/SimpleAdd"},
+	{name: "StackTest", programDir: "../../project07/vm/StackArithmetic/StackTest"},
+	{name: "BasicTest", programDir: "../../project07/vm/MemoryAccess/BasicTest"},
+	{name: "PointerTest", programDir: "../../project07/vm/MemoryAccess/PointerTest"},
+	{name: "StaticTest", programDir: "../../project07/vm/MemoryAccess/StaticTest"},
+	{name: "BasicLoop", programDir: "../vm/ProgramFlow/BasicLoop"},
+	{name: "FibonacciSeries", programDir: "../vm/ProgramFlow/FibonacciSeries"},
+	{name: "SimpleFunction", programDir: "../vm/FunctionCalls/SimpleFunction"},
+	{name: "FibonacciElement", programDir: "../vm/FunctionCalls/FibonacciElement"},
+	{name: "NestedCall", programDir: "../vm/FunctionCalls/NestedCall"},
+	{name: "StaticsTest", programDir: "../vm/FunctionCalls/StaticsTest"},
+}
+
+// Returns the path vm files of a copied course test program are translated to. Programs made of a
+// single vm file are translated file by file like the course test scripts expect.
+func translatedPath(programDir string, name string, ext string) (string, string) {
+	vmFilePath := filepath.Join(programDir, name+".vm")
+	if _, err := os.Stat(vmFilePath); err == nil {
+		return vmFilePath, filepath.Join(programDir, name+ext)
+	}
+	return programDir, filepath.Join(programDir, name+ext)
+}
+
+func TestTranslateToC(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("No C compiler available")
+	}
+
+	for _, tc := range courseTestPrograms {
+		t.Run(tc.name, func(t *testing.T) {
+			programDir := copyVmProgram(t, tc.programDir)
+			programPath, cFilePath := translatedPath(programDir, tc.name, ".c")
+			Translate(programPath, Options{Target: TargetC})
+
+			binPath := filepath.Join(programDir, tc.name)
+			if out, err := exec.Command(cc, "-o", binPath, cFilePath).CombinedOutput(); err != nil {
+				t.Fatalf("Failed to compile %s: %v\n%s", cFilePath, err, out)
+			}
+
+			initial, expected := readTestScript(t,
+				filepath.Join(tc.programDir, tc.name+".tst"),
+				filepath.Join(tc.programDir, tc.name+".cmp"))
+			args := []string{"-ram", "4096"}
+			for addr, value := range initial {
+				args = append(args, "-set", fmt.Sprintf("%d=%d", addr, value))
+			}
+			out, err := exec.Command(binPath, args...).Output()
+			if err != nil {
+				t.Fatalf("Failed to run %s: %v", binPath, err)
+			}
+
+			ram := map[int]int{}
+			for line := range strings.SplitSeq(strings.TrimSpace(string(out)), "\n") {
+				var addr, value int
+				if _, err := fmt.Sscanf(line, "RAM[%d] = %d", &addr, &value); err != nil {
+					t.Fatalf("Unexpected output line %q: %v", line, err)
+				}
+				ram[addr] = value
+			}
+
+			for addr, value := range expected {
+				if ram[addr] != value {
+					t.Errorf("RAM[%d] = %d, expected %d", addr, ram[addr], value)
+				}
+			}
+		})
+	}
+}
+
+// Functions named like the C runtime's own functions compile and run
+func TestTranslateToCRuntimeNames(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("No C compiler available")
+	}
+
+	programDir := filepath.Join(t.TempDir(), "Names")
+	if err := os.MkdirAll(programDir, 0755); err != nil {
+		t.Fatalf("Failed to create program directory %s: %v", programDir, err)
+	}
+	src := "function Sys.init 0\ncall call 0\ncall return 0\nadd\npop temp 0\ncall halt 0\n" +
+		"function call 0\npush constant 2\nreturn\n" +
+		"function return 0\npush constant 3\nreturn\n" +
+		"function halt 0\nlabel END\ngoto END\n"
+	if err := os.WriteFile(filepath.Join(programDir, "Sys.vm"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write Sys.vm: %v", err)
+	}
+	Translate(programDir, Options{Target: TargetC})
+
+	cFilePath := filepath.Join(programDir, "Names.c")
+	binPath := filepath.Join(programDir, "Names")
+	if out, err := exec.Command(cc, "-o", binPath, cFilePath).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to compile %s: %v\n%s", cFilePath, err, out)
+	}
+	out, err := exec.Command(binPath, "-ram", "6").Output()
+	if err != nil {
+		t.Fatalf("Failed to run %s: %v", binPath, err)
+	}
+	if !strings.Contains(string(out), "RAM[5] = 5\n") {
+		t.Errorf("Program printed:\n%s\nexpected RAM[5] = 5", out)
+	}
+}
@@ -0,0 +1,329 @@
+package vmtranslator
+
+import (
+	"fmt"
+	"io"
+	"jackvmt/vmast"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Runtime shared by every translated program. The Hack RAM is the memory imported from the host as
+// hack.ram, one 16-bit word per RAM address, so the host sees the screen and keyboard memory maps at
+// the byte offsets exported as SCREEN and KBD. The host also provides hack.halt, which is called in
+// place of the infinite loop a vm program ends with and is expected to stop execution.
+const watPrelude = `  (import "hack" "ram" (memory 1))
+  (import "hack" "halt" (func $halt))
+
+  (global $SCREEN (export "SCREEN") i32 (i32.const 32768))
+  (global $KBD (export "KBD") i32 (i32.const 49152))
+
+  (func $peek (param $addr i32) (result i32)
+    (i32.load16_s (i32.shl (i32.and (local.get $addr) (i32.const 32767)) (i32.const 1))))
+
+  (func $poke (param $addr i32) (param $value i32)
+    (i32.store16 (i32.shl (i32.and (local.get $addr) (i32.const 32767)) (i32.const 1)) (local.get $value)))
+
+  (func $push (param $value i32)
+    (call $poke (call $peek (i32.const 0)) (local.get $value))
+    (call $poke (i32.const 0) (i32.add (call $peek (i32.const 0)) (i32.const 1))))
+
+  (func $pop (result i32)
+    (call $poke (i32.const 0) (i32.sub (call $peek (i32.const 0)) (i32.const 1)))
+    (call $peek (call $peek (i32.const 0))))
+
+  (func $enter (param $nArgs i32)
+    (call $push (i32.const 0))
+    (call $push (call $peek (i32.const 1)))
+    (call $push (call $peek (i32.const 2)))
+    (call $push (call $peek (i32.const 3)))
+    (call $push (call $peek (i32.const 4)))
+    (call $poke (i32.const 2) (i32.sub (call $peek (i32.const 0)) (i32.add (local.get $nArgs) (i32.const 5))))
+    (call $poke (i32.const 1) (call $peek (i32.const 0))))
+
+  (func $leave (local $frame i32)
+    (local.set $frame (call $peek (i32.const 1)))
+    (call $poke (call $peek (i32.const 2)) (call $pop))
+    (call $poke (i32.const 0) (i32.add (call $peek (i32.const 2)) (i32.const 1)))
+    (call $poke (i32.const 4) (call $peek (i32.sub (local.get $frame) (i32.const 1))))
+    (call $poke (i32.const 3) (call $peek (i32.sub (local.get $frame) (i32.const 2))))
+    (call $poke (i32.const 2) (call $peek (i32.sub (local.get $frame) (i32.const 3))))
+    (call $poke (i32.const 1) (call $peek (i32.sub (local.get $frame) (i32.const 4)))))
+`
+
+// A run of a function's code that starts at a vm label (or at the function entry for the first one)
+type watBlock struct {
+	label string
+	code  *strings.Builder
+}
+
+// Translates vm commands into the WebAssembly text format. Each vm function becomes a wasm function.
+// Vm labels split a function into blocks that are nested inside a dispatch loop: a goto stores the
+// number of its target label in $pc and branches to the top of the loop, where a br_table jumps to
+// the end of the block preceding the label.
+type watWriter struct {
+	out          io.Writer
+	currFname    string
+	currFunction string
+	inFunction   bool
+	hasFileBody  bool
+	prevLabel    string
+	preamble     *strings.Builder
+	blocks       []watBlock
+	labelIds     map[string]int
+	functions    []string
+	layout       MemoryLayout
+}
+
+func newWatWriter(out io.Writer, layout MemoryLayout) watWriter {
+	return watWriter{
+		out:    out,
+		layout: layout,
+	}
+}
+
+func (ww *watWriter) setCurrFname(vmFileFname string) {
+	ww.currFname = vmFileFname
+}
+
+func (ww *watWriter) write(command vmast.Command) {
+	if !ww.inFunction && !isFunction(command) {
+		ww.hasFileBody = true
+		ww.openFunction(watFileBodyName(ww.currFname))
+	}
+
+	prevLabel := ww.prevLabel
+	ww.prevLabel = ""
+
+	switch c := command.(type) {
+	case vmast.Push:
+		ww.writePush(c.Segment, c.Index)
+	case vmast.Pop:
+		ww.writePop(c.Segment, c.Index)
+	case vmast.Arithmetic:
+		ww.writeArithmetic(c.Op)
+	case vmast.Label:
+		ww.prevLabel = c.Name
+		ww.labelId(c.Name)
+		ww.blocks = append(ww.blocks, watBlock{label: c.Name, code: &strings.Builder{}})
+	case vmast.Goto:
+		if c.Label == prevLabel {
+			// A label immediately followed by a jump to itself is how a vm program halts
+			ww.emit("(call $halt)")
+		}
+		ww.emit(fmt.Sprintf("(local.set $pc (i32.const %d)) (br $dispatch)", ww.labelId(c.Label)))
+	case vmast.IfGoto:
+		ww.emit(fmt.Sprintf("(if (call $pop) (then (local.set $pc (i32.const %d)) (br $dispatch)))", ww.labelId(c.Label)))
+	case vmast.Function:
+		ww.closeFunction()
+		ww.currFunction = c.Name
+		ww.functions = append(ww.functions, c.Name)
+		ww.openFunction(watFunctionName(c.Name))
+		for range c.NVars {
+			ww.preamble.WriteString("    (call $push (i32.const 0))\n")
+		}
+	case vmast.Call:
+		if c.Name == "Sys.halt" {
+			// Sys.halt spins forever on the Hack platform
+			ww.emit("(call $halt)")
+			break
+		}
+		ww.emit(fmt.Sprintf("(call $enter (i32.const %d)) (call %s)", c.NArgs, watFunctionName(c.Name)))
+	case vmast.Return:
+		ww.emit("(call $leave) (return)")
+	}
+}
+
+func (ww *watWriter) openFunction(watName string) {
+	ww.inFunction = true
+	ww.preamble = &strings.Builder{}
+	ww.blocks = []watBlock{{code: &strings.Builder{}}}
+	ww.labelIds = map[string]int{}
+	fmt.Fprintf(ww.preamble, "  (func %s (local $pc i32) (local $x i32) (local $y i32)\n", watName)
+}
+
+// Writes out the function being translated, nesting its blocks inside the dispatch loop when the
+// function contains labels
+func (ww *watWriter) closeFunction() {
+	if !ww.inFunction {
+		return
+	}
+	ww.inFunction = false
+
+	// Targets of the br_table, indexed by label id. Id 0 is the function entry.
+	targets := make([]string, len(ww.labelIds)+1)
+	targets[0] = "$entry"
+	for label, id := range ww.labelIds {
+		if !slices.ContainsFunc(ww.blocks, func(block watBlock) bool { return block.label == label }) {
+			log.Fatalf("vmtranslator.closeFunction: label %s is not defined in %s", label, ww.currFunction)
+		}
+		targets[id] = watLabelName(label)
+	}
+
+	var b strings.Builder
+	b.WriteString(ww.preamble.String())
+
+	if len(ww.blocks) == 1 {
+		b.WriteString(ww.blocks[0].code.String())
+	} else {
+		blockNames := []string{"$entry"}
+		for _, block := range ww.blocks[1:] {
+			blockNames = append(blockNames, watLabelName(block.label))
+		}
+
+		b.WriteString("    (loop $dispatch\n")
+		for i := len(blockNames) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "    (block %s\n", blockNames[i])
+		}
+		fmt.Fprintf(&b, "    (br_table %s $entry (local.get $pc)))\n", strings.Join(targets, " "))
+		for i, block := range ww.blocks {
+			b.WriteString(block.code.String())
+			if i < len(ww.blocks)-1 {
+				b.WriteString("    )\n")
+			}
+		}
+		b.WriteString("    )\n")
+	}
+	b.WriteString("  )\n\n")
+
+	if _, err := io.WriteString(ww.out, b.String()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Closes the function left open by the last vm command of the file
+func (ww *watWriter) close() {
+	ww.closeFunction()
+}
+
+// Returns the value $pc is set to when jumping to a label of the current function
+func (ww *watWriter) labelId(label string) int {
+	id, ok := ww.labelIds[label]
+	if !ok {
+		id = len(ww.labelIds) + 1
+		ww.labelIds[label] = id
+	}
+	return id
+}
+
+func (ww *watWriter) emit(instr string) {
+	fmt.Fprintf(ww.blocks[len(ww.blocks)-1].code, "    %s\n", instr)
+}
+
+func (ww *watWriter) writePush(segment string, index int) {
+	if segment == "constant" {
+		ww.emit(fmt.Sprintf("(call $push (i32.const %d))", index))
+		return
+	}
+	ww.emit(fmt.Sprintf("(call $push (call $peek %s))", ww.segmentAddr(segment, index)))
+}
+
+func (ww *watWriter) writePop(segment string, index int) {
+	ww.emit(fmt.Sprintf("(call $poke %s (call $pop))", ww.segmentAddr(segment, index)))
+}
+
+// Returns an expression computing the RAM address of a word of a memory segment
+func (ww *watWriter) segmentAddr(segment string, index int) string {
+	switch segment {
+	case "static":
+		return fmt.Sprintf("(global.get %s)", watStaticName(ww.currFname, index))
+	case "local", "argument", "this", "that":
+		base := map[string]int{"local": 1, "argument": 2, "this": 3, "that": 4}[segment]
+		return fmt.Sprintf("(i32.add (call $peek (i32.const %d)) (i32.const %d))", base, index)
+	case "temp":
+		return fmt.Sprintf("(i32.add (i32.const %d) (i32.const %d))", ww.layout.TempBase, index)
+	case "pointer":
+		return fmt.Sprintf("(i32.add (i32.const %d) (i32.const %d))", pointerBase, index)
+	default:
+		log.Fatalf("vmtranslator.segmentAddr: invalid segment %s", segment)
+		return ""
+	}
+}
+
+func (ww *watWriter) writeArithmetic(command string) {
+	switch command {
+	case "neg":
+		ww.emit("(call $push (i32.sub (i32.const 0) (call $pop)))")
+	case "not":
+		ww.emit("(call $push (i32.xor (call $pop) (i32.const -1)))")
+	default:
+		opMap := map[string]string{
+			"add": "(i32.add (local.get $x) (local.get $y))",
+			"sub": "(i32.sub (local.get $x) (local.get $y))",
+			"and": "(i32.and (local.get $x) (local.get $y))",
+			"or":  "(i32.or (local.get $x) (local.get $y))",
+			"eq":  "(i32.sub (i32.const 0) (i32.eq (local.get $x) (local.get $y)))",
+			"gt":  "(i32.sub (i32.const 0) (i32.gt_s (local.get $x) (local.get $y)))",
+			"lt":  "(i32.sub (i32.const 0) (i32.lt_s (local.get $x) (local.get $y)))",
+		}
+		ww.emit(fmt.Sprintf("(local.set $y (call $pop)) (local.set $x (call $pop)) (call $push %s)", opMap[command]))
+	}
+}
+
+// Writes the complete module: the runtime, the addresses of static variables, the translated vm
+// files and the exported main function
+func writeWatProgram(out io.Writer, watWriters []watWriter, fileBodies []string, statics []staticVar, boot bootstrap, layout MemoryLayout) {
+	var b strings.Builder
+
+	b.WriteString("(module\n")
+	b.WriteString(watPrelude)
+	b.WriteString("\n")
+
+	for _, v := range statics {
+		fmt.Fprintf(&b, "  (global %s i32 (i32.const %d))\n", watStaticName(v.fname, v.index), v.addr)
+	}
+	b.WriteString("\n")
+
+	for _, fileBody := range fileBodies {
+		b.WriteString(fileBody)
+	}
+
+	b.WriteString("  (func (export \"main\")\n")
+	if boot.enabled {
+		if boot.onReturn == OnReturnReset {
+			b.WriteString("    (loop $reset\n")
+		}
+		fmt.Fprintf(&b, "    (call $poke (i32.const 0) (i32.const %d))\n", layout.StackBase)
+		fmt.Fprintf(&b, "    (call $enter (i32.const 0)) (call %s)\n", watFunctionName(boot.entry))
+		switch boot.onReturn {
+		case OnReturnReset:
+			b.WriteString("    (br $reset))\n")
+		case OnReturnTrap:
+			fmt.Fprintf(&b, "    (call $enter (i32.const 0)) (call %s)\n", watFunctionName(boot.trap))
+		}
+	} else {
+		// Without a bootstrap, execution starts at the first vm command of the program
+		for i := range watWriters {
+			if watWriters[i].hasFileBody {
+				fmt.Fprintf(&b, "    (call %s)\n", watFileBodyName(watWriters[i].currFname))
+			} else if i == 0 && len(watWriters[i].functions) > 0 {
+				fmt.Fprintf(&b, "    (call %s)\n", watFunctionName(watWriters[i].functions[0]))
+			}
+		}
+	}
+	b.WriteString("    (call $halt))\n")
+	b.WriteString(")\n")
+
+	if _, err := io.WriteString(out, b.String()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Vm names only use characters that are valid in wasm text identifiers, so they are only prefixed
+// to keep them apart from the runtime's own names
+func watFunctionName(fnName string) string {
+	return "$fn." + fnName
+}
+
+func watFileBodyName(vmFileFname string) string {
+	return "$file." + vmFileFname
+}
+
+func watStaticName(vmFileFname string, index int) string {
+	return fmt.Sprintf("$static.%s.%d", vmFileFname, index)
+}
+
+func watLabelName(label string) string {
+	return "$label." + label
+}
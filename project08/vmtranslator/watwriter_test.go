@@ -0,0 +1,491 @@
+package vmtranslator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A node of the wasm text format: either an atom (keyword, identifier, number or string) or a
+// parenthesized list of nodes
+type sexpr struct {
+	atom string
+	list []*sexpr
+}
+
+func (e *sexpr) isList() bool {
+	return e.list != nil
+}
+
+// Returns the keyword of a list such as "func" for (func ...)
+func (e *sexpr) head() string {
+	if !e.isList() || len(e.list) == 0 || e.list[0].isList() {
+		return ""
+	}
+	return e.list[0].atom
+}
+
+func parseWat(src string) (*sexpr, error) {
+	tokens := []string{}
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == ';' && i+1 < len(src) && src[i+1] == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, src[i:i+end+2])
+			i += end + 2
+		default:
+			start := i
+			for i < len(src) && !strings.ContainsRune("() \t\n\r", rune(src[i])) {
+				i++
+			}
+			tokens = append(tokens, src[start:i])
+		}
+	}
+
+	pos := 0
+	var parse func() (*sexpr, error)
+	parse = func() (*sexpr, error) {
+		if pos >= len(tokens) {
+			return nil, fmt.Errorf("unexpected end of input")
+		}
+		token := tokens[pos]
+		pos++
+		switch token {
+		case ")":
+			return nil, fmt.Errorf("unexpected ) at token %d", pos-1)
+		case "(":
+			e := &sexpr{list: []*sexpr{}}
+			for pos < len(tokens) && tokens[pos] != ")" {
+				child, err := parse()
+				if err != nil {
+					return nil, err
+				}
+				e.list = append(e.list, child)
+			}
+			if pos >= len(tokens) {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+			pos++
+			return e, nil
+		default:
+			return &sexpr{atom: token}, nil
+		}
+	}
+
+	module, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	if pos != len(tokens) {
+		return nil, fmt.Errorf("unexpected tokens after the module")
+	}
+	if module.head() != "module" {
+		return nil, fmt.Errorf("expected a module, got %q", module.head())
+	}
+	return module, nil
+}
+
+type watFunc struct {
+	params []string
+	locals map[string]bool
+	result bool
+	body   []*sexpr
+}
+
+// A wasm module limited to the instructions produced by the wat backend, with the checks a wat
+// parser performs on names and the ability to run it against a Hack RAM
+type watModule struct {
+	funcs   map[string]*watFunc
+	exports map[string]string
+	imports map[string]bool
+	globals map[string]int32
+	mem     []byte
+	steps   int
+}
+
+// Arity of each supported plain instruction: number of operands popped and results pushed
+var watInstrs = map[string][2]int{
+	"i32.add": {2, 1}, "i32.sub": {2, 1}, "i32.and": {2, 1}, "i32.or": {2, 1}, "i32.xor": {2, 1},
+	"i32.shl": {2, 1}, "i32.eq": {2, 1}, "i32.gt_s": {2, 1}, "i32.lt_s": {2, 1},
+	"i32.load16_s": {1, 1}, "i32.store16": {2, 0},
+}
+
+func loadWatModule(src string) (*watModule, error) {
+	module, err := parseWat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &watModule{
+		funcs:   map[string]*watFunc{},
+		exports: map[string]string{},
+		imports: map[string]bool{},
+		globals: map[string]int32{},
+		mem:     make([]byte, 65536),
+	}
+	for i, field := range module.list[1:] {
+		switch field.head() {
+		case "import":
+			if desc := field.list[len(field.list)-1]; desc.head() == "func" {
+				m.imports[desc.list[1].atom] = true
+			}
+		case "global":
+			value := field.list[len(field.list)-1]
+			if value.head() != "i32.const" {
+				return nil, fmt.Errorf("global %s is not an i32 constant", field.list[1].atom)
+			}
+			n, err := strconv.ParseInt(value.list[1].atom, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			m.globals[field.list[1].atom] = int32(n)
+		case "func":
+			name := fmt.Sprintf("$anonymous.%d", i)
+			fn := &watFunc{locals: map[string]bool{}}
+			for _, part := range field.list[1:] {
+				switch {
+				case !part.isList():
+					name = part.atom
+				case part.head() == "export":
+					m.exports[strings.Trim(part.list[1].atom, `"`)] = name
+				case part.head() == "param":
+					fn.params = append(fn.params, part.list[1].atom)
+					fn.locals[part.list[1].atom] = true
+				case part.head() == "local":
+					fn.locals[part.list[1].atom] = true
+				case part.head() == "result":
+					fn.result = true
+				default:
+					fn.body = append(fn.body, part)
+				}
+			}
+			if _, ok := m.funcs[name]; ok {
+				return nil, fmt.Errorf("function %s is defined twice", name)
+			}
+			m.funcs[name] = fn
+		default:
+			return nil, fmt.Errorf("unexpected module field %q", field.head())
+		}
+	}
+
+	for name, fn := range m.funcs {
+		for _, instr := range fn.body {
+			if err := m.validate(instr, fn, []string{}); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Checks that an instruction is known and that the functions, globals, locals and labels it names
+// are in scope
+func (m *watModule) validate(instr *sexpr, fn *watFunc, labels []string) error {
+	if !instr.isList() {
+		return fmt.Errorf("unexpected atom %q", instr.atom)
+	}
+	op := instr.head()
+	args := instr.list[1:]
+	switch op {
+	case "i32.const":
+		if _, err := strconv.ParseInt(args[0].atom, 10, 32); err != nil {
+			return fmt.Errorf("invalid constant %q", args[0].atom)
+		}
+		return nil
+	case "local.get", "local.set":
+		if !fn.locals[args[0].atom] {
+			return fmt.Errorf("unknown local %s", args[0].atom)
+		}
+		args = args[1:]
+	case "global.get":
+		if _, ok := m.globals[args[0].atom]; !ok {
+			return fmt.Errorf("unknown global %s", args[0].atom)
+		}
+		return nil
+	case "call":
+		if _, ok := m.funcs[args[0].atom]; !ok && !m.imports[args[0].atom] {
+			return fmt.Errorf("call to unknown function %s", args[0].atom)
+		}
+		args = args[1:]
+	case "br":
+		if !containsLabel(labels, args[0].atom) {
+			return fmt.Errorf("branch to unknown label %s", args[0].atom)
+		}
+		return nil
+	case "br_table":
+		for _, arg := range args {
+			if !arg.isList() && !containsLabel(labels, arg.atom) {
+				return fmt.Errorf("branch to unknown label %s", arg.atom)
+			}
+		}
+		args = args[len(args)-1:]
+	case "block", "loop":
+		labels = append(labels, args[0].atom)
+		args = args[1:]
+	case "if", "then":
+	case "return":
+	default:
+		if _, ok := watInstrs[op]; !ok {
+			return fmt.Errorf("unknown instruction %q", op)
+		}
+	}
+
+	for _, arg := range args {
+		if err := m.validate(arg, fn, labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+type watSignal struct {
+	kind  string // "br", "return" or "halt"
+	label string
+}
+
+type watFrame struct {
+	locals map[string]int32
+	stack  []int32
+}
+
+func (fr *watFrame) push(v int32) {
+	fr.stack = append(fr.stack, v)
+}
+
+func (fr *watFrame) pop() int32 {
+	v := fr.stack[len(fr.stack)-1]
+	fr.stack = fr.stack[:len(fr.stack)-1]
+	return v
+}
+
+// Runs an exported function until it returns or the program halts
+func (m *watModule) run(export string, maxSteps int) error {
+	m.steps = maxSteps
+	_, sig, err := m.call(m.exports[export], nil)
+	if err != nil {
+		return err
+	}
+	if sig == nil || sig.kind != "halt" {
+		return fmt.Errorf("program returned without halting")
+	}
+	return nil
+}
+
+func (m *watModule) call(name string, args []int32) (int32, *watSignal, error) {
+	if name == "$halt" {
+		return 0, &watSignal{kind: "halt"}, nil
+	}
+	fn := m.funcs[name]
+	fr := &watFrame{locals: map[string]int32{}}
+	for i, param := range fn.params {
+		fr.locals[param] = args[i]
+	}
+	for _, instr := range fn.body {
+		sig, err := m.exec(instr, fr)
+		if err != nil {
+			return 0, nil, err
+		}
+		if sig != nil && sig.kind == "halt" {
+			return 0, sig, nil
+		}
+		if sig != nil && sig.kind == "return" {
+			break
+		}
+	}
+	if fn.result {
+		return fr.pop(), nil, nil
+	}
+	return 0, nil, nil
+}
+
+func (m *watModule) execAll(instrs []*sexpr, fr *watFrame) (*watSignal, error) {
+	for _, instr := range instrs {
+		if sig, err := m.exec(instr, fr); sig != nil || err != nil {
+			return sig, err
+		}
+	}
+	return nil, nil
+}
+
+func (m *watModule) exec(instr *sexpr, fr *watFrame) (*watSignal, error) {
+	m.steps--
+	if m.steps < 0 {
+		return nil, fmt.Errorf("program did not halt")
+	}
+
+	op := instr.head()
+	args := instr.list[1:]
+	switch op {
+	case "block":
+		sig, err := m.execAll(args[1:], fr)
+		if sig != nil && sig.kind == "br" && sig.label == args[0].atom {
+			return nil, err
+		}
+		return sig, err
+	case "loop":
+		for {
+			sig, err := m.execAll(args[1:], fr)
+			if sig != nil && sig.kind == "br" && sig.label == args[0].atom {
+				continue
+			}
+			return sig, err
+		}
+	case "if":
+		if sig, err := m.exec(args[0], fr); sig != nil || err != nil {
+			return sig, err
+		}
+		if fr.pop() != 0 {
+			return m.execAll(args[1].list[1:], fr)
+		}
+		return nil, nil
+	case "br":
+		return &watSignal{kind: "br", label: args[0].atom}, nil
+	case "br_table":
+		if sig, err := m.exec(args[len(args)-1], fr); sig != nil || err != nil {
+			return sig, err
+		}
+		targets := args[:len(args)-1]
+		idx := int(fr.pop())
+		if idx < 0 || idx >= len(targets)-1 {
+			idx = len(targets) - 1
+		}
+		return &watSignal{kind: "br", label: targets[idx].atom}, nil
+	case "return":
+		return &watSignal{kind: "return"}, nil
+	case "i32.const":
+		n, _ := strconv.ParseInt(args[0].atom, 10, 32)
+		fr.push(int32(n))
+		return nil, nil
+	case "global.get":
+		fr.push(m.globals[args[0].atom])
+		return nil, nil
+	case "local.get":
+		fr.push(fr.locals[args[0].atom])
+		return nil, nil
+	}
+
+	// Remaining instructions evaluate their operands first
+	operands := args
+	if op == "local.set" || op == "call" {
+		operands = args[1:]
+	}
+	for _, operand := range operands {
+		if sig, err := m.exec(operand, fr); sig != nil || err != nil {
+			return sig, err
+		}
+	}
+
+	switch op {
+	case "local.set":
+		fr.locals[args[0].atom] = fr.pop()
+	case "call":
+		callArgs := make([]int32, len(operands))
+		for i := len(callArgs) - 1; i >= 0; i-- {
+			callArgs[i] = fr.pop()
+		}
+		result, sig, err := m.call(args[0].atom, callArgs)
+		if sig != nil || err != nil {
+			return sig, err
+		}
+		if name := args[0].atom; name != "$halt" && m.funcs[name].result {
+			fr.push(result)
+		}
+	case "i32.load16_s":
+		addr := fr.pop()
+		fr.push(int32(int16(binary.LittleEndian.Uint16(m.mem[addr:]))))
+	case "i32.store16":
+		value := fr.pop()
+		addr := fr.pop()
+		binary.LittleEndian.PutUint16(m.mem[addr:], uint16(value))
+	default:
+		y, x := fr.pop(), fr.pop()
+		ops := map[string]func(x, y int32) int32{
+			"i32.add":  func(x, y int32) int32 { return x + y },
+			"i32.sub":  func(x, y int32) int32 { return x - y },
+			"i32.and":  func(x, y int32) int32 { return x & y },
+			"i32.or":   func(x, y int32) int32 { return x | y },
+			"i32.xor":  func(x, y int32) int32 { return x ^ y },
+			"i32.shl":  func(x, y int32) int32 { return x << (y & 31) },
+			"i32.eq":   func(x, y int32) int32 { return boolToI32(x == y) },
+			"i32.gt_s": func(x, y int32) int32 { return boolToI32(x > y) },
+			"i32.lt_s": func(x, y int32) int32 { return boolToI32(x < y) },
+		}
+		fr.push(ops[op](x, y))
+	}
+	return nil, nil
+}
+
+func boolToI32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestTranslateToWat(t *testing.T) {
+	for _, tc := range courseTestPrograms {
+		t.Run(tc.name, func(t *testing.T) {
+			runWatTestProgram(t, tc.name, tc.programDir, Options{Target: TargetWat})
+		})
+	}
+}
+
+// Translates a course test program to WebAssembly text with opts, runs it and checks the RAM it
+// leaves against the compare file of the program
+func runWatTestProgram(t *testing.T, name string, srcDir string, opts Options) {
+	t.Helper()
+
+	programDir := copyVmProgram(t, srcDir)
+	programPath, watFilePath := translatedPath(programDir, name, ".wat")
+	Translate(programPath, opts)
+
+	src, err := os.ReadFile(watFilePath)
+	if err != nil {
+		t.Fatalf("Failed to read generated output file %s: %v", watFilePath, err)
+	}
+	m, err := loadWatModule(string(src))
+	if err != nil {
+		t.Fatalf("Invalid module %s: %v", watFilePath, err)
+	}
+
+	initial, expected := readTestScript(t,
+		filepath.Join(srcDir, name+".tst"),
+		filepath.Join(srcDir, name+".cmp"))
+	for addr, value := range initial {
+		binary.LittleEndian.PutUint16(m.mem[addr*2:], uint16(value))
+	}
+	if err := m.run("main", 10_000_000); err != nil {
+		t.Fatalf("Failed to run %s: %v", watFilePath, err)
+	}
+
+	for addr, value := range expected {
+		if got := int(int16(binary.LittleEndian.Uint16(m.mem[addr*2:]))); got != value {
+			t.Errorf("RAM[%d] = %d, expected %d", addr, got, value)
+		}
+	}
+}
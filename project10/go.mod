@@ -1,3 +1,7 @@
 module jackc
 
 go 1.25.1
+
+require jack v0.0.0
+
+replace jack => ../jack
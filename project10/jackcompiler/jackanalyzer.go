@@ -1,78 +1,26 @@
 package jackcompiler
 
 import (
-	"fmt"
+	"io"
+	"jack/ast"
+	"jack/driver"
 	"log"
-	"os"
-	"path"
-	"path/filepath"
-	"strings"
 )
 
+// Writes the XML parse tree of every jack file of a program to output/ next to it
 func Analyze(programPath string) {
-	jackPaths := getJackPaths(programPath)
-
-	for _, path := range jackPaths {
-		go analyzeJackFile(path)
-	}
-}
-
-func analyzeJackFile(jackPath string) {
-	f, err := os.Open(jackPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-
-	dir, fileName := path.Split(jackPath)
-	outfPath := filepath.Join(dir, "output/", strings.Replace(fileName, ".jack", ".xml", 1))
-	err = os.MkdirAll(path.Dir(outfPath), 0755)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	outf, err := os.Create(outfPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer outf.Close()
-
-	ce := newCompilationEngine(f, outf)
-	ce.compileClass()
-}
-
-func getJackPaths(programPath string) []string {
-	jackPaths := []string{}
-
-	info, err := os.Stat(programPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	if info.IsDir() {
-		jackPaths = getJackPathsFromDir(programPath)
-	} else if strings.HasSuffix(programPath, ".jack") {
-		jackPaths = append(jackPaths, programPath)
-	}
-
-	return jackPaths
-}
-
-func getJackPathsFromDir(dirPath string) []string {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	jackFilePaths := []string{}
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jack") {
-			jackFilePaths = append(jackFilePaths, fmt.Sprintf("%s/%s", dirPath, entry.Name()))
+	errs := driver.Run(programPath, driver.Options{
+		OutputExt: ".xml",
+		Generate: func(w io.Writer, class *ast.Class) error {
+			xw := newXmlWriter(w)
+			xw.writeClass(class)
+			return nil
+		},
+	})
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Println(err)
 		}
+		log.Fatalf("jackcompiler.Analyze: %d errors in %s\n", len(errs), programPath)
 	}
-	if len(jackFilePaths) == 0 {
-		log.Fatal("No .jack files in the input directory")
-	}
-
-	return jackFilePaths
 }
@@ -0,0 +1,244 @@
+package jackcompiler
+
+import (
+	"fmt"
+	"io"
+	"jack/ast"
+	"jack/token"
+)
+
+var xmlEscapes = map[string]string{
+	"&": "&amp;",
+	"<": "&lt;",
+	">": "&gt;",
+}
+
+// Writes the syntax tree of a class as the course's XML parse tree, reproducing every token of the
+// source in order
+type xmlWriter struct {
+	outf io.Writer
+}
+
+func newXmlWriter(outf io.Writer) xmlWriter {
+	return xmlWriter{outf: outf}
+}
+
+func (xw *xmlWriter) open(tag string) {
+	fmt.Fprintf(xw.outf, "<%s>\n", tag)
+}
+
+func (xw *xmlWriter) close(tag string) {
+	fmt.Fprintf(xw.outf, "</%s>\n", tag)
+}
+
+func (xw *xmlWriter) token(kind string, text string) {
+	if kind == token.Symbol {
+		if escaped, ok := xmlEscapes[text]; ok {
+			text = escaped
+		}
+	}
+	fmt.Fprintf(xw.outf, "<%s> %s </%s>\n", kind, text, kind)
+}
+
+func (xw *xmlWriter) keyword(text string) {
+	xw.token(token.Keyword, text)
+}
+
+func (xw *xmlWriter) symbol(text string) {
+	xw.token(token.Symbol, text)
+}
+
+func (xw *xmlWriter) identifier(text string) {
+	xw.token(token.Identifier, text)
+}
+
+// Built-in types are keywords, class types are identifiers
+func (xw *xmlWriter) writeType(t string) {
+	if token.Keywords[t] {
+		xw.keyword(t)
+	} else {
+		xw.identifier(t)
+	}
+}
+
+// Writes names separated by commas
+func (xw *xmlWriter) writeNames(names []string) {
+	for i, name := range names {
+		if i > 0 {
+			xw.symbol(",")
+		}
+		xw.identifier(name)
+	}
+}
+
+func (xw *xmlWriter) writeClass(class *ast.Class) {
+	xw.open("class")
+	xw.keyword("class")
+	xw.identifier(class.Name)
+	xw.symbol("{")
+	for _, dec := range class.VarDecs {
+		xw.open("classVarDec")
+		xw.keyword(dec.Kind)
+		xw.writeType(dec.Type)
+		xw.writeNames(dec.Names)
+		xw.symbol(";")
+		xw.close("classVarDec")
+	}
+	for _, sub := range class.Subroutines {
+		xw.writeSubroutine(sub)
+	}
+	xw.symbol("}")
+	xw.close("class")
+}
+
+func (xw *xmlWriter) writeSubroutine(sub *ast.Subroutine) {
+	xw.open("subroutineDec")
+	xw.keyword(sub.Kind)
+	xw.writeType(sub.ReturnType)
+	xw.identifier(sub.Name)
+	xw.symbol("(")
+	xw.open("parameterList")
+	for i, param := range sub.Params {
+		if i > 0 {
+			xw.symbol(",")
+		}
+		xw.writeType(param.Type)
+		xw.identifier(param.Name)
+	}
+	xw.close("parameterList")
+	xw.symbol(")")
+
+	xw.open("subroutineBody")
+	xw.symbol("{")
+	for _, dec := range sub.VarDecs {
+		xw.open("varDec")
+		xw.keyword("var")
+		xw.writeType(dec.Type)
+		xw.writeNames(dec.Names)
+		xw.symbol(";")
+		xw.close("varDec")
+	}
+	xw.writeStatements(sub.Statements)
+	xw.symbol("}")
+	xw.close("subroutineBody")
+	xw.close("subroutineDec")
+}
+
+func (xw *xmlWriter) writeStatements(statements []ast.Statement) {
+	xw.open("statements")
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			xw.open("letStatement")
+			xw.keyword("let")
+			xw.identifier(s.Name)
+			if s.Index != nil {
+				xw.symbol("[")
+				xw.writeExpression(s.Index)
+				xw.symbol("]")
+			}
+			xw.symbol("=")
+			xw.writeExpression(s.Value)
+			xw.symbol(";")
+			xw.close("letStatement")
+		case *ast.IfStatement:
+			xw.open("ifStatement")
+			xw.keyword("if")
+			xw.writeBlock(s.Cond, s.Then)
+			if s.HasElse {
+				xw.keyword("else")
+				xw.symbol("{")
+				xw.writeStatements(s.Else)
+				xw.symbol("}")
+			}
+			xw.close("ifStatement")
+		case *ast.WhileStatement:
+			xw.open("whileStatement")
+			xw.keyword("while")
+			xw.writeBlock(s.Cond, s.Body)
+			xw.close("whileStatement")
+		case *ast.DoStatement:
+			xw.open("doStatement")
+			xw.keyword("do")
+			xw.writeSubroutineCall(s.Call)
+			xw.symbol(";")
+			xw.close("doStatement")
+		case *ast.ReturnStatement:
+			xw.open("returnStatement")
+			xw.keyword("return")
+			if s.Value != nil {
+				xw.writeExpression(s.Value)
+			}
+			xw.symbol(";")
+			xw.close("returnStatement")
+		}
+	}
+	xw.close("statements")
+}
+
+// '(' expression ')' '{' statements '}'
+func (xw *xmlWriter) writeBlock(cond *ast.Expression, statements []ast.Statement) {
+	xw.symbol("(")
+	xw.writeExpression(cond)
+	xw.symbol(")")
+	xw.symbol("{")
+	xw.writeStatements(statements)
+	xw.symbol("}")
+}
+
+func (xw *xmlWriter) writeExpression(expr *ast.Expression) {
+	xw.open("expression")
+	xw.writeTerm(expr.Term)
+	for _, op := range expr.Ops {
+		xw.symbol(op.Op)
+		xw.writeTerm(op.Term)
+	}
+	xw.close("expression")
+}
+
+func (xw *xmlWriter) writeTerm(term ast.Term) {
+	xw.open("term")
+	switch t := term.(type) {
+	case *ast.IntConst:
+		xw.token(token.IntConst, fmt.Sprint(t.Value))
+	case *ast.StringConst:
+		xw.token(token.StringConst, t.Value)
+	case *ast.KeywordConst:
+		xw.keyword(t.Value)
+	case *ast.VarRef:
+		xw.identifier(t.Name)
+	case *ast.ArrayAccess:
+		xw.identifier(t.Name)
+		xw.symbol("[")
+		xw.writeExpression(t.Index)
+		xw.symbol("]")
+	case *ast.ParenExpr:
+		xw.symbol("(")
+		xw.writeExpression(t.Expr)
+		xw.symbol(")")
+	case *ast.UnaryOp:
+		xw.symbol(t.Op)
+		xw.writeTerm(t.Term)
+	case *ast.SubroutineCall:
+		xw.writeSubroutineCall(t)
+	}
+	xw.close("term")
+}
+
+func (xw *xmlWriter) writeSubroutineCall(call *ast.SubroutineCall) {
+	if call.Receiver != "" {
+		xw.identifier(call.Receiver)
+		xw.symbol(".")
+	}
+	xw.identifier(call.Name)
+	xw.symbol("(")
+	xw.open("expressionList")
+	for i, arg := range call.Args {
+		if i > 0 {
+			xw.symbol(",")
+		}
+		xw.writeExpression(arg)
+	}
+	xw.close("expressionList")
+	xw.symbol(")")
+}
@@ -0,0 +1,292 @@
+package jackcompiler
+
+import (
+	"fmt"
+	"jack/ast"
+	"jack/index"
+	"jack/symbols"
+)
+
+// Generates vm code for the syntax tree of a class
+type codeGenerator struct {
+	vw         vmWriter
+	ix         *index.Index
+	className  string
+	classSt    *symbols.Table
+	routineSt  *symbols.Table
+	ifCount    int
+	whileCount int
+	// The loops around the statement being compiled, innermost last
+	loops []loopLabels
+}
+
+// Labels break and continue jump to
+type loopLabels struct {
+	continueLabel string
+	endLabel      string
+}
+
+func newCodeGenerator(vw vmWriter, ix *index.Index) codeGenerator {
+	return codeGenerator{vw: vw, ix: ix}
+}
+
+// Generates vm code for a class declaration. Entrypoint of the code generator
+// 'class' className '{' classVarDec* subroutineDec* '}'
+func (cg *codeGenerator) compileClass(class *ast.Class) {
+	cg.className = class.Name
+	cg.classSt = symbols.ClassTable(class)
+	for _, sub := range class.Subroutines {
+		cg.compileSubroutine(sub)
+	}
+}
+
+// Generates vm code for a subroutine, setting up this for constructors and methods
+// ('constructor' | 'function' | 'method') ('void' | type) subroutineName '(' parameterList ')' subroutineBody
+func (cg *codeGenerator) compileSubroutine(sub *ast.Subroutine) {
+	cg.ifCount = 0
+	cg.whileCount = 0
+	cg.routineSt = symbols.SubroutineTable(cg.className, sub)
+
+	cg.vw.writeFunction(cg.className, sub.Name, cg.routineSt.Count(symbols.Local))
+	switch sub.Kind {
+	case "constructor":
+		cg.vw.writePush(CONSTANT, cg.classSt.Count(symbols.Field))
+		cg.vw.writeCall("Memory", "alloc", 1)
+		cg.vw.writePop(POINTER, 0)
+	case "method":
+		cg.vw.writePush(ARGUMENT, 0)
+		cg.vw.writePop(POINTER, 0)
+	}
+
+	cg.compileStatements(sub.Statements)
+}
+
+// (letStatement | ifStatement | whileStatement | doStatement | returnStatement)*, along with
+// forStatement, 'break' ';' and 'continue' ';' in the extended dialect
+func (cg *codeGenerator) compileStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			cg.compileLetStatement(s)
+		case *ast.IfStatement:
+			cg.compileIfStatement(s)
+		case *ast.WhileStatement:
+			cg.compileWhileStatement(s)
+		case *ast.ForStatement:
+			cg.compileForStatement(s)
+		case *ast.BreakStatement:
+			cg.vw.writeGoto(cg.loops[len(cg.loops)-1].endLabel)
+		case *ast.ContinueStatement:
+			cg.vw.writeGoto(cg.loops[len(cg.loops)-1].continueLabel)
+		case *ast.DoStatement:
+			cg.compileSubroutineCall(s.Call)
+			cg.vw.writePop(TEMP, 0)
+		case *ast.ReturnStatement:
+			if s.Value == nil {
+				cg.vw.writePush(CONSTANT, 0)
+			} else {
+				cg.compileExpression(s.Value)
+			}
+			cg.vw.writeReturn()
+		}
+	}
+}
+
+// 'let' varName ('[' expression ']')? '=' expression ';'
+func (cg *codeGenerator) compileLetStatement(let *ast.LetStatement) {
+	identifier, _ := cg.lookupVar(let.Name)
+	if let.Index == nil {
+		cg.compileExpression(let.Value)
+		cg.vw.writePop(segment(identifier.Kind), identifier.Index)
+		return
+	}
+
+	cg.compileExpression(let.Index)
+	cg.vw.writePush(segment(identifier.Kind), identifier.Index)
+	cg.vw.writeArithmetic(ADD)
+	cg.compileExpression(let.Value)
+	cg.vw.writePop(TEMP, 0)
+	cg.vw.writePop(POINTER, 1)
+	cg.vw.writePush(TEMP, 0)
+	cg.vw.writePop(THAT, 0)
+}
+
+// 'if' '(' expression ')' '{' statements '}' ('else' '{' statements '}')?
+func (cg *codeGenerator) compileIfStatement(stmt *ast.IfStatement) {
+	ifTrueLabel := fmt.Sprintf("IF_TRUE%d", cg.ifCount)
+	ifFalseLabel := fmt.Sprintf("IF_FALSE%d", cg.ifCount)
+	ifEndLabel := fmt.Sprintf("IF_END%d", cg.ifCount)
+	cg.ifCount += 1
+
+	cg.compileExpression(stmt.Cond)
+	cg.vw.writeIf(ifTrueLabel)
+	cg.vw.writeGoto(ifFalseLabel)
+	cg.vw.writeLabel(ifTrueLabel)
+	cg.compileStatements(stmt.Then)
+	if stmt.HasElse {
+		cg.vw.writeGoto(ifEndLabel)
+		cg.vw.writeLabel(ifFalseLabel)
+		cg.compileStatements(stmt.Else)
+		cg.vw.writeLabel(ifEndLabel)
+	} else {
+		cg.vw.writeLabel(ifFalseLabel)
+	}
+}
+
+// 'while' '(' expression ')' '{' statements '}'
+func (cg *codeGenerator) compileWhileStatement(stmt *ast.WhileStatement) {
+	whileExpLabel := fmt.Sprintf("WHILE_EXP%d", cg.whileCount)
+	whileEndLabel := fmt.Sprintf("WHILE_END%d", cg.whileCount)
+	cg.whileCount += 1
+
+	cg.vw.writeLabel(whileExpLabel)
+	cg.compileExpression(stmt.Cond)
+	cg.vw.writeArithmetic(NOT)
+	cg.vw.writeIf(whileEndLabel)
+	cg.compileLoopBody(stmt.Body, loopLabels{continueLabel: whileExpLabel, endLabel: whileEndLabel})
+	cg.vw.writeGoto(whileExpLabel)
+	cg.vw.writeLabel(whileEndLabel)
+}
+
+// Compiles a for loop like a while loop that runs its update before testing again. continue jumps
+// to the update.
+// 'for' '(' letStatement expression ';' 'let' varName ('[' expression ']')? '=' expression ')'
+// '{' statements '}'
+func (cg *codeGenerator) compileForStatement(stmt *ast.ForStatement) {
+	whileExpLabel := fmt.Sprintf("WHILE_EXP%d", cg.whileCount)
+	whileIncLabel := fmt.Sprintf("WHILE_INC%d", cg.whileCount)
+	whileEndLabel := fmt.Sprintf("WHILE_END%d", cg.whileCount)
+	cg.whileCount += 1
+
+	cg.compileLetStatement(stmt.Init)
+	cg.vw.writeLabel(whileExpLabel)
+	cg.compileExpression(stmt.Cond)
+	cg.vw.writeArithmetic(NOT)
+	cg.vw.writeIf(whileEndLabel)
+	cg.compileLoopBody(stmt.Body, loopLabels{continueLabel: whileIncLabel, endLabel: whileEndLabel})
+	cg.vw.writeLabel(whileIncLabel)
+	cg.compileLetStatement(stmt.Update)
+	cg.vw.writeGoto(whileExpLabel)
+	cg.vw.writeLabel(whileEndLabel)
+}
+
+func (cg *codeGenerator) compileLoopBody(statements []ast.Statement, labels loopLabels) {
+	cg.loops = append(cg.loops, labels)
+	cg.compileStatements(statements)
+	cg.loops = cg.loops[:len(cg.loops)-1]
+}
+
+// Pushes the receiver of a method call before the arguments. A call without a class or variable
+// name is a method call on this unless the index has it as a function or constructor of the class.
+// subroutineName '(' expressionList ')' | (className | varName) '.' subroutineName '(' expressionList ')'
+func (cg *codeGenerator) compileSubroutineCall(call *ast.SubroutineCall) {
+	className := call.Receiver
+	nArgs := len(call.Args)
+	if call.Receiver == "" {
+		className = cg.className
+		if sub, ok := cg.ix.Lookup(cg.className, call.Name); !ok || sub.Kind == "method" {
+			cg.vw.writePush(POINTER, 0)
+			nArgs += 1
+		}
+	} else if receiver, ok := cg.lookupVar(call.Receiver); ok {
+		cg.vw.writePush(segment(receiver.Kind), receiver.Index)
+		className = receiver.DataType
+		nArgs += 1
+	}
+
+	for _, arg := range call.Args {
+		cg.compileExpression(arg)
+	}
+	cg.vw.writeCall(className, call.Name, nArgs)
+}
+
+// term (op term)*
+func (cg *codeGenerator) compileExpression(expr *ast.Expression) {
+	cg.compileTerm(expr.Term)
+	for _, op := range expr.Ops {
+		cg.compileTerm(op.Term)
+		cg.compileOp(op.Op)
+	}
+}
+
+// integerConstant | stringConstant | keywordConstant | varName | varName'[' expression ']' |
+// '(' expression ')' | (unaryOp term) | subroutineCall
+func (cg *codeGenerator) compileTerm(term ast.Term) {
+	switch t := term.(type) {
+	case *ast.IntConst:
+		cg.vw.writePush(CONSTANT, t.Value)
+	case *ast.StringConst:
+		cg.vw.writePush(CONSTANT, len([]rune(t.Value)))
+		cg.vw.writeCall("String", "new", 1)
+		for _, c := range t.Value {
+			cg.vw.writePush(CONSTANT, int(c))
+			cg.vw.writeCall("String", "appendChar", 2)
+		}
+	case *ast.KeywordConst:
+		switch t.Value {
+		case "true":
+			cg.vw.writePush(CONSTANT, 0)
+			cg.vw.writeArithmetic(NOT)
+		case "null", "false":
+			cg.vw.writePush(CONSTANT, 0)
+		case "this":
+			cg.vw.writePush(POINTER, 0)
+		}
+	case *ast.VarRef:
+		identifier, _ := cg.lookupVar(t.Name)
+		cg.vw.writePush(segment(identifier.Kind), identifier.Index)
+	case *ast.ArrayAccess:
+		identifier, _ := cg.lookupVar(t.Name)
+		cg.compileExpression(t.Index)
+		cg.vw.writePush(segment(identifier.Kind), identifier.Index)
+		cg.vw.writeArithmetic(ADD)
+		cg.vw.writePop(POINTER, 1)
+		cg.vw.writePush(THAT, 0)
+	case *ast.ParenExpr:
+		cg.compileExpression(t.Expr)
+	case *ast.UnaryOp:
+		cg.compileTerm(t.Term)
+		switch t.Op {
+		case "-":
+			cg.vw.writeArithmetic(NEG)
+		case "~":
+			cg.vw.writeArithmetic(NOT)
+		}
+	case *ast.SubroutineCall:
+		cg.compileSubroutineCall(t)
+	}
+}
+
+// Generates vm code for a binary operator
+func (cg *codeGenerator) compileOp(op string) {
+	switch op {
+	case "+":
+		cg.vw.writeArithmetic(ADD)
+	case "-":
+		cg.vw.writeArithmetic(SUB)
+	case "*":
+		cg.vw.writeCall("Math", "multiply", 2)
+	case "/":
+		cg.vw.writeCall("Math", "divide", 2)
+	case "&":
+		cg.vw.writeArithmetic(AND)
+	case "|":
+		cg.vw.writeArithmetic(OR)
+	case ">":
+		cg.vw.writeArithmetic(GT)
+	case "<":
+		cg.vw.writeArithmetic(LT)
+	case "=":
+		cg.vw.writeArithmetic(EQ)
+	}
+}
+
+// Performs a variable lookup by looking at the routine and class symbol tables and returns
+// the variables symbol table entry and whether or not it was found
+func (cg *codeGenerator) lookupVar(varName string) (symbols.Entry, bool) {
+	entry, ok := cg.routineSt.Lookup(varName)
+	if !ok {
+		entry, ok = cg.classSt.Lookup(varName)
+	}
+	return entry, ok
+}
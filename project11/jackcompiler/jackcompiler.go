@@ -1,77 +1,84 @@
 package jackcompiler
 
 import (
+	"io"
+	"jack/ast"
+	"jack/check"
+	"jack/driver"
+	"jack/index"
+	"jack/parser"
+	"jack/precedence"
 	"log"
 	"os"
-	"path"
-	"path/filepath"
-	"strings"
 )
 
-func Compile(programPath string) {
-	jackPaths := getJackPaths(programPath)
-
-	for _, path := range jackPaths {
-		compileJackFile(path)
-	}
+type Options struct {
+	// Signature file the calls to the OS are checked against, the built-in Jack OS signatures when
+	// empty
+	OSSigPath string
+	// Whether expressions follow operator precedence instead of applying their operators left to
+	// right like standard Jack
+	Precedence bool
+	// Whether to warn about the expressions whose value could change with operator precedence
+	WarnPrecedence bool
+	// Whether to accept the extended dialect with for loops, break, continue, else if, character and
+	// hex constants and string escapes
+	Extended bool
 }
 
-func compileJackFile(jackPath string) {
-	f, err := os.Open(jackPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-
-	dir, fileName := path.Split(jackPath)
-	outfPath := filepath.Join(dir, "output/", strings.Replace(fileName, ".jack", ".vm", 1))
-	err = os.MkdirAll(path.Dir(outfPath), 0755)
-	if err != nil {
-		log.Fatal(err)
+// Compiles the jack files of a program. Every file is parsed and checked before any vm file is
+// written, and no vm file is written when an error is found. Warnings are logged but do not stop
+// the compilation.
+func Compile(programPath string, opts Options) {
+	ix := loadOSIndex(opts.OSSigPath)
+	mode := parser.Mode(0)
+	if opts.Extended {
+		mode = parser.Extended
 	}
-
-	outf, err := os.Create(outfPath)
-	if err != nil {
-		log.Fatal(err)
+	errs := driver.Run(programPath, driver.Options{
+		OutputExt: ".vm",
+		Mode:      mode,
+		Check: func(classes []*ast.Class) []error {
+			for _, class := range classes {
+				if opts.WarnPrecedence {
+					for _, warning := range precedence.Audit(class) {
+						log.Println("warning:", warning)
+					}
+				}
+				// Regrouped before checking, so the checker sees the expressions that are compiled
+				if opts.Precedence {
+					precedence.Apply(class)
+				}
+			}
+			return check.Check(ix, classes)
+		},
+		Generate: func(w io.Writer, class *ast.Class) error {
+			cg := newCodeGenerator(newVmWriter(w), ix)
+			cg.compileClass(class)
+			return nil
+		},
+	})
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Println(err)
+		}
+		log.Fatalf("jackcompiler.Compile: %d errors in %s\n", len(errs), programPath)
 	}
-	defer outf.Close()
-
-	ce := newCompilationEngine(f, outf)
-	ce.compileClass()
 }
 
-func getJackPaths(programPath string) []string {
-	jackPaths := []string{}
-
-	info, err := os.Stat(programPath)
-	if err != nil {
-		log.Fatal(err)
+func loadOSIndex(osSigPath string) *index.Index {
+	if osSigPath == "" {
+		return index.OS()
 	}
-
-	if info.IsDir() {
-		jackPaths = getJackPathsFromDir(programPath)
-	} else if strings.HasSuffix(programPath, ".jack") {
-		jackPaths = append(jackPaths, programPath)
-	}
-
-	return jackPaths
-}
-
-func getJackPathsFromDir(dirPath string) []string {
-	entries, err := os.ReadDir(dirPath)
+	f, err := os.Open(osSigPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer f.Close()
 
-	jackFilePaths := []string{}
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jack") {
-			jackFilePaths = append(jackFilePaths, filepath.Join(dirPath, entry.Name()))
-		}
-	}
-	if len(jackFilePaths) == 0 {
-		log.Fatal("No .jack files in the input directory")
+	ix, err := index.Load(osSigPath, f)
+	if err != nil {
+		log.Fatalf("jackcompiler.loadOSIndex: %v\n", err)
 	}
-
-	return jackFilePaths
+	return ix
 }
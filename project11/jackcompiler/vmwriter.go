@@ -2,7 +2,7 @@ package jackcompiler
 
 import (
 	"fmt"
-	"os"
+	"io"
 )
 
 type segment string
@@ -33,10 +33,10 @@ const (
 )
 
 type vmWriter struct {
-	outf *os.File
+	outf io.Writer
 }
 
-func newVmWriter(outf *os.File) vmWriter {
+func newVmWriter(outf io.Writer) vmWriter {
 	return vmWriter{
 		outf: outf,
 	}
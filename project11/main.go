@@ -1,15 +1,26 @@
 package main
 
 import (
+	"flag"
 	"jackc/jackcompiler"
 	"log"
-	"os"
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	osSigPath := flag.String("os", "", "signature file of the OS classes (default: the built-in Jack OS signatures)")
+	precedence := flag.Bool("precedence", false, "give * and / precedence over + and -, over comparisons, over & and |, instead of applying operators left to right")
+	warnPrecedence := flag.Bool("warn-precedence", false, "warn about expressions whose value could change with -precedence")
+	extended := flag.Bool("extended", false, "accept the extended dialect with for loops, break, continue, else if, character and hex constants and string escapes")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatal("Path to jack file or program directory was not provided")
 	}
-	programPath := os.Args[1]
-	jackcompiler.Compile(programPath)
+	programPath := flag.Arg(0)
+	jackcompiler.Compile(programPath, jackcompiler.Options{
+		OSSigPath:      *osSigPath,
+		Precedence:     *precedence,
+		WarnPrecedence: *warnPrecedence,
+		Extended:       *extended,
+	})
 }